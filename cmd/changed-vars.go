@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/config"
+	"enzyme/pkg/provider"
+	"enzyme/pkg/state"
+)
+
+// checkChangedVariables makes things of the objects one by one to find existing objects made with
+// other user variables before anything is run. Differences of variables are printed and the command
+// is refused unless such objects are replaced by --replace or adopted by --adopt-new-vars.
+// Objects depending on others go first, so that they are destroyed before their prerequisites.
+func checkChangedVariables(objects []string, userVariables config.Config, prov provider.Provider,
+	serviceParams config.ServiceParams) error {
+	if replaceChanged && adoptNewVars {
+		return errors.New("--replace and --adopt-new-vars cannot be used together")
+	}
+
+	// changes are looked for whatever the command does with them
+	probeParams := serviceParams
+	probeParams.ChangedVariables = config.RefuseChangedVariables
+
+	replaced := map[string]bool{}
+
+	for idx := 0; idx < len(objects); idx++ {
+		_, err := createThing(objects[idx], prov, userVariables, probeParams)
+
+		var changedErr *state.ChangedVariablesError
+		if !errors.As(err, &changedErr) {
+			if err != nil {
+				log.WithFields(log.Fields{
+					"object": objects[idx],
+				}).Errorf("checkChangedVariables: cannot create thing: %s", err)
+
+				return err
+			}
+
+			continue
+		}
+
+		fmt.Print(changedErr.Describe())
+
+		switch {
+		case adoptNewVars:
+			if err := adoptObject(objects[idx], userVariables, prov, serviceParams); err != nil {
+				return fmt.Errorf("cannot adopt %s: %w", changedErr.ID, err)
+			}
+
+			fmt.Printf("Adopted %s with the new variables\n", changedErr.ID)
+
+			continue
+		case !replaceChanged:
+			return fmt.Errorf("%w; use --replace to destroy it and create a new one "+
+				"or --adopt-new-vars to keep it with the new variables", changedErr)
+		case simulate:
+			return fmt.Errorf("simulating, %s is not replaced", changedErr.ID)
+		case replaced[changedErr.ID]:
+			return fmt.Errorf("%s is not replaced: %w", changedErr.ID, changedErr)
+		}
+
+		fmt.Printf("Replacing %s\n", changedErr.ID)
+
+		if err := destroyObject(changedErr.ID); err != nil {
+			return fmt.Errorf("cannot replace %s: %w", changedErr.ID, err)
+		}
+
+		replaced[changedErr.ID] = true
+		// the thing is made again, now without the destroyed object
+		idx--
+	}
+
+	return nil
+}
+
+// adoptObject records the requested variables for the existing object; it's loaded again and saved
+// under the lock of its entry, so that it isn't changed by other processes meanwhile
+func adoptObject(object string, userVariables config.Config, prov provider.Provider,
+	serviceParams config.ServiceParams) error {
+	serviceParams.ChangedVariables = config.AdoptChangedVariables
+
+	thing, err := createThing(object, prov, userVariables, serviceParams)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := thing.(state.Entry)
+	if !ok {
+		return fmt.Errorf("%s is not stored", thing)
+	}
+
+	unlock, err := fetcher.Lock(entry)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if thing, err = createThing(object, prov, userVariables, serviceParams); err != nil {
+		return err
+	}
+
+	if err := fetcher.Save(thing.(state.Entry)); err != nil {
+		log.WithFields(log.Fields{
+			"object": thing,
+		}).Errorf("adoptObject: cannot save adopted variables: %s", err)
+
+		return err
+	}
+
+	return nil
+}
@@ -1 +1,450 @@
 package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/profile"
+	"enzyme/pkg/state"
+	"enzyme/pkg/storage"
+)
+
+// testStatus is the status of testEntry
+type testStatus int
+
+const (
+	testConfigured testStatus = iota
+	testSpawned
+)
+
+func (status testStatus) String() string {
+	if status == testSpawned {
+		return "Spawned"
+	}
+
+	return "Configured"
+}
+
+func (status testStatus) Satisfies(other controller.Status) bool {
+	return status.Equals(other)
+}
+
+func (status testStatus) Equals(other controller.Status) bool {
+	return status == other
+}
+
+// testPersist is the stored state of testEntry
+type testPersist struct {
+	Name       string
+	Provider   struct{ Name string }
+	Status     int
+	ConfigPath string
+}
+
+// testEntry is a stored object of the "test" kind, it's listed like images, clusters and storages
+type testEntry struct {
+	persist testPersist
+}
+
+func newTestEntry(provider, name string, status testStatus) *testEntry {
+	entry := &testEntry{persist: testPersist{Name: name, Status: int(status), ConfigPath: "/configs/" + name}}
+	entry.persist.Provider.Name = provider
+
+	return entry
+}
+
+func (entry *testEntry) Hierarchy() ([]string, error) {
+	return []string{"test", entry.persist.Provider.Name, entry.persist.Name}, nil
+}
+
+func (entry *testEntry) ToPublic() (interface{}, error) {
+	return entry.persist, nil
+}
+
+func (entry *testEntry) FromPublic(v interface{}) (state.Entry, error) {
+	persist, ok := v.(testPersist)
+	if !ok {
+		return nil, errors.New("wrong state of test entry")
+	}
+
+	return &testEntry{persist: persist}, nil
+}
+
+func (entry *testEntry) String() string {
+	return "test entry " + entry.persist.Name
+}
+
+func (entry *testEntry) Status() controller.Status {
+	return testStatus(entry.persist.Status)
+}
+
+func (entry *testEntry) SetStatus(status controller.Status) error {
+	entry.persist.Status = int(status.(testStatus))
+	return nil
+}
+
+func (entry *testEntry) GetTransitions(to controller.Status) ([]controller.Status, error) {
+	return nil, nil
+}
+
+func (entry *testEntry) GetAction(current controller.Status, target controller.Status) (controller.Action, error) {
+	return nil, errors.New("test entry has no actions")
+}
+
+func (entry *testEntry) Equals(other controller.Thing) bool {
+	return entry == other
+}
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+
+	state.RegisterHandler(func(hier []string, fetcher state.Fetcher) state.Entry {
+		if len(hier) != 0 && hier[0] == "test" {
+			return &testEntry{}
+		}
+
+		return nil
+	})
+}
+
+// useTestFetcher replaces the fetcher by the one keeping entries in memory,
+// returned function restores the fetcher
+func useTestFetcher(t *testing.T, entries ...state.Entry) func() {
+	saved := fetcher
+	fetcher = state.Fetcher{Chest: &state.MemChest{}}
+
+	for _, entry := range entries {
+		if err := fetcher.Save(entry); err != nil {
+			t.Fatalf("Save function returned error: [%s]", err)
+		}
+	}
+
+	return func() {
+		fetcher = saved
+	}
+}
+
+// captureOutput returns what the function prints to stdout
+func captureOutput(t *testing.T, print func() error) (string, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe function returned error: [%s]", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	printErr := print()
+
+	os.Stdout = stdout
+	writer.Close()
+
+	output, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll function returned error: [%s]", err)
+	}
+
+	return string(output), printErr
+}
+
+// setStateFlags sets flags of "enzyme state", returned function resets them
+func setStateFlags(output, kind, provider, status, name, sortBy string) func() {
+	stateOutput, stateKind, stateProvider, stateStatus, stateName, stateSort =
+		output, kind, provider, status, name, sortBy
+
+	return func() {
+		stateOutput, stateKind, stateProvider, stateStatus, stateName, stateSort =
+			outputText, "", "", "", "", "id"
+	}
+}
+
+func TestListState(t *testing.T) {
+	defer useTestFetcher(t,
+		newTestEntry("gcp", "beta", testSpawned),
+		newTestEntry("aws", "alpha", testConfigured),
+		newTestEntry("gcp", "gamma", testConfigured),
+		newTestEntry("aws", "delta", testSpawned),
+	)()
+
+	tests := []struct {
+		kind     string
+		provider string
+		status   string
+		name     string
+		sortBy   string
+		expected []string
+	}{
+		{"", "", "", "", "id", []string{"test/aws/alpha", "test/aws/delta", "test/gcp/beta", "test/gcp/gamma"}},
+		{"test", "", "", "", "name", []string{"test/aws/alpha", "test/gcp/beta", "test/aws/delta", "test/gcp/gamma"}},
+		{"image", "", "", "", "id", []string{}},
+		{"", "gcp", "", "", "id", []string{"test/gcp/beta", "test/gcp/gamma"}},
+		{"", "", "spawned", "", "id", []string{"test/aws/delta", "test/gcp/beta"}},
+		{"", "", "", "*a", "id", []string{"test/aws/alpha", "test/aws/delta", "test/gcp/beta", "test/gcp/gamma"}},
+		{"", "", "", "?e*", "name", []string{"test/gcp/beta", "test/aws/delta"}},
+		{"", "aws", "configured", "", "id", []string{"test/aws/alpha"}},
+		// equal keys are ordered by identifiers
+		{"", "", "", "", "status", []string{"test/aws/alpha", "test/gcp/gamma", "test/aws/delta", "test/gcp/beta"}},
+		{"", "", "", "", "provider", []string{"test/aws/alpha", "test/aws/delta", "test/gcp/beta", "test/gcp/gamma"}},
+	}
+
+	for _, test := range tests {
+		reset := setStateFlags(outputJSON, test.kind, test.provider, test.status, test.name, test.sortBy)
+
+		output, err := captureOutput(t, listState)
+
+		reset()
+
+		if err != nil {
+			t.Errorf("%+v: listState function returned error: [%s]", test, err)
+			continue
+		}
+
+		records := []stateRecord{}
+		if err := json.Unmarshal([]byte(output), &records); err != nil {
+			t.Errorf("%+v: wrong json output: [%s] [%s]", test, output, err)
+			continue
+		}
+
+		ids := []string{}
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%+v: wrong objects: %v!=%v", test, ids, test.expected)
+		}
+	}
+}
+
+func TestListStateWrongFlags(t *testing.T) {
+	defer useTestFetcher(t)()
+
+	tests := []struct {
+		output string
+		name   string
+		sortBy string
+	}{
+		{"xml", "", "id"},
+		{outputJSON, "", "size"},
+		{outputJSON, "[", "id"},
+	}
+
+	for _, test := range tests {
+		reset := setStateFlags(test.output, "", "", "", test.name, test.sortBy)
+
+		if _, err := captureOutput(t, listState); err == nil {
+			t.Errorf("%+v: listState function accepted wrong flags", test)
+		}
+
+		reset()
+	}
+}
+
+func TestListStateOutput(t *testing.T) {
+	defer useTestFetcher(t, newTestEntry("gcp", "beta", testSpawned), newTestEntry("aws", "alpha", testConfigured))()
+
+	expected := []stateRecord{
+		{ID: "test/aws/alpha", Kind: "test", Name: "alpha", Provider: "aws", Status: "Configured"},
+		{ID: "test/gcp/beta", Kind: "test", Name: "beta", Provider: "gcp", Status: "Spawned"},
+	}
+
+	defer setStateFlags(outputJSON, "", "", "", "", "id")()
+
+	output, err := captureOutput(t, listState)
+	if err != nil {
+		t.Fatalf("listState function returned error: [%s]", err)
+	}
+
+	records := []stateRecord{}
+	if err := json.Unmarshal([]byte(output), &records); err != nil || !reflect.DeepEqual(records, expected) {
+		t.Errorf("wrong json output: [%s] [%v]", output, err)
+	}
+
+	stateOutput = outputYAML
+
+	if output, err = captureOutput(t, listState); err != nil {
+		t.Fatalf("listState function returned error: [%s]", err)
+	}
+
+	// yaml keeps names and order of json fields
+	if !strings.HasPrefix(output, "- id: test/aws/alpha\n  kind: test\n  name: alpha\n  provider: aws\n") {
+		t.Errorf("wrong yaml output: [%s]", output)
+	}
+
+	records = []stateRecord{}
+	if err := yaml.Unmarshal([]byte(output), &records); err != nil || len(records) != len(expected) {
+		t.Errorf("wrong yaml output: [%s] [%v]", output, err)
+	}
+
+	stateOutput = outputTable
+
+	if output, err = captureOutput(t, listState); err != nil {
+		t.Fatalf("listState function returned error: [%s]", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[0]), " ") != "ID KIND NAME PROVIDER STATUS" ||
+		strings.Join(strings.Fields(lines[2]), " ") != "test/gcp/beta test beta gcp Spawned" {
+		t.Errorf("wrong table output: [%s]", output)
+	}
+
+	stateOutput = outputText
+
+	if output, err = captureOutput(t, listState); err != nil {
+		t.Fatalf("listState function returned error: [%s]", err)
+	}
+
+	if output != "test/aws/alpha - test entry alpha\ntest/gcp/beta - test entry beta\n" {
+		t.Errorf("wrong text output: [%s]", output)
+	}
+}
+
+func TestShowEntry(t *testing.T) {
+	defer useTestFetcher(t, newTestEntry("gcp", "beta", testSpawned), newTestEntry("aws", "alpha", testConfigured))()
+	defer setStateFlags(outputJSON, "", "", "", "", "id")()
+
+	output, err := captureOutput(t, func() error {
+		return showEntry("test/gcp/beta")
+	})
+	if err != nil {
+		t.Fatalf("showEntry function returned error: [%s]", err)
+	}
+
+	var details struct {
+		ID          string
+		Provider    string
+		Status      string
+		ConfigPaths map[string]string
+		State       testPersist
+		Logs        []toolLog
+	}
+
+	if err := json.Unmarshal([]byte(output), &details); err != nil {
+		t.Fatalf("wrong json output: [%s] [%s]", output, err)
+	}
+
+	if details.ID != "test/gcp/beta" || details.Provider != "gcp" || details.Status != "Spawned" ||
+		details.State.Name != "beta" || len(details.Logs) != 0 ||
+		!reflect.DeepEqual(details.ConfigPaths, map[string]string{"ConfigPath": "/configs/beta"}) {
+		t.Errorf("wrong details: [%s]", output)
+	}
+
+	stateOutput = outputYAML
+
+	if output, err = captureOutput(t, func() error {
+		return showEntry("test/gcp/beta")
+	}); err != nil {
+		t.Fatalf("showEntry function returned error: [%s]", err)
+	}
+
+	if !strings.HasPrefix(output, "id: test/gcp/beta\n") || !strings.Contains(output, "  ConfigPath: /configs/beta\n") {
+		t.Errorf("wrong yaml output: [%s]", output)
+	}
+
+	stateOutput = outputText
+
+	if output, err = captureOutput(t, func() error {
+		return showEntry("test/gcp/beta")
+	}); err != nil {
+		t.Fatalf("showEntry function returned error: [%s]", err)
+	}
+
+	for _, expected := range []string{"ID:", "test/gcp/beta", "ConfigPath:", "/configs/beta", "Stored state:"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("text output doesn't contain %s: [%s]", expected, output)
+		}
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return showEntry("test/gcp/alpha")
+	}); err == nil {
+		t.Errorf("showEntry function found a missing object")
+	}
+}
+
+func TestPrepareResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// logs of the prepared invocation are written to the folder of the test
+	logDir := storage.GetStoragePath(storage.LogCategory)
+	if _, err := os.Stat(logDir); os.IsNotExist(err) {
+		defer os.RemoveAll(logDir)
+	}
+
+	profiles := filepath.Join(dir, "profiles.yaml")
+	if err := ioutil.WriteFile(profiles,
+		[]byte("profiles:\n  team:\n    provider: aws\n    region: eu-west-1\n"), 0600); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	os.Setenv(profile.PathEnv, profiles)
+	defer os.Unsetenv(profile.PathEnv)
+
+	defer func() {
+		simulate, providerName, region, zone, resumedRunID = false, "gcp", "us-central1", "a", ""
+		activeProfile = profile.Profile{}
+		useTestFetcher(t)()
+	}()
+
+	records := []controller.JournalRecord{
+		{Event: controller.JournalInvocation, Args: []string{"create", "image", "--profile", "team", "--simulate"}},
+		{Event: controller.JournalStarted, ThingID: "image/missing", Action: "image.buildImage", From: "Nothing",
+			To: "Built"},
+	}
+
+	output, err := captureOutput(t, func() error {
+		sub, err := prepareResume("run", records, []string{"--zone", "b"})
+		if err == nil && sub != createCommand {
+			err = fmt.Errorf("wrong command is resumed: %v", sub)
+		}
+
+		return err
+	})
+	if err != nil {
+		t.Fatalf("prepareResume function returned error: [%s]", err)
+	}
+
+	if !strings.Contains(output, "image/missing: no stored state") {
+		t.Errorf("interrupted transition is not reported: [%s]", output)
+	}
+
+	if !simulate || resumedRunID != "run" {
+		t.Errorf("global flags of the invocation are not applied: simulate %t, run %s", simulate, resumedRunID)
+	}
+
+	if providerName != "aws" || region != "eu-west-1" || activeProfile.Region != "eu-west-1" {
+		t.Errorf("profile of the invocation is not applied: provider %s, region %s", providerName, region)
+	}
+
+	if zone != "b" {
+		t.Errorf("added flags are not applied: zone %s", zone)
+	}
+
+	finished := append(records, controller.JournalRecord{Event: controller.JournalFinished})
+
+	if _, err := captureOutput(t, func() error {
+		sub, err := prepareResume("run", finished, nil)
+		if err == nil && sub != nil {
+			err = fmt.Errorf("finished run is resumed by %v", sub)
+		}
+
+		return err
+	}); err != nil {
+		t.Errorf("prepareResume function returned error: [%s]", err)
+	}
+}
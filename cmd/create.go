@@ -7,66 +7,62 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"enzyme/pkg/config"
 	"enzyme/pkg/controller"
 	"enzyme/pkg/entities/cluster"
 	"enzyme/pkg/entities/image"
 	"enzyme/pkg/entities/storage"
+	"enzyme/pkg/provider"
 )
 
 var (
 	validCreateTargets []string = []string{imageTargetObject, clusterTargetObject, storageTargetObject}
 
+	// createdStatuses are the statuses the create command brings objects to
+	createdStatuses = map[string]controller.Status{
+		imageTargetObject:   image.Created,
+		clusterTargetObject: cluster.Spawned,
+		storageTargetObject: storage.Detached,
+	}
+
+	// createdObjects are the objects the create command may use, the object itself goes first
+	createdObjects = map[string][]string{
+		imageTargetObject:   {imageTargetObject},
+		clusterTargetObject: {clusterTargetObject, imageTargetObject},
+		storageTargetObject: {storageTargetObject, imageTargetObject},
+	}
+
 	createCommand = &cobra.Command{
-		Use:   fmt.Sprintf("create {%s}", strings.Join(validCreateTargets, ", ")),
+		Use:   fmt.Sprintf("create {%s}[=parameters-file] ...", strings.Join(validCreateTargets, ", ")),
 		Short: fmt.Sprintf("creates the {%s} in the public cloud", strings.Join(validCreateTargets, ", ")),
 		Long: `This command tells enzyme to create a VM image, to spawn VM instances forming
-a cluster or to create VM instance based on a disk that holds your data.`,
+a cluster or to create VM instance based on a disk that holds your data.
+
+Several objects can be created at once, common prerequisites like the image are created
+only once and independent objects are created in parallel. Each object can have its own
+parameters file given after "=", otherwise the one from --parameters flag is used, e.g.
+"enzyme create cluster=first.json cluster=second.json storage".`,
 		ValidArgs: validCreateTargets,
-		Args:      cobra.ExactValidArgs(1),
+		Args:      validateCreateArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			config, prov, serviceParams, err := createArgs()
-			if err != nil {
-				log.Fatal()
+			targets := []controller.Target{}
+
+			for _, arg := range args {
+				creatingObject, objectParameters := splitCreateArg(arg)
+
+				targets = append(targets, makeCreateTarget(creatingObject, objectParameters))
 			}
 
-			creatingObject := args[0]
-
-			var thing controller.Thing
-			var desired controller.Status
-			logger := log.WithFields(log.Fields{
-				"providerName":    providerName,
-				"credentialsFile": credentialsFile,
-				"region":          region,
-				"parametersFile":  parametersFile,
-				"creatingObject":  creatingObject,
-			})
-
-			switch creatingObject {
-			case imageTargetObject:
-				if thing, err = image.CreateImageTarget(prov, config, serviceParams, fetcher); err != nil {
-					logger.Fatalf("createCommand: cannot create image thing: %s", err)
-				}
-				desired = image.Created
-			case clusterTargetObject:
-				if thing, err = cluster.CreateClusterTarget(prov, config, serviceParams, fetcher); err != nil {
-					logger.Fatalf("createCommand: cannot create cluster thing: %s", err)
-				}
-				desired = cluster.Spawned
-			case storageTargetObject:
-				if thing, err = storage.CreateStorageTarget(prov, config, serviceParams, fetcher); err != nil {
-					logger.Fatalf("createCommand: cannot create storage node thing: %s", err)
-				}
-				desired = storage.Detached
-			default:
-				logger.Fatal("this object cannot be created")
+			results, err := reachTargets(targets)
+			if len(targets) > 1 {
+				printTargetResults(results)
 			}
 
-			if err := controller.ReachTarget(thing, desired, simulate); err != nil {
-				logger.WithFields(log.Fields{
-					"thing":          thing,
-					"desired-status": desired,
-					"simulate":       simulate,
-				}).Fatalf("createCommand: cannot make thing reach desired status: %s", err)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"targets":  targets,
+					"simulate": simulate,
+				}).Fatalf("createCommand: cannot make things reach desired statuses: %s", err)
 			}
 		},
 	}
@@ -75,4 +71,80 @@ a cluster or to create VM instance based on a disk that holds your data.`,
 func init() {
 	rootCmd.AddCommand(createCommand)
 	addServiceParams(createCommand)
+	addExecParams(createCommand)
+}
+
+// splitCreateArg splits "object=parameters-file" argument, parameters file defaults to --parameters
+func splitCreateArg(arg string) (string, string) {
+	if idx := strings.Index(arg, "="); idx >= 0 {
+		return arg[:idx], arg[idx+1:]
+	}
+
+	return arg, parametersFile
+}
+
+func validateCreateArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		creatingObject, _ := splitCreateArg(arg)
+		if err := cobra.OnlyValidArgs(cmd, []string{creatingObject}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func makeCreateTarget(creatingObject string, objectParameters string) controller.Target {
+	userVariables, prov, serviceParams, err := createArgsFor(objectParameters)
+	if err != nil {
+		log.Fatal()
+	}
+
+	logger := log.WithFields(log.Fields{
+		"providerName":    providerName,
+		"credentialsFile": credentialsFile,
+		"region":          region,
+		"parametersFile":  objectParameters,
+		"creatingObject":  creatingObject,
+	})
+
+	if err := checkChangedVariables(createdObjects[creatingObject], userVariables, prov, serviceParams); err != nil {
+		logger.Fatalf("createCommand: %s", err)
+	}
+
+	thing, err := createThing(creatingObject, prov, userVariables, serviceParams)
+	if err != nil {
+		logger.Fatalf("createCommand: cannot create %s thing: %s", creatingObject, err)
+	}
+
+	return controller.Target{Thing: thing, DesiredStatus: createdStatuses[creatingObject]}
+}
+
+// createThing makes the thing of the object, its stored state is loaded if there is one
+func createThing(object string, prov provider.Provider, userVariables config.Config,
+	serviceParams config.ServiceParams) (controller.Thing, error) {
+	switch object {
+	case imageTargetObject:
+		return image.CreateImageTarget(prov, userVariables, serviceParams, fetcher)
+	case clusterTargetObject:
+		return cluster.CreateClusterTarget(prov, userVariables, serviceParams, fetcher)
+	case storageTargetObject:
+		return storage.CreateStorageTarget(prov, userVariables, serviceParams, fetcher)
+	}
+
+	return nil, fmt.Errorf("%s cannot be created", object)
+}
+
+func printTargetResults(results []controller.TargetResult) {
+	for _, result := range results {
+		if result.Err == nil {
+			fmt.Printf("Reached: %s\n", result.Target.Thing)
+		} else {
+			fmt.Printf("Not reached: %s: %s\n", result.Target.Thing, result.Err)
+		}
+	}
 }
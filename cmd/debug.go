@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/entities/cluster"
+	"enzyme/pkg/entities/image"
+	"enzyme/pkg/entities/runtask"
+	"enzyme/pkg/entities/storage"
+)
+
+var (
+	statusGraphs = map[string]func() (controller.Thing, []controller.Status){
+		imageTargetObject:   image.StatusGraph,
+		clusterTargetObject: cluster.StatusGraph,
+		storageTargetObject: storage.StatusGraph,
+		taskTargetObject:    runtask.StatusGraph,
+	}
+
+	debugCommand = &cobra.Command{
+		Use:    "debug",
+		Short:  "tools for enzyme developers",
+		Hidden: true,
+	}
+
+	debugGraphCommand = &cobra.Command{
+		Use:       fmt.Sprintf("graph {%s}", strings.Join(validPrintTargets, ", ")),
+		Short:     "prints and validates the status graph of the object kind",
+		ValidArgs: validPrintTargets,
+		Args:      cobra.ExactValidArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !debugGraph(args[0]) {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(debugCommand)
+	debugCommand.AddCommand(debugGraphCommand)
+}
+
+// debugGraph prints transitions of the object kind with their actions and problems found
+// in the graph, returns false if there are problems
+func debugGraph(kind string) bool {
+	thing, statuses := statusGraphs[kind]()
+
+	edges, err := controller.StatusGraph(thing, statuses)
+	if err != nil {
+		fmt.Printf("cannot get status graph of %s: %s\n", kind, err)
+		return false
+	}
+
+	for _, edge := range edges {
+		action := edge.Action
+		if action == "" {
+			action = "<no action>"
+		}
+
+		fmt.Printf("%s -> %s: %s\n", edge.From, edge.To, action)
+	}
+
+	problems := controller.ValidateGraph(thing, statuses)
+	for _, problem := range problems {
+		fmt.Printf("problem: %s\n", problem)
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("status graph of %s is valid\n", kind)
+	}
+
+	return len(problems) == 0
+}
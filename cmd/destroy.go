@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -27,14 +28,14 @@ func init() {
 	rootCmd.AddCommand(destroyCommand)
 }
 
-// Destructible interface should be implemented for an object that should be
-// destroyed via enzyme's destroy command
-type Destructible interface {
-	GetDestroyedTarget() controller.Target
+func destroy(args []string) {
+	if err := destroyObject(args[0]); err != nil {
+		log.WithField("target-id", args[0]).Fatalf("destroy: %s", err)
+	}
 }
 
-func destroy(args []string) {
-	destroyObjectID := args[0]
+// destroyObject brings the object stored by the id to its destroyed status
+func destroyObject(destroyObjectID string) error {
 	candidates := []state.Entry{}
 
 	if err := fetcher.Enumerate(
@@ -44,53 +45,57 @@ func destroy(args []string) {
 			candidates = append(candidates, entry)
 			return nil
 		}); err != nil {
-		log.WithField("destroyObjectID", destroyObjectID).Fatalf("destroy: Enumerate failed: %s", err)
+		log.WithField("destroyObjectID", destroyObjectID).Errorf("destroyObject: Enumerate failed: %s", err)
+
+		return err
 	}
 
-	msg := ""
 	fields := log.Fields{
 		"target-id": destroyObjectID,
 	}
 
 	switch {
 	case len(candidates) == 0:
-		msg = "destroy: cannot find an object by id"
+		return errors.New("cannot find an object by id")
 	case len(candidates) > 1:
 		foundObjs := []string{}
 		for _, candidate := range candidates {
 			foundObjs = append(foundObjs, fmt.Sprintf("%s", candidate))
 		}
 
-		fields["found-objects"] = strings.Join(foundObjs, ", ")
-		msg = "destroy: too many matching objects found"
-	default:
-		fields["found-object"] = candidates[0]
-
-		if destruct, ok := candidates[0].(Destructible); !ok {
-			msg = "destroy: found object is not destructible"
-		} else {
-			if thing, ok := destruct.(controller.Thing); !ok {
-				msg = "destroy: found object is not controllable"
-			} else {
-				destroyedTarget := destruct.GetDestroyedTarget()
-				fields["desired-status"] = destroyedTarget.DesiredStatus
-				if thing.Status().Equals(destroyedTarget.DesiredStatus) {
-					log.WithFields(fields).Info("destroy: object already destroyed")
-					fmt.Printf("destroy: already destroyed: %s\n", candidates[0])
-
-					return
-				}
-				if err := controller.ReachTargetEx(destroyedTarget, simulate); err != nil {
-					msg = fmt.Sprintf("destroy: cannot destroy found object: %s", err)
-				} else {
-					log.WithFields(fields).Info("destroy: successfully destroyed object")
-					fmt.Printf("destroy: successfully destroyed object: %s\n", candidates[0])
-
-					return
-				}
-			}
-		}
+		return fmt.Errorf("too many matching objects found: %s", strings.Join(foundObjs, ", "))
+	}
+
+	fields["found-object"] = candidates[0]
+
+	destruct, ok := candidates[0].(controller.Destructible)
+	if !ok {
+		return errors.New("found object is not destructible")
+	}
+
+	thing, ok := destruct.(controller.Thing)
+	if !ok {
+		return errors.New("found object is not controllable")
+	}
+
+	destroyedTarget := destruct.GetDestroyedTarget()
+	fields["desired-status"] = destroyedTarget.DesiredStatus
+
+	if thing.Status().Equals(destroyedTarget.DesiredStatus) {
+		log.WithFields(fields).Info("destroyObject: object already destroyed")
+		fmt.Printf("destroy: already destroyed: %s\n", candidates[0])
+
+		return nil
 	}
 
-	log.WithFields(fields).Fatal(msg)
+	if err := reachTarget(destroyedTarget); err != nil {
+		log.WithFields(fields).Errorf("destroyObject: cannot destroy found object: %s", err)
+
+		return fmt.Errorf("cannot destroy found object: %w", err)
+	}
+
+	log.WithFields(fields).Info("destroyObject: successfully destroyed object")
+	fmt.Printf("destroy: successfully destroyed object: %s\n", candidates[0])
+
+	return nil
 }
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/config"
+	"enzyme/pkg/state"
+)
+
+var (
+	diffCommand = &cobra.Command{
+		Use:   "diff [objectID]",
+		Short: "Print differences of user variables the object was made with and the given ones",
+		Long: `This command compares user variables stored for the object with the ones given by parameters
+as "create" would do. Commands using an existing object made with other variables refuse to run
+unless --replace or --adopt-new-vars is given, this command shows what has changed beforehand.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := diffObject(args[0]); err != nil {
+				log.WithField("id", args[0]).Fatalf("diffCommand: %s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(diffCommand)
+	addServiceParams(diffCommand)
+}
+
+func diffObject(id string) error {
+	userVariables, prov, serviceParams, err := createArgs()
+	if err != nil {
+		return err
+	}
+
+	serviceParams.ChangedVariables = config.ReportChangedVariables
+
+	found := false
+	if err := fetcher.Enumerate(
+		func(candidate string) bool {
+			return candidate == id
+		}, func(string, state.Entry) error {
+			found = true
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	if !found {
+		return errors.New("cannot find an object by id")
+	}
+
+	object := strings.SplitN(id, "/", 2)[0]
+	if err := checkChoice("kind of the object", object, validCreateTargets); err != nil {
+		return err
+	}
+
+	thing, err := createThing(object, prov, userVariables, serviceParams)
+
+	var describedID string
+
+	var changedErr *state.ChangedVariablesError
+	if errors.As(err, &changedErr) {
+		describedID = changedErr.ID
+	} else if err != nil {
+		return err
+	} else if entry, ok := thing.(state.Entry); ok {
+		hierarchy, err := entry.Hierarchy()
+		if err != nil {
+			return err
+		}
+
+		describedID = strings.Join(hierarchy, "/")
+	}
+
+	if describedID != id {
+		return fmt.Errorf("parameters describe %s, not %s", describedID, id)
+	}
+
+	if changedErr != nil {
+		fmt.Print(changedErr.Describe())
+		return nil
+	}
+
+	fmt.Printf("%s: no differences\n", id)
+
+	return nil
+}
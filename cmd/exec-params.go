@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/config"
+	"enzyme/pkg/controller"
+	"enzyme/pkg/entities/common"
+)
+
+const (
+	progressConsole = "console"
+	progressJSON    = "json"
+
+	// actionTimeoutsKey is the section of parameters file overriding timeouts of actions,
+	// e.g. {"action_timeouts": {"image.buildImage": "3h"}}; it is not passed to templates
+	actionTimeoutsKey = "action_timeouts"
+)
+
+var (
+	validProgressFormats = []string{progressConsole, progressJSON}
+
+	deadline       time.Duration
+	optimizeFor    = controller.CostByTime.String()
+	onFailure      = controller.KeepOnFailure.String()
+	maxParallel    int
+	resourceLimits map[string]int
+	// replaceChanged destroys existing objects made with other user variables to create them anew
+	replaceChanged bool
+	// adoptNewVars keeps existing objects made with other user variables and records the new ones for them
+	adoptNewVars bool
+)
+
+func addExecParams(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&deadline, "deadline", 0,
+		"maximum duration of the whole execution, e.g. '2h30m'; no limit by default")
+	cmd.Flags().StringVar(&optimizeFor, "optimize", optimizeFor,
+		fmt.Sprintf("when things can be brought to desired status in several ways, choose the cheapest by {%s, %s}",
+			controller.CostByTime, controller.CostByMoney))
+	cmd.Flags().StringVar(&onFailure, "on-failure", onFailure,
+		fmt.Sprintf("what to do with objects changed by the run if it fails: {%s, %s, %s}",
+			controller.KeepOnFailure, controller.RollbackOnFailure, controller.DestroyCreatedOnFailure))
+	cmd.Flags().IntVar(&maxParallel, "max-parallel", 0,
+		"maximum number of actions running at once; no limit by default")
+	cmd.Flags().StringToIntVar(&resourceLimits, "resource-limits", nil,
+		fmt.Sprintf("maximum number of running actions using the resource, e.g. '%s=2,%s=1'; resources are {%s}",
+			common.TerraformResource, common.PackerResource,
+			strings.Join([]string{common.TerraformResource, common.PackerResource, common.SSHResource}, ", ")))
+	cmd.Flags().BoolVar(&replaceChanged, "replace", false,
+		"destroy existing objects made with other user variables and create them anew")
+	cmd.Flags().BoolVar(&adoptNewVars, "adopt-new-vars", false,
+		"keep existing objects made with other user variables and record the new variables for them")
+}
+
+// actionKinds returns sorted kinds of actions of all objects enzyme manages
+func actionKinds() ([]string, error) {
+	known := map[string]bool{}
+
+	for _, object := range validPrintTargets {
+		thing, statuses := statusGraphs[object]()
+
+		edges, err := controller.StatusGraph(thing, statuses)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, edge := range edges {
+			if edge.Action != "" {
+				known[edge.Action] = true
+			}
+		}
+	}
+
+	kinds := make([]string, 0, len(known))
+	for kind := range known {
+		kinds = append(kinds, kind)
+	}
+
+	sort.Strings(kinds)
+
+	return kinds, nil
+}
+
+// flattenTimeouts collects durations from the section, nested sections appear
+// when kinds of actions (containing dots) are parsed as nested keys
+func flattenTimeouts(prefix string, section map[string]interface{}, result map[string]time.Duration) error {
+	for key, value := range section {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch casted := value.(type) {
+		case map[string]interface{}:
+			if err := flattenTimeouts(key, casted, result); err != nil {
+				return err
+			}
+		case string:
+			timeout, err := time.ParseDuration(casted)
+			if err != nil {
+				return fmt.Errorf("wrong timeout of %s: %w", key, err)
+			}
+
+			result[key] = timeout
+		default:
+			return fmt.Errorf("wrong timeout of %s: expected duration string like '1h', got %v", key, value)
+		}
+	}
+
+	return nil
+}
+
+// extractActionTimeouts reads timeouts of actions from user variables and removes them from there
+func extractActionTimeouts(userVariables config.Config) (map[string]time.Duration, error) {
+	result := map[string]time.Duration{}
+
+	if !userVariables.IsSet(actionTimeoutsKey) {
+		return result, nil
+	}
+
+	section, err := userVariables.GetStringMap(actionTimeoutsKey)
+	if err != nil {
+		log.WithField("key", actionTimeoutsKey).Errorf("extractActionTimeouts: cannot read section: %s", err)
+		return nil, err
+	}
+
+	if err := flattenTimeouts("", section, result); err != nil {
+		log.WithField("key", actionTimeoutsKey).Errorf("extractActionTimeouts: %s", err)
+		return nil, err
+	}
+
+	kinds, err := actionKinds()
+	if err != nil {
+		log.WithField("key", actionTimeoutsKey).Errorf("extractActionTimeouts: cannot list kinds of actions: %s", err)
+		return nil, err
+	}
+
+	for kind := range result {
+		if idx := sort.SearchStrings(kinds, kind); idx == len(kinds) || kinds[idx] != kind {
+			err := fmt.Errorf("unknown kind of action %s, expected one of {%s}", kind, strings.Join(kinds, ", "))
+			log.WithField("key", actionTimeoutsKey).Errorf("extractActionTimeouts: %s", err)
+
+			return nil, err
+		}
+	}
+
+	if err := userVariables.DeleteKey(actionTimeoutsKey); err != nil {
+		return nil, err
+	}
+
+	log.WithField("timeouts", result).Info("extractActionTimeouts: read timeouts of actions")
+
+	return result, nil
+}
+
+// newObservers creates observers reporting progress in the format requested from command line,
+// nothing is reported when the plan is printed instead
+func newObservers(plan *controller.Plan) ([]controller.Observer, error) {
+	if plan != nil {
+		return nil, nil
+	}
+
+	switch progress {
+	case progressConsole:
+		return []controller.Observer{controller.NewConsoleObserver(os.Stdout)}, nil
+	case progressJSON:
+		return []controller.Observer{controller.NewJSONObserver(os.Stdout)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown progress format %q, supported formats are {%s}",
+		progress, strings.Join(validProgressFormats, ", "))
+}
+
+// executionDeadline returns the time by which execution must be done or zero time if there is no limit
+func executionDeadline() time.Time {
+	if deadline <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(deadline)
+}
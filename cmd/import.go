@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/entities/cluster"
+	"enzyme/pkg/entities/image"
+	"enzyme/pkg/entities/storage"
+)
+
+// Importer is a Thing companion interface which can adopt resources existing in the cloud
+type Importer interface {
+	Import(ctx context.Context, cloudID string, ids map[string]string) error
+}
+
+var (
+	importIDs map[string]string
+
+	// importNameVariables are the variables naming imported objects, they are set to cloud-id unless given
+	importNameVariables = map[string]string{
+		imageTargetObject:   "image_name",
+		clusterTargetObject: "cluster_name",
+		storageTargetObject: "storage_name",
+	}
+
+	importCommand = &cobra.Command{
+		Use:   fmt.Sprintf("import {%s} [cloud-id]", strings.Join(validCreateTargets, ", ")),
+		Short: "Adopt objects created in the cloud without enzyme",
+		Long: `This command makes enzyme manage an image, a cluster or a storage created by hand or by other tools.
+The configuration of the object is made as by "create" command, then its resources are found in the cloud
+by cloud-id, which is the name of the object for gcp, and imported into its terraform state. Resources the
+provider cannot find by cloud-id are given by --resource flag as terraform address and resource ID.
+
+The object is ready to use if its resources match the configuration. Otherwise it stays configured and
+"create" applies the configuration to the imported resources.`,
+		ValidArgs: validCreateTargets,
+		Args:      validateImportArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := importObject(args[0], args[1]); err != nil {
+				log.WithFields(log.Fields{
+					"object":   args[0],
+					"cloud-id": args[1],
+				}).Fatalf("importCommand: %s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(importCommand)
+	addServiceParams(importCommand)
+	addExecParams(importCommand)
+
+	importCommand.Flags().StringToStringVar(&importIDs, "resource", nil,
+		"IDs of resources by their terraform addresses, e.g. 'module.aws_provider.aws_vpc.cluster=vpc-1234'")
+}
+
+func validateImportArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+		return err
+	}
+
+	return cobra.OnlyValidArgs(cmd, args[:1])
+}
+
+func importObject(object, cloudID string) error {
+	userVariables, prov, serviceParams, err := createArgs()
+	if err != nil {
+		return err
+	}
+
+	if _, err := userVariables.GetString(importNameVariables[object]); err != nil {
+		userVariables.SetValue(importNameVariables[object], cloudID)
+	}
+
+	if err := checkChangedVariables([]string{object}, userVariables, prov, serviceParams); err != nil {
+		return err
+	}
+
+	var (
+		thing      controller.Thing
+		configured controller.Status
+	)
+
+	switch object {
+	case imageTargetObject:
+		thing, err = image.CreateImageTarget(prov, userVariables, serviceParams, fetcher)
+		configured = image.Configured
+	case clusterTargetObject:
+		thing, err = cluster.CreateClusterTarget(prov, userVariables, serviceParams, fetcher)
+		configured = cluster.Configured
+	case storageTargetObject:
+		thing, err = storage.CreateStorageTarget(prov, userVariables, serviceParams, fetcher)
+		configured = storage.Configured
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !configured.Satisfies(thing.Status()) {
+		return fmt.Errorf("%s is already managed by enzyme", thing)
+	}
+
+	importer, ok := thing.(Importer)
+	if !ok {
+		return fmt.Errorf("%s cannot be imported", thing)
+	}
+
+	if err := reachTarget(controller.Target{Thing: thing, DesiredStatus: configured}); err != nil {
+		return err
+	}
+
+	if simulate {
+		fmt.Printf("Simulating, resources of %s are not imported\n", thing)
+		return nil
+	}
+
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	if lockable, ok := thing.(controller.Lockable); ok {
+		unlock, err := lockable.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if err := importer.Import(ctx, cloudID, importIDs); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported: %s\n", thing)
+
+	if thing.Status().Equals(configured) {
+		fmt.Printf("Imported resources differ from the configuration, 'enzyme create %s' applies it to them, "+
+			"see the plan in the terraform log\n", object)
+	}
+
+	return nil
+}
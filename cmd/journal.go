@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/storage"
+)
+
+const (
+	journalCategory = "journal"
+	journalExt      = ".jsonl"
+	runIDLayout     = "2006-01-02-15-04-05"
+)
+
+var (
+	// resumedRunID is set when current invocation continues an interrupted run
+	resumedRunID string
+)
+
+func journalPath(runID string) string {
+	return storage.MakeStorageFilename(journalCategory, []string{runID}, journalExt)
+}
+
+func newRunID() string {
+	return fmt.Sprintf("%s-%d", time.Now().Format(runIDLayout), os.Getpid())
+}
+
+// openJournal starts a journal for current invocation or re-opens the one being resumed,
+// journal is not kept when simulating; failing to open a journal is not fatal
+func openJournal() *controller.Journal {
+	if simulate {
+		return nil
+	}
+
+	runID := resumedRunID
+	if runID == "" {
+		runID = newRunID()
+	}
+
+	path := journalPath(runID)
+	if err := storage.CreateDirForFile(path); err != nil {
+		log.WithField("path", path).Warnf("openJournal: cannot create journal directory: %s", err)
+		return nil
+	}
+
+	journal, err := controller.OpenJournal(runID, path)
+	if err != nil {
+		log.WithField("path", path).Warnf("openJournal: cannot open journal, run won't be resumable: %s", err)
+		return nil
+	}
+
+	if resumedRunID == "" {
+		journal.RecordInvocation(os.Args[1:])
+		fmt.Printf("Run ID: %s\n", runID)
+	} else {
+		journal.RecordResumed()
+	}
+
+	return journal
+}
+
+// reachTarget runs the executor towards the target with options composed from command line
+func reachTarget(target controller.Target) error {
+	_, err := reachTargets([]controller.Target{target})
+
+	return err
+}
+
+// reachTargets runs the executor towards all targets at once
+func reachTargets(targets []controller.Target) ([]controller.TargetResult, error) {
+	plan, err := newPlan()
+	if err != nil {
+		return nil, err
+	}
+
+	observers, err := newObservers(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	costMetric, err := controller.ParseCostMetric(optimizeFor)
+	if err != nil {
+		return nil, err
+	}
+
+	failurePolicy, err := controller.ParseFailurePolicy(onFailure)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := openJournal()
+	defer journal.Close()
+
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	results, err := controller.ReachTargets(ctx, targets, controller.ExecOptions{
+		Simulate:       simulate,
+		Observers:      observers,
+		Journal:        journal,
+		Plan:           plan,
+		Deadline:       executionDeadline(),
+		CostMetric:     costMetric,
+		OnFailure:      failurePolicy,
+		MaxParallel:    maxParallel,
+		ResourceLimits: resourceLimits,
+	})
+	if err != nil && journal != nil {
+		fmt.Printf("Run %s failed, continue it by 'enzyme resume %s'\n", journal.RunID, journal.RunID)
+	}
+
+	if err == nil {
+		err = writePlan(plan)
+	}
+
+	return results, err
+}
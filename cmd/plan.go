@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/controller"
+)
+
+const (
+	planFormatDOT  = "dot"
+	planFormatJSON = "json"
+)
+
+var (
+	validPlanFormats = []string{planFormatDOT, planFormatJSON}
+
+	planCommand = &cobra.Command{
+		Use:   "plan {create, run, destroy} ...",
+		Short: "prints the execution plan of a command without performing it",
+		Long: fmt.Sprintf(`This command simulates the given enzyme command and prints everything it would do:
+things involved, all status chains and the chosen one, actions with their prerequisites
+and groups of actions that would run in parallel.
+
+Example: "enzyme plan create cluster --parameters params.json --plan-format=json"
+The plan is printed in DOT format by default, supported formats are {%s}.`, strings.Join(validPlanFormats, ", ")),
+		Args:               cobra.MinimumNArgs(1),
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			sub, err := parseSubcommand(args)
+			if err != nil {
+				log.WithField("args", args).Fatalf("planCommand: cannot parse the command: %s", err)
+			}
+
+			simulate = true
+			if planFormat == "" {
+				planFormat = planFormatDOT
+			}
+
+			// global flags given to the planned command are known only now
+			prepare(sub, sub.Flags().Args())
+
+			if err := runParsedSubcommand(sub); err != nil {
+				log.WithField("args", args).Fatalf("planCommand: cannot simulate the command: %s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(planCommand)
+}
+
+// newPlan creates a plan to collect if it was requested from command line
+func newPlan() (*controller.Plan, error) {
+	if planFormat == "" {
+		return nil, nil
+	}
+
+	if !simulate {
+		return nil, fmt.Errorf("plan can be printed only when simulating, add --simulate flag")
+	}
+
+	for _, format := range validPlanFormats {
+		if planFormat == format {
+			return controller.NewPlan(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown plan format %q, supported formats are {%s}",
+		planFormat, strings.Join(validPlanFormats, ", "))
+}
+
+func writePlan(plan *controller.Plan) error {
+	switch {
+	case plan == nil:
+		return nil
+	case planFormat == planFormatJSON:
+		return plan.WriteJSON(os.Stdout)
+	default:
+		return plan.WriteDOT(os.Stdout)
+	}
+}
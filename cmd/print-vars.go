@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"enzyme/pkg/config"
 	"enzyme/pkg/provider"
 )
 
@@ -56,6 +58,13 @@ func printVars(args []string) {
 
 	var err error
 
+	schema, err := provider.GetVariablesSchema(targetProvider)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"targetProvider": targetProvider,
+		}).Fatalf("printVarsCommand: %s", err)
+	}
+
 	for _, targetObject := range args {
 		switch targetObject {
 		case imageTargetObject:
@@ -94,14 +103,33 @@ func printVars(args []string) {
 			}).Fatal("variables for the object cannot be printed")
 		}
 
-		printVariables(targetObject, variables)
+		printVariables(targetObject, variables, schema)
 	}
 }
 
-func printVariables(targetObject string, vars map[string]interface{}) {
+func printVariables(targetObject string, vars map[string]interface{}, schema config.Schema) {
 	fmt.Println(targetObject + ":")
 
-	for key, value := range vars {
-		fmt.Printf("\t%-25s: %s\n", key, value)
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		variable := schema[key]
+
+		fmt.Printf("\t%-25s %-7s = %-22v %s", key, variable.Type, vars[key], variable.Description)
+
+		if variable.Required {
+			fmt.Print(" (required)")
+		}
+
+		if len(variable.Allowed) != 0 {
+			fmt.Printf(" {%s}", strings.Join(variable.Allowed, ", "))
+		}
+
+		fmt.Println()
 	}
 }
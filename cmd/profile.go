@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"enzyme/pkg/profile"
+	"enzyme/pkg/provider"
+)
+
+var (
+	profileName string
+	// activeProfile is the profile given by --profile or the current one, empty if there is none
+	activeProfile profile.Profile
+
+	newProfile     profile.Profile
+	replaceProfile bool
+	noProfile      bool
+
+	profileCmd = &cobra.Command{
+		Use:   "profile",
+		Short: "Manage profiles bundling provider, region, zone, credentials and parameters",
+		Long: fmt.Sprintf(`Profiles keep settings repeated by every command. A profile is used by --profile
+or made the current one by 'enzyme profile use'. Flags given in the command line beat --vars,
+--vars beat the --parameters file, the --parameters file beats the profile, and the profile beats
+defaults of templates and flags.
+
+Profiles are kept in enzyme/profiles.yaml in the user config folder like ~/.config,
+%s environment variable overrides the path.`, profile.PathEnv),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				log.Fatalf("cmd.Help function failed: %s", err)
+			}
+		},
+	}
+
+	profileListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List profiles, the current one is marked by *",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			profiles := loadProfiles()
+
+			for _, name := range profiles.Names() {
+				mark := " "
+				if name == profiles.Current {
+					mark = "*"
+				}
+
+				fmt.Printf("%s %s\n", mark, name)
+			}
+		},
+	}
+
+	profileShowCmd = &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show the profile, the current one by default",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := ""
+			if len(args) != 0 {
+				name = args[0]
+			}
+
+			name, shown, err := loadProfiles().Get(name)
+			if err != nil {
+				log.Fatalf("profileShowCmd: %s", err)
+			}
+
+			if name == "" {
+				log.Fatalf("profileShowCmd: there is no current profile, see 'enzyme profile use'")
+			}
+
+			content, err := yaml.Marshal(map[string]profile.Profile{name: shown})
+			if err != nil {
+				log.Fatalf("profileShowCmd: %s", err)
+			}
+
+			fmt.Print(string(content))
+		},
+	}
+
+	profileAddCmd = &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add the profile given by flags",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := addProfile(args[0]); err != nil {
+				log.Fatalf("profileAddCmd: %s", err)
+			}
+		},
+	}
+
+	profileRemoveCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove the profile",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			profiles := loadProfiles()
+
+			if err := profiles.Remove(args[0]); err != nil {
+				log.Fatalf("profileRemoveCmd: %s", err)
+			}
+
+			saveProfiles(profiles)
+		},
+	}
+
+	profileUseCmd = &cobra.Command{
+		Use:   "use <name>",
+		Short: "Make the profile the current one, used when --profile isn't given",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if noProfile {
+				return cobra.ExactArgs(0)(cmd, args)
+			}
+
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			profiles := loadProfiles()
+
+			name := ""
+			if !noProfile {
+				name = args[0]
+			}
+
+			if err := profiles.Use(name); err != nil {
+				log.Fatalf("profileUseCmd: %s", err)
+			}
+
+			saveProfiles(profiles)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd, profileShowCmd, profileAddCmd, profileRemoveCmd, profileUseCmd)
+
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "",
+		"profile giving provider, region, zone, credentials and parameters, the current profile by default")
+
+	profileAddCmd.Flags().StringVarP(&newProfile.Provider, "provider", "p", "", "public CSP: {gcp, aws}")
+	profileAddCmd.Flags().StringVarP(&newProfile.Region, "region", "r", "", "public CSP region")
+	profileAddCmd.Flags().StringVarP(&newProfile.Zone, "zone", "z", "", "public CSP zone")
+	profileAddCmd.Flags().StringVarP(&newProfile.Credentials, "credentials", "c", "", "path to credentials file")
+	profileAddCmd.Flags().StringSliceVar(&newProfile.Parameters, "parameters", nil,
+		"files with parameters, later files override earlier ones")
+	profileAddCmd.Flags().StringToStringVar(&newProfile.Vars, "vars", nil,
+		"list of user's variables; for example, 'image_name=enzyme,disk_size=30'")
+	profileAddCmd.Flags().BoolVar(&replaceProfile, "replace", false, "replace the existing profile")
+
+	profileUseCmd.Flags().BoolVar(&noProfile, "none", false, "use no profile by default")
+}
+
+func profilesPath() string {
+	path, err := profile.DefaultPath()
+	if err != nil {
+		log.Fatalf("profilesPath: %s", err)
+	}
+
+	return path
+}
+
+func loadProfiles() *profile.Profiles {
+	profiles, err := profile.Load(profilesPath())
+	if err != nil {
+		log.Fatalf("loadProfiles: %s", err)
+	}
+
+	return profiles
+}
+
+func saveProfiles(profiles *profile.Profiles) {
+	if err := profiles.Save(profilesPath()); err != nil {
+		log.Fatalf("saveProfiles: %s", err)
+	}
+}
+
+// addProfile adds the profile given by flags, paths are kept absolute
+// so the profile can be used from any folder
+func addProfile(name string) error {
+	if newProfile.Provider != "" && !provider.IsProviderSupported(newProfile.Provider) {
+		return fmt.Errorf("provider %s is not supported", newProfile.Provider)
+	}
+
+	var err error
+
+	if newProfile.Credentials != "" {
+		if newProfile.Credentials, err = filepath.Abs(newProfile.Credentials); err != nil {
+			return err
+		}
+	}
+
+	for idx, parameters := range newProfile.Parameters {
+		if newProfile.Parameters[idx], err = filepath.Abs(parameters); err != nil {
+			return err
+		}
+	}
+
+	profiles := loadProfiles()
+
+	if err := profiles.Add(name, newProfile, replaceProfile); err != nil {
+		return err
+	}
+
+	if len(profiles.Profiles) == 1 && profiles.Current == "" {
+		profiles.Current = name
+		fmt.Printf("%s is the current profile\n", name)
+	}
+
+	saveProfiles(profiles)
+
+	return nil
+}
+
+// applyProfile reads the profile given by --profile or the current one, its settings are used
+// for flags of the command which aren't given in the command line
+func applyProfile(cmd *cobra.Command) error {
+	profiles, err := profile.Load(profilesPath())
+	if err != nil {
+		return err
+	}
+
+	name, used, err := profiles.Get(profileName)
+	if err != nil || name == "" {
+		return err
+	}
+
+	for flagName, value := range map[string]string{
+		"provider":    used.Provider,
+		"region":      used.Region,
+		"zone":        used.Zone,
+		"credentials": used.Credentials,
+	} {
+		flag := cmd.Flags().Lookup(flagName)
+		if flag == nil || flag.Changed || value == "" {
+			continue
+		}
+
+		if err := cmd.Flags().Set(flagName, value); err != nil {
+			return err
+		}
+	}
+
+	activeProfile = used
+
+	log.WithField("profile", name).Info("applyProfile: using the profile")
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/state"
+)
+
+var (
+	fixDrift bool
+
+	refreshCmd = &cobra.Command{
+		Use:   "refresh [objectID...]",
+		Short: "Check that objects exist in the cloud as their state says",
+		Long: `This command compares real resources in the cloud with the stored statuses of objects, e.g. finds
+out a cluster was deleted in the cloud console, and reports the drift. With --fix the wrong statuses are
+rewritten, e.g. the deleted cluster becomes configured and can be spawned again. Without objectIDs
+all objects are checked.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptibleContext()
+			defer cancel()
+
+			if err := refresh(ctx, args); err != nil {
+				log.Fatalf("refreshCmd: %s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(refreshCmd)
+
+	refreshCmd.Flags().BoolVar(&fixDrift, "fix", false, "rewrite statuses which don't match real resources")
+}
+
+func refresh(ctx context.Context, ids []string) error {
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	found := map[string]bool{}
+	unfixed := 0
+
+	err := fetcher.Enumerate(func(id string) bool {
+		return len(wanted) == 0 || wanted[id]
+	}, func(id string, entry state.Entry) error {
+		if entry == nil {
+			return nil
+		}
+
+		found[id] = true
+
+		thing, ok := entry.(controller.Thing)
+		if !ok {
+			return nil
+		}
+
+		if _, ok := thing.(controller.Refresher); !ok {
+			fmt.Printf("%s - cannot be refreshed\n", id)
+			return nil
+		}
+
+		drift, err := controller.RefreshThing(ctx, thing, fixDrift)
+		if err != nil {
+			return fmt.Errorf("cannot refresh %s: %w", id, err)
+		}
+
+		switch {
+		case !drift.Drifted():
+			fmt.Printf("%s - %s, no drift\n", id, drift.Stored)
+		case !drift.Fixable():
+			fmt.Printf("%s - %s, drift: %s\n", id, drift.Stored, drift.Details)
+		case fixDrift:
+			fmt.Printf("%s - drift: %s, status is changed from %s to %s\n", id, drift.Details, drift.Stored,
+				drift.Actual)
+		default:
+			fmt.Printf("%s - drift: %s, status should be %s instead of %s\n", id, drift.Details, drift.Actual,
+				drift.Stored)
+
+			unfixed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			return fmt.Errorf("cannot find an object by id %s", id)
+		}
+	}
+
+	if unfixed != 0 {
+		return fmt.Errorf("%d objects have wrong status, use --fix to rewrite it", unfixed)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/state"
+)
+
+var (
+	resumeCommand = &cobra.Command{
+		Use:   "resume [run-id] [flags]",
+		Short: "continue a run that was interrupted",
+		Long: `This command reads the journal of an interrupted "run" or "create" invocation, reports
+transitions which were interrupted together with stored statuses of the objects and then
+continues the invocation from where it stopped. The invocation is resumed with the flags it was
+given, including global ones like --state-backend and --profile; flags given after run-id are
+added to them. Stored statuses are what enzyme knew when it was interrupted, "enzyme refresh"
+compares them with real resources.`,
+		Args:               cobra.MinimumNArgs(1),
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if args[0] == "-h" || args[0] == "--help" {
+				if err := cmd.Help(); err != nil {
+					log.Fatalf("cmd.Help function failed: %s", err)
+				}
+
+				return
+			}
+
+			resume(args[0], args[1:])
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(resumeCommand)
+}
+
+func loadStatus(id string) (controller.Status, error) {
+	var status controller.Status
+
+	err := fetcher.Enumerate(func(entryID string) bool {
+		return entryID == id
+	}, func(entryID string, entry state.Entry) error {
+		if thing, ok := entry.(controller.Thing); ok {
+			status = thing.Status()
+		}
+
+		return nil
+	})
+
+	return status, err
+}
+
+func resume(runID string, flags []string) {
+	logger := log.WithField("run-id", runID)
+
+	records, err := controller.ReadJournal(journalPath(runID))
+	if err != nil {
+		logger.Fatalf("resume: cannot read journal: %s", err)
+	}
+
+	sub, err := prepareResume(runID, records, flags)
+	if err != nil {
+		logger.Fatalf("resume: %s", err)
+	}
+
+	if sub == nil {
+		return
+	}
+
+	if err := runParsedSubcommand(sub); err != nil {
+		logger.Fatalf("resume: cannot run the resumed invocation: %s", err)
+	}
+}
+
+// prepareResume parses the invocation journaled in records with additional flags and prepares
+// enzyme for it as if it was given in the command line, then reports interrupted transitions
+// with stored statuses of their objects; nil command means there is nothing to resume
+func prepareResume(runID string, records []controller.JournalRecord, flags []string) (*cobra.Command, error) {
+	var args []string
+
+	for _, rec := range records {
+		if rec.Event == controller.JournalInvocation {
+			args = rec.Args
+			break
+		}
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("journal does not contain the invocation to resume")
+	}
+
+	if last := records[len(records)-1]; last.Event == controller.JournalFinished && last.Error == "" {
+		fmt.Printf("Run %s has already finished successfully, nothing to resume\n", runID)
+		return nil, nil
+	}
+
+	args = append(append([]string{}, args...), flags...)
+
+	sub, err := parseSubcommand(args)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the resumed invocation %v: %w", args, err)
+	}
+
+	// the state backend, the encryption key and the profile are given by flags of the invocation
+	prepare(sub, sub.Flags().Args())
+
+	for _, rec := range controller.UnfinishedTransitions(records) {
+		fmt.Printf("Interrupted: %s [%s -> %s]\n", rec.Action, rec.From, rec.To)
+
+		if rec.ThingID == "" {
+			continue
+		}
+
+		status, err := loadStatus(rec.ThingID)
+
+		switch {
+		case err != nil:
+			log.WithField("thing", rec.ThingID).Errorf("prepareResume: cannot load stored status: %s", err)
+		case status == nil:
+			fmt.Printf("\t%s: no stored state\n", rec.ThingID)
+		default:
+			fmt.Printf("\t%s: stored status is %s\n", rec.ThingID, status)
+		}
+	}
+
+	resumedRunID = runID
+
+	fmt.Printf("Resuming: enzyme %v\n", args)
+
+	return sub, nil
+}
+
+// parseSubcommand finds one of enzyme commands given in args and parses its flags
+func parseSubcommand(args []string) (*cobra.Command, error) {
+	sub, rest, err := rootCmd.Find(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if sub == rootCmd || sub.Run == nil {
+		return nil, fmt.Errorf("cannot find command to run in %v", args)
+	}
+
+	if err := sub.ParseFlags(rest); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// runParsedSubcommand runs the command which flags are already parsed by parseSubcommand
+func runParsedSubcommand(sub *cobra.Command) error {
+	if err := sub.ValidateArgs(sub.Flags().Args()); err != nil {
+		return err
+	}
+
+	sub.Run(sub, sub.Flags().Args())
+
+	return nil
+}
@@ -1,20 +1,34 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"enzyme/pkg/config"
+	"enzyme/pkg/encryption"
 	"enzyme/pkg/logging"
 	"enzyme/pkg/provider"
 	"enzyme/pkg/state"
 )
 
 var (
-	verbose  bool
-	simulate bool
-	fetcher  state.Fetcher
+	verbose      bool
+	simulate     bool
+	planFormat   string
+	progress     string
+	stateBackend string
+	fetcher      state.Fetcher
+
+	s3Settings           state.S3Config
+	remoteTerraformState bool
+
+	encryptionKeyFile string
+	// encryptionKey encrypts state and generated configs, nil if they are kept unencrypted
+	encryptionKey *encryption.Key
 
 	rootCmd = &cobra.Command{
 		Use:   "enzyme",
@@ -32,14 +46,50 @@ is applicable and runs a workload there.`,
 )
 
 func init() {
-	cobra.OnInitialize(initenzyme)
+	rootCmd.PersistentPreRun = prepare
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&simulate, "simulate", "s", false,
 		"simulate running the execution - do not perform any actual actions")
+	rootCmd.PersistentFlags().StringVar(&planFormat, "plan-format", "",
+		fmt.Sprintf("when simulating, print the execution plan in given format {%s} instead of simulation messages",
+			strings.Join(validPlanFormats, ", ")))
+	rootCmd.PersistentFlags().StringVar(&progress, "progress", progressConsole,
+		fmt.Sprintf("format of progress messages {%s}", strings.Join(validProgressFormats, ", ")))
+	rootCmd.PersistentFlags().StringVar(&stateBackend, "state-backend", stateBackendJSON,
+		fmt.Sprintf("where the state of objects is kept {%s}", strings.Join(validStateBackends, ", ")))
+	rootCmd.PersistentFlags().StringVar(&s3Settings.Endpoint, "s3-endpoint", "",
+		"URL of S3-compatible store for s3 state backend, AWS S3 is used if empty")
+	rootCmd.PersistentFlags().StringVar(&s3Settings.Bucket, "s3-bucket", "", "bucket for s3 state backend")
+	rootCmd.PersistentFlags().StringVar(&s3Settings.Region, "s3-region", "us-east-1", "region of the bucket")
+	rootCmd.PersistentFlags().StringVar(&s3Settings.Prefix, "s3-prefix", "enzyme",
+		"prefix of keys of all objects enzyme keeps in the bucket")
+	rootCmd.PersistentFlags().BoolVar(&remoteTerraformState, "remote-terraform-state", false,
+		"keep terraform states of clusters and storages in the bucket given by --s3-* flags instead of local files")
+	rootCmd.PersistentFlags().StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		fmt.Sprintf("file keeping the key which encrypts state and generated configs, the key can be given "+
+			"by %s or derived from %s instead", encryption.KeyEnv, encryption.PassphraseEnv))
 
 	log.SetOutput(os.Stdout)
 }
 
+// prepare initializes enzyme and applies the profile before every command; commands parsing flags
+// by themselves like plan prepare the command they run after its flags are parsed
+func prepare(cmd *cobra.Command, args []string) {
+	if cmd.DisableFlagParsing {
+		return
+	}
+
+	initenzyme()
+
+	if cmd.HasParent() && cmd.Parent() == profileCmd {
+		return
+	}
+
+	if err := applyProfile(cmd); err != nil {
+		log.Fatalf("applyProfile: %s", err)
+	}
+}
+
 func initenzyme() {
 	if verbose {
 		log.SetLevel(log.InfoLevel)
@@ -49,16 +99,105 @@ func initenzyme() {
 
 	logging.InitLogging(verbose)
 	provider.InitTools()
+	initEncryption()
+	initFetcher()
+}
 
-	if simulate {
-		fetcher = state.Fetcher{
-			Chest: &state.MemChest{},
+func initEncryption() {
+	key, err := loadEncryptionKey(encryptionKeyFile, encryption.KeyEnv, encryption.PassphraseEnv)
+	if err != nil {
+		log.Fatalf("initEncryption: cannot read the encryption key: %s", err)
+	}
+
+	encryptionKey = key
+	encryption.Use(encryptionKey)
+
+	if err := encryption.ResealLeftovers(); err != nil {
+		log.Warnf("initEncryption: cannot encrypt files left decrypted: %s", err)
+	}
+}
+
+// loadEncryptionKey returns the key kept in keyFile, or given by keyEnv or passphraseEnv environment
+// variables in this order, nil if none of them is set
+func loadEncryptionKey(keyFile, keyEnv, passphraseEnv string) (*encryption.Key, error) {
+	if keyFile != "" {
+		return encryption.KeyFromFile(keyFile)
+	}
+
+	if encoded := os.Getenv(keyEnv); encoded != "" {
+		key, err := encryption.KeyFromString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyEnv, err)
 		}
-	} else {
-		fetcher = state.Fetcher{
-			Chest: &state.JSONChest{},
+
+		return key, nil
+	}
+
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return encryption.KeyFromPassphrase(passphrase)
+	}
+
+	return nil, nil
+}
+
+const (
+	stateBackendJSON   = "json"
+	stateBackendSQLite = "sqlite"
+	stateBackendS3     = "s3"
+)
+
+var validStateBackends = []string{stateBackendJSON, stateBackendSQLite, stateBackendS3}
+
+func initFetcher() {
+	var chest state.Chest
+
+	switch stateBackend {
+	case stateBackendJSON:
+		chest = &state.JSONChest{}
+	case stateBackendSQLite:
+		sqliteChest, err := state.OpenSQLiteChest(state.DefaultSQLitePath())
+		if err != nil {
+			log.Fatalf("initFetcher: cannot open state database: %s", err)
 		}
+
+		chest = sqliteChest
+	case stateBackendS3:
+		s3Chest, err := state.NewS3Chest(s3Settings.WithEnvCredentials())
+		if err != nil {
+			log.Fatalf("initFetcher: cannot use S3 state backend: %s", err)
+		}
+
+		chest = s3Chest
+	default:
+		log.Fatalf("initFetcher: unknown state backend %s, expected one of {%s}", stateBackend,
+			strings.Join(validStateBackends, ", "))
 	}
+
+	if simulate {
+		chest = &state.MemChest{Fallback: chest}
+	}
+
+	fetcher = state.Fetcher{
+		Chest: chest,
+	}
+}
+
+// terraformBackend returns the backend for terraform states of entities, nil means local files
+func terraformBackend() (*config.TerraformBackend, error) {
+	if !remoteTerraformState {
+		return nil, nil
+	}
+
+	if s3Settings.Bucket == "" {
+		return nil, fmt.Errorf("--remote-terraform-state needs the bucket set by --s3-bucket")
+	}
+
+	return &config.TerraformBackend{
+		Endpoint: s3Settings.Endpoint,
+		Bucket:   s3Settings.Bucket,
+		Region:   s3Settings.Region,
+		Prefix:   s3Settings.Prefix,
+	}, nil
 }
 
 func checkFileExists(fileName string) {
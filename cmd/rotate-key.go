@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"enzyme/pkg/encryption"
+	"enzyme/pkg/storage"
+)
+
+const (
+	newKeyEnv        = "ENZYME_NEW_ENCRYPTION_KEY"
+	newPassphraseEnv = "ENZYME_NEW_ENCRYPTION_PASSPHRASE"
+)
+
+var (
+	newKeyFile    string
+	decryptAtRest bool
+	rotateKeyCmd  = &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Encrypt state and generated configs by a new key",
+		Long: fmt.Sprintf(`This command rewrites states of all objects, generated configs and terraform states
+kept in .enzyme encrypted by the new key given by --new-key-file, or by %s or %s
+environment variables. They are read by the current key given by --encryption-key-file, %s
+or %s; contents which are not encrypted yet are encrypted too, so this command also
+turns the encryption on. With --decrypt everything is rewritten unencrypted.
+
+No other enzyme process may run while the key is rotated.`, newKeyEnv, newPassphraseEnv, encryption.KeyEnv,
+			encryption.PassphraseEnv),
+		Args: cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rotateKey(); err != nil {
+				log.Fatalf("rotateKeyCmd: %s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	stateCmd.AddCommand(rotateKeyCmd)
+
+	rotateKeyCmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "file keeping the new key")
+	rotateKeyCmd.Flags().BoolVar(&decryptAtRest, "decrypt", false, "rewrite everything unencrypted")
+}
+
+func rotateKey() error {
+	if simulate {
+		return fmt.Errorf("the key cannot be rotated when simulating")
+	}
+
+	newKey, err := loadEncryptionKey(newKeyFile, newKeyEnv, newPassphraseEnv)
+	if err != nil {
+		return fmt.Errorf("cannot read the new key: %w", err)
+	}
+
+	switch {
+	case newKey == nil && !decryptAtRest:
+		return fmt.Errorf("the new key is given by --new-key-file, %s or %s, use --decrypt to stop encryption",
+			newKeyEnv, newPassphraseEnv)
+	case newKey != nil && decryptAtRest:
+		return fmt.Errorf("--decrypt cannot be used with the new key")
+	}
+
+	locks, err := fetcher.Locks()
+	if err != nil {
+		return err
+	}
+
+	if len(locks) != 0 {
+		return fmt.Errorf("%d objects are locked by running enzyme processes, see 'enzyme state unlock'",
+			len(locks))
+	}
+
+	encryption.Use(newKey, encryptionKey)
+
+	entries, err := fetcher.Reencrypt()
+	for _, id := range entries {
+		fmt.Printf("%s is reencrypted\n", id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	files, err := encryption.ResealTree(storage.GetStoragePath(""))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d states and %d other files are reencrypted\n", len(entries), len(files))
+
+	if newKey != nil {
+		fmt.Println("Use the new key from now on")
+	}
+
+	return nil
+}
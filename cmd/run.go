@@ -30,6 +30,19 @@ var (
 			}
 			localPath := args[0]
 			scriptArgs := args[1:]
+
+			usedObjects := []string{clusterTargetObject, imageTargetObject}
+			if useStorage {
+				usedObjects = append([]string{storageTargetObject}, usedObjects...)
+			}
+
+			if err := checkChangedVariables(usedObjects, config, prov, serviceParams); err != nil {
+				log.WithFields(log.Fields{
+					"provider": prov,
+					"script":   localPath,
+				}).Fatalf("run: %s", err)
+			}
+
 			task, err := runtask.CreateTaskTarget(prov, config, serviceParams, fetcher, localPath, remotePath,
 				newlineConversion, overwrite, useStorage, scriptArgs, uploadFiles, downloadFiles)
 			if err != nil {
@@ -46,7 +59,7 @@ var (
 				desired = runtask.ResultsDownloaded
 			}
 
-			if err = controller.ReachTarget(task, desired, simulate); err != nil {
+			if err = reachTarget(controller.Target{Thing: task, DesiredStatus: desired}); err != nil {
 				log.WithFields(log.Fields{
 					"provider": prov,
 					"script":   localPath,
@@ -61,6 +74,7 @@ var (
 func init() {
 	rootCmd.AddCommand(runCommand)
 	addServiceParams(runCommand)
+	addExecParams(runCommand)
 
 	runCommand.Flags().StringVar(&remotePath, "remote-path", "enzyme-script",
 		"name for the transmitted program on the remote machine")
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -19,12 +21,20 @@ var (
 	providerName    string
 	credentialsFile string
 
-	parametersFile string
+	parametersFile   string
+	parametersFormat string
 
 	vars map[string]string
+	// allowCmdRefs enables ${cmd:...} references in user variables
+	allowCmdRefs bool
 )
 
 func createArgs() (config.Config, provider.Provider, config.ServiceParams, error) {
+	return createArgsFor(parametersFile)
+}
+
+// createArgsFor does the same as createArgs but reads user variables from given parameters file
+func createArgsFor(parametersFile string) (config.Config, provider.Provider, config.ServiceParams, error) {
 	checkFileExists(credentialsFile)
 
 	prov, err := provider.CreateProvider(providerName, region, zone, credentialsFile)
@@ -44,23 +54,112 @@ func createArgs() (config.Config, provider.Provider, config.ServiceParams, error
 		"credentials": credentialsFile,
 	}).Infof("created provider: %s", prov)
 
+	userVariables, err := readUserVariables(parametersFile)
+	if err != nil {
+		return nil, nil, config.ServiceParams{}, err
+	}
+
+	schema, err := provider.GetVariablesSchema(providerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"name": providerName,
+		}).Errorf("cannot read descriptions of user variables: %s", err)
+
+		return nil, nil, config.ServiceParams{}, err
+	}
+
+	if err := config.ResolveReferences(userVariables, schema.Defaults(), allowCmdRefs); err != nil {
+		log.WithFields(log.Fields{
+			"parameters": parametersFile,
+		}).Errorf("cannot resolve references in user variables: %s", err)
+
+		return nil, nil, config.ServiceParams{}, err
+	}
+
+	actionTimeouts, err := extractActionTimeouts(userVariables)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"parameters": parametersFile,
+		}).Errorf("cannot read timeouts of actions: %s", err)
+
+		return nil, nil, config.ServiceParams{}, err
+	}
+
+	if err := schema.Check(userVariables); err != nil {
+		log.WithFields(log.Fields{
+			"parameters": parametersFile,
+		}).Errorf("wrong user variables: %s", err)
+
+		return nil, nil, config.ServiceParams{}, err
+	}
+
+	backend, err := terraformBackend()
+	if err != nil {
+		return nil, nil, config.ServiceParams{}, err
+	}
+
+	changedVariables := config.RefuseChangedVariables
+	if adoptNewVars {
+		changedVariables = config.AdoptChangedVariables
+	}
+
+	return userVariables, prov, config.ServiceParams{
+		SocksProxyHost:   socksHost,
+		SocksProxyPort:   socksPort,
+		TerraformBackend: backend,
+		ChangedVariables: changedVariables,
+		ActionTimeouts:   actionTimeouts,
+	}, nil
+}
+
+// readUserVariables merges user variables from parameter files of the profile, vars of the profile,
+// the parameters file and --vars, later ones override values of earlier ones
+func readUserVariables(parametersFile string) (config.Config, error) {
 	var userVariables config.Config
+
+	for _, fileName := range activeProfile.Parameters {
+		profileVariables, err := config.CreateConfigFromFile(fileName, "")
+		if err != nil {
+			log.WithFields(log.Fields{
+				"parameters": fileName,
+			}).Errorf("cannot create user variables of the profile: %s", err)
+
+			return nil, err
+		}
+
+		userVariables = mergeUserVariables(userVariables, profileVariables)
+	}
+
+	if userVariables == nil && (len(activeProfile.Vars) != 0 || parametersFile == "") {
+		userVariables = config.CreateJSONConfig()
+		log.Infof("created default user variables: %s", userVariables)
+	}
+
+	for key, value := range activeProfile.Vars {
+		userVariables.SetValue(key, value)
+	}
+
 	if parametersFile != "" {
-		userVariables, err = config.CreateJSONConfigFromFile(parametersFile)
+		if parametersFormat != "" {
+			if err := checkChoice("parameters format", parametersFormat, config.Formats); err != nil {
+				log.WithFields(log.Fields{
+					"parameters": parametersFile,
+				}).Errorf("cannot read user variables: %s", err)
+
+				return nil, err
+			}
+		}
+
+		fileVariables, err := config.CreateConfigFromFile(parametersFile, parametersFormat)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"parameters": parametersFile,
 			}).Errorf("cannot create user variables: %s", err)
 
-			return nil, nil, config.ServiceParams{}, err
+			return nil, err
 		}
 
-		log.WithFields(log.Fields{
-			"parameters": parametersFile,
-		}).Infof("created user variables: %s", userVariables)
-	} else {
-		userVariables = config.CreateJSONConfig()
-		log.Infof("created default user variables: %s", userVariables)
+		userVariables = mergeUserVariables(userVariables, fileVariables)
 	}
 
 	// Extend config by map's value
@@ -69,10 +168,37 @@ func createArgs() (config.Config, provider.Provider, config.ServiceParams, error
 		userVariables.SetValue(key, value)
 	}
 
-	return userVariables, prov, config.ServiceParams{
-		SocksProxyHost: socksHost,
-		SocksProxyPort: socksPort,
-	}, nil
+	log.WithFields(log.Fields{
+		"parameters": parametersFile,
+	}).Infof("created user variables: %s", userVariables)
+
+	return userVariables, nil
+}
+
+// mergeUserVariables overrides values of userVariables by the values of other variables,
+// other variables are returned if there are no user variables yet
+func mergeUserVariables(userVariables config.Config, other config.Config) config.Config {
+	if userVariables == nil {
+		return other
+	}
+
+	merged := map[string]bool{}
+
+	for _, key := range other.Keys() {
+		// nested values are listed as dotted keys, they are overridden as a whole
+		name := strings.SplitN(key, ".", 2)[0]
+		if merged[name] {
+			continue
+		}
+
+		merged[name] = true
+
+		if value, err := other.GetValue(name); err == nil {
+			userVariables.SetValue(name, value)
+		}
+	}
+
+	return userVariables
 }
 
 func addServiceParams(cmd *cobra.Command) {
@@ -86,9 +212,14 @@ func addServiceParams(cmd *cobra.Command) {
 		"path to credentials file")
 
 	cmd.Flags().StringVar(&parametersFile, "parameters", "", "file with parameters")
+	cmd.Flags().StringVar(&parametersFormat, "parameters-format", "",
+		fmt.Sprintf("format of parameters files {%s}, detected by the file extension if empty",
+			strings.Join(config.Formats, ", ")))
 
 	cmd.Flags().StringToStringVar(&vars, "vars", nil,
 		"list of user's variables; for example, 'image_name=enzyme,disk_size=30'")
+	cmd.Flags().BoolVar(&allowCmdRefs, "allow-cmd-refs", false,
+		"resolve ${cmd:...} references in user variables by running the commands")
 
 	if os.Getenv("enzyme_ENABLE_SOCKS") != "" {
 		cmd.Flags().StringVar(&socksHost, "socks-host", socksHost, "socks-host to access the network")
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptibleContext returns a context which is cancelled on the first SIGINT or SIGTERM
+// so running actions can stop their tools and record what was interrupted;
+// the second signal terminates enzyme immediately
+func interruptibleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Printf("Received %s, stopping running actions...\n", sig)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+
+		sig := <-signals
+		fmt.Printf("Received %s again, exiting\n", sig)
+		os.Exit(1)
+	}()
+
+	return ctx, cancel
+}
@@ -1,7 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -15,41 +21,220 @@ type MoreInfoer interface {
 	MoreInfo() (string, error)
 }
 
-func printEntry(id string, entry state.Entry) error {
-	fmt.Printf("%s - %s\n", id, entry)
+var (
+	stateCmd = &cobra.Command{
+		Use:   "state",
+		Short: "Print the state of enzyme",
+		Long: `This command shows all manageable entities (images, clusters, storages etc.) with their statuses.
+Objects are filtered by --kind, --provider, --status and --name flags and printed as text, a table,
+json or yaml. Use "enzyme state show" to see everything known about one of them.`,
+		Args: cobra.ExactValidArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listState(); err != nil {
+				log.Fatalf("stateCmd: %s", err)
+			}
+		},
+	}
 
-	if infoer, ok := entry.(MoreInfoer); ok {
-		more, err := infoer.MoreInfo()
-		if err != nil {
-			log.WithField("thing", entry).Errorf("Cannot get more info: %s", err)
-			return err
-		}
+	stateHistoryCmd = &cobra.Command{
+		Use:   "history [objectID]",
+		Short: "Print previous states of the object",
+		Long: `This command lists previous versions of the object state kept by enzyme, oldest first,
+together with the time when each version was replaced. The current state is printed last. Previous
+versions are kept by json and sqlite state backends only, s3 backend keeps the current state.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printHistory(args[0]); err != nil {
+				log.WithField("id", args[0]).Fatalf("stateHistoryCmd: %s", err)
+			}
+		},
+	}
 
-		if more != "" {
-			fmt.Printf("\t%s\n", more)
-		}
+	stateRollbackCmd = &cobra.Command{
+		Use:   "rollback [objectID] [version]",
+		Short: "Restore one of previous states of the object",
+		Long: `This command replaces the state of the object by one of its previous versions listed
+by "enzyme state history". The replaced state is kept in the history as well. Cloud resources are
+not touched, so use it to recover from a wrong status write only.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			version, err := strconv.Atoi(args[1])
+			if err != nil {
+				log.WithField("version", args[1]).Fatalf("stateRollbackCmd: wrong version: %s", err)
+			}
+
+			if err := fetcher.Rollback(args[0], version); err != nil {
+				err = explainNoHistory(err)
+				log.WithFields(log.Fields{
+					"id":      args[0],
+					"version": version,
+				}).Fatalf("stateRollbackCmd: %s", err)
+			}
+
+			fmt.Printf("%s is restored to version %d\n", args[0], version)
+		},
 	}
 
-	return nil
-}
+	stateMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade stored states to the format of this enzyme version",
+		Long: `This command rewrites states of all objects stored in an older format. Before changing
+anything the whole state directory is copied to .enzyme/state-backup, so a previous enzyme version
+can be used again by copying it back. Outdated states are also upgraded on reading, this command
+just makes it at once.`,
+		Args: cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			backup, migrated, err := fetcher.Migrate()
+			for _, entry := range migrated {
+				if entry.From == entry.To {
+					fmt.Printf("%s is marked with version %d\n", entry.ID, entry.To)
+				} else {
+					fmt.Printf("%s is upgraded from version %d to %d\n", entry.ID, entry.From, entry.To)
+				}
+			}
 
-var (
-	stateCmd = &cobra.Command{
-		Use:   "state",
-		Short: "Print the state of enzyme",
-		Long:  `This command shows all manageable entities (images, clusters, storages etc.) with their statuses.`,
-		Args:  cobra.ExactValidArgs(0),
+			if backup != "" {
+				fmt.Printf("Previous state is kept in %s\n", backup)
+			}
+
+			if err != nil {
+				log.Fatalf("stateMigrateCmd: %s", err)
+			}
+
+			if len(migrated) == 0 {
+				fmt.Println("State is up to date")
+			}
+		},
+	}
+
+	stateImportJSONCmd = &cobra.Command{
+		Use:   "import-json",
+		Short: "Copy states kept in .json files to the state backend",
+		Long: `This command copies states of all objects kept in .enzyme/state, where enzyme keeps them
+with the default --state-backend=json, to the backend given by --state-backend. Objects already known
+to the backend are skipped. The .json files are left as they are.`,
+		Args: cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
-			err := fetcher.Enumerate(func(id string) bool {
-				return true
-			}, printEntry)
+			imported, skipped, err := fetcher.ImportJSON()
+			for _, id := range imported {
+				fmt.Printf("%s is imported\n", id)
+			}
+
+			for _, id := range skipped {
+				fmt.Printf("%s is skipped, its state is already kept in the backend\n", id)
+			}
+
 			if err != nil {
-				log.Fatalf("stateCmd: %s", err)
+				log.Fatalf("stateImportJSONCmd: %s", err)
+			}
+		},
+	}
+
+	forceUnlock    bool
+	stateUnlockCmd = &cobra.Command{
+		Use:   "unlock [objectID]",
+		Short: "Remove locks of objects left by crashed enzyme processes",
+		Long: `Enzyme locks an object while changing it, so several enzyme processes sharing the state
+don't break it. Locks of processes which died on the same host are removed automatically, other
+locks are only removed by this command with --force flag. Without objectID all locks are handled.
+Never remove locks of running processes.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := unlockState(args); err != nil {
+				log.Fatalf("stateUnlockCmd: %s", err)
 			}
 		},
 	}
 )
 
+func unlockState(args []string) error {
+	locks, err := fetcher.Locks()
+	if err != nil {
+		return err
+	}
+
+	ids := []string{}
+
+	for id := range locks {
+		if len(args) == 0 || args[0] == id {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	if len(args) != 0 && len(ids) == 0 {
+		fmt.Printf("%s is not locked\n", args[0])
+		return nil
+	}
+
+	for _, id := range ids {
+		if !forceUnlock {
+			fmt.Printf("%s is locked by %s\n", id, locks[id])
+			continue
+		}
+
+		if err := fetcher.BreakLock(id); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s is unlocked, it was locked by %s\n", id, locks[id])
+	}
+
+	if !forceUnlock && len(ids) != 0 {
+		return fmt.Errorf("locks are held by running enzyme processes unless they crashed, " +
+			"use --force to remove them anyway")
+	}
+
+	return nil
+}
+
+// explainNoHistory tells which backends keep the history when the one in use doesn't
+func explainNoHistory(err error) error {
+	if !errors.Is(err, state.ErrNoHistory) {
+		return err
+	}
+
+	return fmt.Errorf("state backend %s keeps only current states, previous ones are kept by %s and %s backends",
+		stateBackend, stateBackendJSON, stateBackendSQLite)
+}
+
+func printHistory(id string) error {
+	history, err := fetcher.History(id)
+	if err != nil {
+		return explainNoHistory(err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tREPLACED\tSTATE")
+
+	for _, version := range history {
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", version.Number, version.Time.Format(time.RFC3339), version.Entry)
+	}
+
+	found := false
+
+	if err := fetcher.Enumerate(func(entryID string) bool {
+		return entryID == id
+	}, func(entryID string, entry state.Entry) error {
+		found = true
+		fmt.Fprintf(writer, "current\t\t%s\n", entry)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if !found && len(history) == 0 {
+		return fmt.Errorf("cannot find an object by id")
+	}
+
+	return writer.Flush()
+}
+
 func init() {
 	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateHistoryCmd, stateRollbackCmd, stateUnlockCmd, stateMigrateCmd, stateImportJSONCmd)
+
+	stateUnlockCmd.Flags().BoolVar(&forceUnlock, "force", false, "remove the locks")
 }
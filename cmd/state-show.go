@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/state"
+	"enzyme/pkg/storage"
+)
+
+const (
+	outputText  = "text"
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+
+	// logSuffixLength is the length of "-{time}.log" ending names of tool logs
+	logSuffixLength = len("-2006-01-02-15-04-05.log")
+)
+
+var (
+	validStateOutputs = []string{outputText, outputTable, outputJSON, outputYAML}
+	validStateSorts   = []string{"id", "kind", "name", "provider", "status"}
+
+	stateOutput   string
+	stateKind     string
+	stateProvider string
+	stateStatus   string
+	stateName     string
+	stateSort     string
+	logLines      int
+
+	stateShowCmd = &cobra.Command{
+		Use:   "show [objectID]",
+		Short: "Print everything enzyme knows about the object",
+		Long: `This command prints the stored state of the object including paths of its configuration,
+connection details and the ends of the latest logs of tools run for it.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := showEntry(args[0]); err != nil {
+				log.WithField("id", args[0]).Fatalf("stateShowCmd: %s", err)
+			}
+		},
+	}
+)
+
+// stateRecord is an object as listed by "enzyme state"
+type stateRecord struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Status   string `json:"status"`
+	Info     string `json:"info,omitempty"`
+
+	summary string
+}
+
+// toolLog is the latest log of a tool run for an object
+type toolLog struct {
+	Tool     string    `json:"tool"`
+	Path     string    `json:"path"`
+	Modified time.Time `json:"modified"`
+	Tail     []string  `json:"tail"`
+}
+
+// entryDetails is an object as printed by "enzyme state show"
+type entryDetails struct {
+	stateRecord
+	ConfigPaths map[string]string `json:"configPaths"`
+	State       interface{}       `json:"state"`
+	Logs        []toolLog         `json:"logs"`
+}
+
+// printStructured prints the value as json or yaml, yaml keeps names and order of json fields
+func printStructured(v interface{}, format string) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == outputJSON {
+		fmt.Println(string(content))
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	ordered, err := decodeOrdered(decoder)
+	if err != nil {
+		return err
+	}
+
+	if content, err = yaml.Marshal(ordered); err != nil {
+		return err
+	}
+
+	fmt.Print(string(content))
+
+	return nil
+}
+
+// decodeOrdered decodes the next json value keeping objects as yaml.MapSlice, so their keys are not sorted
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := yaml.MapSlice{}
+
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+
+		_, err = decoder.Token()
+
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+
+		for decoder.More() {
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+		}
+
+		_, err = decoder.Token()
+
+		return array, err
+	}
+
+	if number, ok := token.(json.Number); ok {
+		if integer, err := number.Int64(); err == nil {
+			return integer, nil
+		}
+
+		return number.Float64()
+	}
+
+	return token, nil
+}
+
+// publicFields returns top level fields of the persisted entry decoded as json
+func publicFields(entry state.Entry) (map[string]interface{}, interface{}, error) {
+	public, err := entry.ToPublic()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := json.Marshal(public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(content, &fields)
+
+	return fields, public, err
+}
+
+func makeRecord(id string, entry state.Entry) (stateRecord, error) {
+	hier := strings.Split(id, "/")
+	record := stateRecord{ID: id, Kind: hier[0], Name: hier[len(hier)-1], summary: fmt.Sprint(entry)}
+
+	if thing, ok := entry.(controller.Thing); ok {
+		record.Status = fmt.Sprintf("%s", thing.Status())
+	}
+
+	fields, _, err := publicFields(entry)
+	if err != nil {
+		return record, err
+	}
+
+	if prov, ok := fields["Provider"].(map[string]interface{}); ok {
+		record.Provider, _ = prov["Name"].(string)
+	}
+
+	if infoer, ok := entry.(MoreInfoer); ok {
+		if record.Info, err = infoer.MoreInfo(); err != nil {
+			log.WithField("thing", entry).Errorf("Cannot get more info: %s", err)
+			return record, err
+		}
+	}
+
+	return record, nil
+}
+
+func sortRecords(records []stateRecord, by string) {
+	key := func(record stateRecord) string {
+		switch by {
+		case "kind":
+			return record.Kind
+		case "name":
+			return record.Name
+		case "provider":
+			return record.Provider
+		case "status":
+			return record.Status
+		}
+
+		return record.ID
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if key(records[i]) != key(records[j]) {
+			return key(records[i]) < key(records[j])
+		}
+
+		return records[i].ID < records[j].ID
+	})
+}
+
+func checkChoice(name, value string, valid []string) error {
+	for _, known := range valid {
+		if value == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown %s %s, expected one of {%s}", name, value, strings.Join(valid, ", "))
+}
+
+// listState prints stored objects matching the filters given by flags
+func listState() error {
+	if err := checkChoice("output format", stateOutput, validStateOutputs); err != nil {
+		return err
+	}
+
+	if err := checkChoice("sort field", stateSort, validStateSorts); err != nil {
+		return err
+	}
+
+	if _, err := path.Match(stateName, ""); err != nil {
+		return fmt.Errorf("wrong name pattern %s: %w", stateName, err)
+	}
+
+	records := []stateRecord{}
+
+	err := fetcher.EnumerateQuery(state.Query{Kind: stateKind, Provider: stateProvider}, func(id string) bool {
+		if stateName == "" {
+			return true
+		}
+
+		matched, _ := path.Match(stateName, path.Base(id))
+
+		return matched
+	}, func(id string, entry state.Entry) error {
+		if entry == nil {
+			return nil
+		}
+
+		record, err := makeRecord(id, entry)
+		if err != nil {
+			return err
+		}
+
+		if stateStatus == "" || strings.EqualFold(stateStatus, record.Status) {
+			records = append(records, record)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sortRecords(records, stateSort)
+
+	switch stateOutput {
+	case outputJSON, outputYAML:
+		return printStructured(records, stateOutput)
+	case outputTable:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tKIND\tNAME\tPROVIDER\tSTATUS")
+
+		for _, record := range records {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", record.ID, record.Kind, record.Name, record.Provider,
+				record.Status)
+		}
+
+		return writer.Flush()
+	}
+
+	for _, record := range records {
+		fmt.Printf("%s - %s\n", record.ID, record.summary)
+
+		if record.Info != "" {
+			fmt.Printf("\t%s\n", record.Info)
+		}
+	}
+
+	return nil
+}
+
+// tail returns up to count last lines of the file
+func tail(fileName string, count int) ([]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > count {
+			lines = lines[1:]
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// latestLogs returns the latest log of every tool run for the object, logs are kept by
+// the hierarchy of the object without its kind
+func latestLogs(id string) ([]toolLog, error) {
+	hier := strings.Split(id, "/")
+	dir := filepath.Join(append([]string{storage.GetStoragePath(storage.LogCategory)}, hier[1:]...)...)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []toolLog{}, nil
+		}
+
+		return nil, err
+	}
+
+	latest := map[string]os.FileInfo{}
+
+	for _, file := range files {
+		if file.IsDir() || len(file.Name()) <= logSuffixLength || !strings.HasSuffix(file.Name(), ".log") {
+			continue
+		}
+
+		// names end with time, so the latest name is the latest log
+		tool := file.Name()[:len(file.Name())-logSuffixLength]
+		if known, ok := latest[tool]; !ok || known.Name() < file.Name() {
+			latest[tool] = file
+		}
+	}
+
+	result := []toolLog{}
+
+	for tool, file := range latest {
+		logPath := filepath.Join(dir, file.Name())
+
+		lines, err := tail(logPath, logLines)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, toolLog{Tool: tool, Path: logPath, Modified: file.ModTime(), Tail: lines})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Modified.Before(result[j].Modified)
+	})
+
+	return result, nil
+}
+
+func showEntry(id string) error {
+	if err := checkChoice("output format", stateOutput, validStateOutputs); err != nil {
+		return err
+	}
+
+	var details *entryDetails
+
+	err := fetcher.Enumerate(func(entryID string) bool {
+		return entryID == id
+	}, func(entryID string, entry state.Entry) error {
+		if entry == nil {
+			return nil
+		}
+
+		record, err := makeRecord(entryID, entry)
+		if err != nil {
+			return err
+		}
+
+		fields, public, err := publicFields(entry)
+		if err != nil {
+			return err
+		}
+
+		details = &entryDetails{stateRecord: record, ConfigPaths: map[string]string{}, State: public}
+
+		for name, value := range fields {
+			if text, ok := value.(string); ok && strings.HasSuffix(name, "Path") && text != "" {
+				details.ConfigPaths[name] = text
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if details == nil {
+		return fmt.Errorf("cannot find an object by id")
+	}
+
+	if details.Logs, err = latestLogs(id); err != nil {
+		return err
+	}
+
+	if stateOutput == outputJSON || stateOutput == outputYAML {
+		return printStructured(details, stateOutput)
+	}
+
+	return printDetails(details)
+}
+
+func printDetails(details *entryDetails) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "ID:\t%s\nKind:\t%s\nName:\t%s\nProvider:\t%s\nStatus:\t%s\n", details.ID, details.Kind,
+		details.Name, details.Provider, details.Status)
+
+	names := []string{}
+	for name := range details.ConfigPaths {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(writer, "%s:\t%s\n", name, details.ConfigPaths[name])
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if details.Info != "" {
+		fmt.Printf("\nConnection:\n\t%s\n", details.Info)
+	}
+
+	content, err := json.MarshalIndent(details.State, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nStored state:\n%s\n", content)
+
+	for _, toolLog := range details.Logs {
+		fmt.Printf("\nLatest %s log %s (%s):\n", toolLog.Tool, toolLog.Path, toolLog.Modified.Format(time.RFC3339))
+
+		for _, line := range toolLog.Tail {
+			fmt.Printf("\t%s\n", line)
+		}
+	}
+
+	return nil
+}
+
+func addStateOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&stateOutput, "output", "o", outputText,
+		fmt.Sprintf("output format {%s}", strings.Join(validStateOutputs, ", ")))
+}
+
+func init() {
+	stateCmd.AddCommand(stateShowCmd)
+
+	addStateOutputFlag(stateCmd)
+	stateCmd.Flags().StringVar(&stateKind, "kind", "", "only print objects of this kind {image, cluster, storage}")
+	stateCmd.Flags().StringVar(&stateProvider, "provider", "", "only print objects of this provider, e.g. gcp")
+	stateCmd.Flags().StringVar(&stateStatus, "status", "", "only print objects in this status, e.g. created")
+	stateCmd.Flags().StringVar(&stateName, "name", "", "only print objects which names match this glob pattern")
+	stateCmd.Flags().StringVar(&stateSort, "sort", "id",
+		fmt.Sprintf("sort objects by {%s}", strings.Join(validStateSorts, ", ")))
+
+	addStateOutputFlag(stateShowCmd)
+	stateShowCmd.Flags().IntVar(&logLines, "log-lines", 10, "number of last lines printed from every log")
+}
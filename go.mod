@@ -4,10 +4,12 @@ go 1.13
 
 require (
 	github.com/intel-go/viper v1.5.1-0.20191113170345-18a46e0e5e35
-	github.com/mattn/go-isatty v0.0.10
+	github.com/mattn/go-isatty v0.0.12 // minimum required by modernc.org/libc of the sqlite driver
 	github.com/pkg/sftp v1.10.1
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v0.0.5
-	golang.org/x/crypto v0.0.0-20190820162420-60c769a6c586
-	golang.org/x/net v0.0.0-20190522155817-f3200d17e092
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // minimum required by golang.org/x/net below
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // minimum required by golang.org/x/tools of the sqlite driver
+	gopkg.in/yaml.v2 v2.2.4
+	modernc.org/sqlite v1.14.8
 )
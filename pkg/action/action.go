@@ -1,32 +1,58 @@
 package action
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"enzyme/pkg/encryption"
 	"enzyme/pkg/logging"
+	"enzyme/pkg/secret"
+)
+
+var (
+	// interruptGracePeriod is how long an interrupted command is given to stop
+	// by itself before it gets killed
+	interruptGracePeriod = 2 * time.Minute
 )
 
 // RunLoggedCmd executes the program <name> in current working directory
 // with arguments <args> while redirecting its output to the logger
-func RunLoggedCmd(logfilePrefix string, name string, args ...string) (string, error) {
-	return RunLoggedCmdDir(logfilePrefix, "", name, args...)
+func RunLoggedCmd(ctx context.Context, logfilePrefix string, name string, args ...string) (string, error) {
+	return RunLoggedCmdDir(ctx, logfilePrefix, "", name, args...)
 }
 
 // RunLoggedCmdDir executes the program <name> in working directory <workDir>
 // with arguments <args> while redirecting its output to the logger
-func RunLoggedCmdDir(logfilePrefix string, workDir string, name string, args ...string) (string, error) {
-	return RunLoggedCmdDirOutput(logfilePrefix, workDir, nil, name, args...)
+func RunLoggedCmdDir(ctx context.Context, logfilePrefix string, workDir string, name string,
+	args ...string) (string, error) {
+	return RunLoggedCmdDirOutput(ctx, logfilePrefix, workDir, nil, name, args...)
 }
 
-// RunLoggedCmdDirOutput executes the command and reads its stdout into <output>
-func RunLoggedCmdDirOutput(logfilePrefix string, workDir string, output io.Writer, name string,
-	args ...string) (string, error) {
+// RunLoggedCmdDirOutput executes the command and reads its stdout into <output>;
+// when ctx is cancelled the command (with all its children) is interrupted.
+// Encrypted files the command works with are decrypted while it runs.
+func RunLoggedCmdDirOutput(ctx context.Context, logfilePrefix string, workDir string, output io.Writer,
+	name string, args ...string) (string, error) {
+	reseal, err := encryption.OpenForTool(workDir, args)
+	if err != nil {
+		log.WithField("dir", workDir).Errorf("RunLoggedCmdDirOutput: cannot decrypt files of %s: %s", name, err)
+
+		return "", err
+	}
+
+	defer func() {
+		if err := reseal(); err != nil {
+			log.WithField("dir", workDir).Errorf("RunLoggedCmdDirOutput: cannot encrypt files of %s: %s", name, err)
+		}
+	}()
+
 	var cmdLog io.Writer
 
 	logname, cmdLogfile, err := logging.MakeLogWriter(logfilePrefix)
@@ -45,28 +71,44 @@ func RunLoggedCmdDirOutput(logfilePrefix string, workDir string, output io.Write
 		cmdLog = cmdLogfile
 	}
 
+	// secrets are redacted from logs, but not from the output read by enzyme
+	redactedLog, redactedStdout, redactedStderr :=
+		secret.NewWriter(cmdLog), secret.NewWriter(os.Stdout), secret.NewWriter(os.Stderr)
+
+	defer func() {
+		for _, writer := range []*secret.Writer{redactedLog, redactedStdout, redactedStderr} {
+			if err := writer.Flush(); err != nil {
+				log.WithField("log", logname).Warnf("RunLoggedCmdDirOutput: cannot write log: %s", err)
+			}
+		}
+	}()
+
 	var cmdOut, cmdErr io.Writer
 
 	switch {
 	case output != nil:
-		cmdOut = io.MultiWriter(output, cmdLog)
+		cmdOut = io.MultiWriter(output, redactedLog)
 	case logging.GetRepeatLogs():
-		cmdOut = io.MultiWriter(os.Stdout, cmdLog)
+		cmdOut = io.MultiWriter(redactedStdout, redactedLog)
 	default:
-		cmdOut = cmdLog
+		cmdOut = redactedLog
 	}
 
 	if logging.GetRepeatLogs() {
-		cmdErr = io.MultiWriter(os.Stderr, cmdLog)
+		cmdErr = io.MultiWriter(redactedStderr, redactedLog)
 	} else {
-		cmdErr = cmdLog
+		cmdErr = redactedLog
 	}
 
-	return logname, runLoggedCmdDirRedirect(logname, workDir, cmdOut, cmdErr, name, args...)
+	return logname, runLoggedCmdDirRedirect(ctx, logname, workDir, cmdOut, cmdErr, name, args...)
 }
 
-func runLoggedCmdDirRedirect(logname string, workDir string, cmdOut io.Writer, cmdErr io.Writer, name string,
-	args ...string) error {
+func runLoggedCmdDirRedirect(ctx context.Context, logname string, workDir string, cmdOut io.Writer,
+	cmdErr io.Writer, name string, args ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	command := exec.Command(name, args...)
 	command.Stdout = cmdOut
 	command.Stderr = cmdErr
@@ -75,12 +117,51 @@ func runLoggedCmdDirRedirect(logname string, workDir string, cmdOut io.Writer, c
 		command.Dir = workDir
 	}
 
-	log.WithFields(log.Fields{
+	// run the command in its own process group, so it can be stopped with all
+	// its children, and doesn't get terminal signals directly
+	setProcessGroup(command)
+
+	logger := log.WithFields(log.Fields{
 		"name": name,
 		"dir":  workDir,
 		"args": args,
 		"log":  logname,
-	}).Info("running command")
+	})
+	logger.Info("running command")
+
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	finished := make(chan error, 1)
+
+	go func() {
+		finished <- command.Wait()
+	}()
+
+	select {
+	case err := <-finished:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("interrupting command")
+
+	if err := interruptProcessGroup(command); err != nil {
+		logger.Warnf("cannot interrupt command: %s", err)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(interruptGracePeriod):
+		logger.Warnf("command did not stop in %s, killing it", interruptGracePeriod)
+
+		if err := killProcessGroup(command); err != nil {
+			logger.Errorf("cannot kill command: %s", err)
+		}
+
+		<-finished
+	}
 
-	return command.Run()
+	return fmt.Errorf("%s interrupted: %w", name, ctx.Err())
 }
@@ -2,6 +2,7 @@ package action
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -24,7 +25,7 @@ func TestRunLoggedCmdDirOutput(t *testing.T) {
 
 	expectedContent := string(expectedBytesContent)
 
-	logName, err := RunLoggedCmdDirOutput(testLogFilePrefix, workdir, &buffer, name, arg)
+	logName, err := RunLoggedCmdDirOutput(context.Background(), testLogFilePrefix, workdir, &buffer, name, arg)
 	if err != nil {
 		t.Errorf("error occurred while trying to run command: [%s %s], error: [%s]", name, arg, err)
 	}
@@ -52,7 +53,7 @@ func TestLoggedCmd(t *testing.T) {
 	arg := "version"
 	expectedLogContent := "enzyme: running command: go version"
 
-	logName, err := RunLoggedCmd(testLogFilePrefix, name, arg)
+	logName, err := RunLoggedCmd(context.Background(), testLogFilePrefix, name, arg)
 	if err != nil {
 		t.Errorf("error occurred while trying to run command: [%s %s], error: [%s]", name, arg, err)
 	}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package action
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interruptProcessGroup(command *exec.Cmd) error {
+	// negative pid means signalling the whole process group
+	return syscall.Kill(-command.Process.Pid, syscall.SIGINT)
+}
+
+func killProcessGroup(command *exec.Cmd) error {
+	return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+}
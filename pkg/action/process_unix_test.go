@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package action
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunLoggedCmdCancel(t *testing.T) {
+	testLogFilePrefix := filepath.Join(os.TempDir(), "TestRunLoggedCmdCancel")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+
+	_, err := RunLoggedCmd(ctx, testLogFilePrefix, "sleep", "30")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cancelled command returned unexpected error: [%v]", err)
+	}
+
+	if took := time.Since(started); took > 10*time.Second {
+		t.Errorf("cancelled command wasn't stopped in time: [%s]", took)
+	}
+}
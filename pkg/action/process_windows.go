@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package action
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(command *exec.Cmd) {
+}
+
+func interruptProcessGroup(command *exec.Cmd) error {
+	// there is no way to deliver Ctrl-C to a single process on Windows
+	return command.Process.Kill()
+}
+
+func killProcessGroup(command *exec.Cmd) error {
+	return command.Process.Kill()
+}
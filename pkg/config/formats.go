@@ -0,0 +1,152 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/encryption"
+)
+
+const (
+	// FormatJSON is the format of JSON files, generated configs are always kept in it
+	FormatJSON = "json"
+	// FormatYAML is the format of YAML files
+	FormatYAML = "yaml"
+	// FormatTOML is the format of TOML files
+	FormatTOML = "toml"
+	// FormatHCL is the format of HCL files like terraform variables
+	FormatHCL = "hcl"
+)
+
+var (
+	// Formats are the formats config files are read from
+	Formats = []string{FormatJSON, FormatYAML, FormatTOML, FormatHCL}
+
+	formatExtensions = map[string]string{
+		".json": FormatJSON,
+		".yaml": FormatYAML,
+		".yml":  FormatYAML,
+		".toml": FormatTOML,
+		".hcl":  FormatHCL,
+	}
+)
+
+// DetectFormat returns the format of the file by its extension,
+// files with unknown extensions are read as JSON
+func DetectFormat(fileName string) string {
+	if format, ok := formatExtensions[strings.ToLower(filepath.Ext(fileName))]; ok {
+		return format
+	}
+
+	return FormatJSON
+}
+
+// CreateConfigFromFile is function for creation of config object from the file of given format,
+// empty format is detected by the file extension. Values are kept as if the file was JSON one,
+// so the config behaves and is serialized the same way whatever the format is.
+func CreateConfigFromFile(fileName string, format string) (Config, error) {
+	if format == "" {
+		format = DetectFormat(fileName)
+	}
+
+	if format == FormatJSON {
+		return CreateJSONConfigFromFile(fileName)
+	}
+
+	jsonContent, err := convertToJSON(fileName, format)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"filename": fileName,
+			"format":   format,
+		}).Errorf("CreateConfigFromFile: %s", err)
+
+		return nil, err
+	}
+
+	jsonConf := &jsonConfig{data: newViperConfig()}
+	jsonConf.data.SetConfigType(FormatJSON)
+
+	if err := jsonConf.data.ReadConfig(bytes.NewReader(jsonContent)); err != nil {
+		log.WithFields(log.Fields{
+			"filename": fileName,
+			"format":   format,
+		}).Errorf("CreateConfigFromFile: %s", err)
+
+		return nil, err
+	}
+
+	return jsonConf, nil
+}
+
+// convertToJSON reads the file of given format and returns its contents as JSON
+func convertToJSON(fileName string, format string) ([]byte, error) {
+	known := false
+
+	for _, supported := range Formats {
+		known = known || supported == format
+	}
+
+	if !known {
+		return nil, fmt.Errorf("unknown format %s, expected one of {%s}", format, strings.Join(Formats, ", "))
+	}
+
+	content, err := encryption.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	vpr := newViperConfig()
+	vpr.SetConfigType(format)
+
+	if err := vpr.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(normalizeValue(vpr.AllSettings(), format))
+}
+
+// normalizeValue makes decoded values the ones JSON decoding would give: YAML maps get string keys,
+// HCL objects decoded as lists of a single map become maps
+func normalizeValue(value interface{}, format string) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			result[key] = normalizeValue(item, format)
+		}
+
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			result[fmt.Sprint(key)] = normalizeValue(item, format)
+		}
+
+		return result
+	case []map[string]interface{}:
+		if format == FormatHCL && len(typed) == 1 {
+			return normalizeValue(typed[0], format)
+		}
+
+		result := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			result[idx] = normalizeValue(item, format)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			result[idx] = normalizeValue(item, format)
+		}
+
+		return result
+	}
+
+	return value
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testParameterFiles = map[string]string{
+	"parameters.json": `{"image_name": "img", "worker_count": 2, "Labels": {"team": "hpc"}, "ports": [22, 80]}`,
+	"parameters.yaml": `# parameters of the team
+image_name: img
+worker_count: 2
+Labels:
+  team: hpc
+ports: [22, 80]
+`,
+	"parameters.toml": `image_name = "img"
+worker_count = 2
+ports = [22, 80]
+
+[Labels]
+team = "hpc"
+`,
+	"parameters.hcl": `image_name = "img"
+worker_count = 2
+ports = [22, 80]
+
+Labels {
+  team = "hpc"
+}
+`,
+}
+
+func TestCreateConfigFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := map[string]interface{}{
+		"image_name":   "img",
+		"worker_count": float64(2),
+		"Labels":       map[string]interface{}{"team": "hpc"},
+		"ports":        []interface{}{float64(22), float64(80)},
+	}
+
+	for name, content := range testParameterFiles {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile function returned error: [%s]", err)
+		}
+
+		conf, err := CreateConfigFromFile(path, "")
+		if err != nil {
+			t.Errorf("%s: CreateConfigFromFile function returned error: [%s]", name, err)
+			continue
+		}
+
+		for key, value := range expected {
+			if actual, err := conf.GetValue(key); err != nil || !reflect.DeepEqual(actual, value) {
+				t.Errorf("%s: wrong value of %s: [%v]!=[%v] [%v]", name, key, value, actual, err)
+			}
+		}
+
+		if labels, err := conf.GetStringMap("Labels"); err != nil || labels["team"] != "hpc" {
+			t.Errorf("%s: GetStringMap function returned wrong map: [%v] [%v]", name, labels, err)
+		}
+	}
+
+	yamlAsTxt := filepath.Join(dir, "parameters.txt")
+	if err := ioutil.WriteFile(yamlAsTxt, []byte(testParameterFiles["parameters.yaml"]), 0600); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	if _, err := CreateConfigFromFile(yamlAsTxt, ""); err == nil {
+		t.Errorf("YAML file with unknown extension was read as JSON")
+	}
+
+	if conf, err := CreateConfigFromFile(yamlAsTxt, FormatYAML); err != nil || !conf.IsSet("Labels") {
+		t.Errorf("YAML file with given format wasn't read: [%v]", err)
+	}
+
+	if _, err := CreateConfigFromFile(yamlAsTxt, "xml"); err == nil {
+		t.Errorf("CreateConfigFromFile function accepted unknown format")
+	}
+}
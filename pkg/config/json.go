@@ -1,12 +1,15 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 
 	"github.com/intel-go/viper"
 	log "github.com/sirupsen/logrus"
 
+	"enzyme/pkg/encryption"
 	"enzyme/pkg/storage"
 )
 
@@ -130,6 +133,15 @@ func (img_conf *jsonConfig) Serialize(configName string) error {
 		"configName": configName,
 	}).Info("jsonConfig.Serialization ...")
 
+	if encryption.Enabled() {
+		content, err := json.MarshalIndent(img_conf.data.AllSettings(), "", "  ")
+		if err != nil {
+			return err
+		}
+
+		return encryption.WriteFile(configName, content)
+	}
+
 	// TODO force option
 	return img_conf.data.WriteConfigAs(configName)
 }
@@ -141,7 +153,21 @@ func (img_conf *jsonConfig) Deserialize(configName string) error {
 
 	img_conf.data.SetConfigFile(configName)
 
-	return img_conf.data.ReadInConfig()
+	content, err := ioutil.ReadFile(configName)
+	if err != nil || !encryption.IsSealed(content) {
+		return img_conf.data.ReadInConfig()
+	}
+
+	plain, err := encryption.Open(content)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"configName": configName,
+		}).Errorf("jsonConfig.Deserialize: %s", err)
+
+		return err
+	}
+
+	return img_conf.data.ReadConfig(bytes.NewReader(plain))
 }
 
 func (img_conf *jsonConfig) DeserializeBytes(jsonContent []byte) error {
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/secret"
+)
+
+const (
+	// ReferenceEnv is the kind of references to environment variables, ${env:NAME}
+	ReferenceEnv = "env"
+	// ReferenceFile is the kind of references to contents of files, ${file:path}
+	ReferenceFile = "file"
+	// ReferenceCmd is the kind of references to output of shell commands, ${cmd:command}
+	ReferenceCmd = "cmd"
+	// ReferenceVar is the kind of references to other variables, ${var:name}
+	ReferenceVar = "var"
+)
+
+// referencePattern matches references, a reference prefixed by one more $ is kept as text without it
+var referencePattern = regexp.MustCompile(`\$?\$\{(env|file|cmd|var):([^}]*)\}`)
+
+// ResolveReferences replaces references in values of the variables by the values they refer to.
+// Values taken from environment variables, files and commands are secrets redacted from logs and
+// persisted state, whatever they are. Variables which aren't set are referred to by their defaults,
+// references to commands are resolved only if allowCommands is true.
+func ResolveReferences(variables Config, defaults map[string]interface{}, allowCommands bool) error {
+	resolver := referenceResolver{
+		variables:     variables,
+		defaults:      defaults,
+		allowCommands: allowCommands,
+		resolved:      map[string]interface{}{},
+		resolving:     map[string]bool{},
+	}
+
+	for _, name := range topLevelNames(variables) {
+		raw, err := variables.GetValue(name)
+		if err != nil {
+			return err
+		}
+
+		value, err := resolver.resolveVariable(name)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"variable": name,
+			}).Errorf("ResolveReferences: %s", err)
+
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if fmt.Sprint(value) != fmt.Sprint(raw) {
+			variables.SetValue(name, value)
+		}
+	}
+
+	return nil
+}
+
+type referenceResolver struct {
+	variables     Config
+	defaults      map[string]interface{}
+	allowCommands bool
+
+	resolved  map[string]interface{}
+	resolving map[string]bool
+}
+
+// resolveVariable returns the value of the variable with all references resolved
+func (resolver *referenceResolver) resolveVariable(name string) (interface{}, error) {
+	if value, ok := resolver.resolved[name]; ok {
+		return value, nil
+	}
+
+	if resolver.resolving[name] {
+		return nil, fmt.Errorf("variable %s refers to itself", name)
+	}
+
+	var raw interface{}
+
+	if resolver.variables.IsSet(name) {
+		var err error
+		if raw, err = resolver.variables.GetValue(name); err != nil {
+			return nil, err
+		}
+	} else if value, ok := resolver.defaults[name]; ok {
+		raw = value
+	} else {
+		return nil, fmt.Errorf("variable %s is not set", name)
+	}
+
+	resolver.resolving[name] = true
+	value, err := resolver.resolveValue(raw)
+	delete(resolver.resolving, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resolver.resolved[name] = value
+
+	return value, nil
+}
+
+func (resolver *referenceResolver) resolveValue(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case string:
+		return resolver.resolveString(typed)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+
+		for key, item := range typed {
+			resolvedItem, err := resolver.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = resolvedItem
+		}
+
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+
+		for idx, item := range typed {
+			resolvedItem, err := resolver.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			result[idx] = resolvedItem
+		}
+
+		return result, nil
+	}
+
+	return value, nil
+}
+
+func (resolver *referenceResolver) resolveString(text string) (string, error) {
+	var result strings.Builder
+
+	last := 0
+
+	for _, match := range referencePattern.FindAllStringSubmatchIndex(text, -1) {
+		result.WriteString(text[last:match[0]])
+		last = match[1]
+
+		if strings.HasPrefix(text[match[0]:], "$$") {
+			result.WriteString(text[match[0]+1 : match[1]])
+			continue
+		}
+
+		value, err := resolver.resolveReference(text[match[2]:match[3]], text[match[4]:match[5]])
+		if err != nil {
+			return "", err
+		}
+
+		result.WriteString(value)
+	}
+
+	result.WriteString(text[last:])
+
+	return result.String(), nil
+}
+
+func (resolver *referenceResolver) resolveReference(kind, argument string) (string, error) {
+	var value string
+
+	switch kind {
+	case ReferenceVar:
+		referred, err := resolver.resolveVariable(argument)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprint(referred), nil
+	case ReferenceEnv:
+		found := false
+		if value, found = os.LookupEnv(argument); !found {
+			return "", fmt.Errorf("environment variable %s is not set", argument)
+		}
+	case ReferenceFile:
+		content, err := ioutil.ReadFile(argument)
+		if err != nil {
+			return "", err
+		}
+
+		value = strings.TrimRight(string(content), "\r\n")
+	case ReferenceCmd:
+		if !resolver.allowCommands {
+			return "", fmt.Errorf("references to commands are not allowed: %s", argument)
+		}
+
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+
+		output, err := exec.Command(shell, flag, argument).Output()
+		if err != nil {
+			return "", fmt.Errorf("command %s failed: %w", argument, err)
+		}
+
+		value = strings.TrimRight(string(output), "\r\n")
+	}
+
+	// any of the sources may give keys and tokens, so their values are redacted alike;
+	// values of other variables are redacted if they were resolved from secrets
+	secret.Register(value)
+
+	return value, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"enzyme/pkg/secret"
+)
+
+func TestResolveReferences(t *testing.T) {
+	defer secret.Forget()
+
+	dir, err := ioutil.TempDir("", "config_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("key-from-file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	os.Setenv("ENZYME_TEST_PROJECT", "project-from-env")
+	defer os.Unsetenv("ENZYME_TEST_PROJECT")
+
+	variables := CreateJSONConfig()
+	variables.SetValue("project_name", "${env:ENZYME_TEST_PROJECT}")
+	variables.SetValue("key_name", "${file:"+keyFile+"}")
+	variables.SetValue("storage_name", "${var:cluster_name}-disk")
+	variables.SetValue("image_name", "$${var:cluster_name}")
+	variables.SetValue("labels", map[string]interface{}{"project": "${var:project_name}"})
+
+	defaults := map[string]interface{}{"cluster_name": "sample"}
+
+	if err := ResolveReferences(variables, defaults, false); err != nil {
+		t.Fatalf("ResolveReferences function returned error: [%s]", err)
+	}
+
+	for key, expected := range map[string]string{
+		"project_name":   "project-from-env",
+		"key_name":       "key-from-file",
+		"storage_name":   "sample-disk",
+		"image_name":     "${var:cluster_name}",
+		"labels.project": "project-from-env",
+	} {
+		if actual, err := variables.GetString(key); err != nil || actual != expected {
+			t.Errorf("wrong resolved value of %s: [%s]!=[%s] [%v]", key, expected, actual, err)
+		}
+	}
+
+	if !secret.Contains("project-from-env") || !secret.Contains("key-from-file") || secret.Contains("sample-disk") {
+		t.Errorf("wrong values are marked as secrets")
+	}
+
+	for reference, problem := range map[string]string{
+		"${cmd:echo token}":       "not allowed",
+		"${env:ENZYME_TEST_NONE}": "is not set",
+		"${var:user_name}":        "refers to itself",
+		"${var:unknown}":          "unknown is not set",
+	} {
+		wrong := CreateJSONConfig()
+		wrong.SetValue("user_name", reference)
+
+		if err := ResolveReferences(wrong, defaults, false); err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%s: wrong error: [%v]", reference, err)
+		}
+	}
+
+	command := CreateJSONConfig()
+	command.SetValue("key_name", "${cmd:echo token-from-cmd}")
+
+	if err := ResolveReferences(command, defaults, true); err != nil {
+		t.Fatalf("ResolveReferences function returned error: [%s]", err)
+	}
+
+	if actual, _ := command.GetString("key_name"); actual != "token-from-cmd" || !secret.Contains(actual) {
+		t.Errorf("wrong output of the command: [%s]", actual)
+	}
+}
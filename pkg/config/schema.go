@@ -0,0 +1,272 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TypeString is the type of text variables, numbers and booleans given for them are kept as text
+	TypeString = "string"
+	// TypeNumber is the type of numeric variables, numbers can be given as text and are kept as text
+	TypeNumber = "number"
+	// TypeBool is the type of boolean variables, "true" and "false" can be given as text and are kept as text
+	TypeBool = "bool"
+	// TypeList is the type of list variables
+	TypeList = "list"
+	// TypeMap is the type of object variables
+	TypeMap = "map"
+
+	// maxSuggestionDistance is how many edits a known name may differ by to be suggested for unknown one
+	maxSuggestionDistance = 2
+)
+
+// Types are types of variables
+var Types = []string{TypeString, TypeNumber, TypeBool, TypeList, TypeMap}
+
+// Variable describes a user variable
+type Variable struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Allowed     []string `json:"allowed,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	// Default is the value used if the variable isn't given, nil if there is none
+	Default interface{} `json:"-"`
+}
+
+// Schema describes all variables user can set by their names
+type Schema map[string]Variable
+
+// Names returns sorted names of known variables
+func (schema Schema) Names() []string {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Defaults returns default values of variables having them
+func (schema Schema) Defaults() map[string]interface{} {
+	defaults := map[string]interface{}{}
+
+	for name, variable := range schema {
+		if variable.Default != nil {
+			defaults[name] = variable.Default
+		}
+	}
+
+	return defaults
+}
+
+// Check validates values of the variables: names must be known, values must have the types of
+// variables and be allowed, required variables must be given. Values of numbers and booleans are
+// replaced by their text, e.g. 20 by "20": templates and stored states keep all scalar values as
+// text, so a value given either way makes the same object. All problems are reported at once.
+func (schema Schema) Check(variables Config) error {
+	problems := []string{}
+
+	names := topLevelNames(variables)
+
+	given := map[string]bool{}
+	for _, name := range names {
+		given[name] = true
+	}
+
+	for _, name := range names {
+		variable, ok := schema[name]
+		if !ok {
+			problem := fmt.Sprintf("unknown variable %s", name)
+			if suggestions := schema.suggest(name); len(suggestions) != 0 {
+				problem += fmt.Sprintf(", did you mean %s?", strings.Join(suggestions, " or "))
+			}
+
+			problems = append(problems, problem)
+
+			continue
+		}
+
+		value, err := variables.GetValue(name)
+		if err != nil {
+			continue
+		}
+
+		normalized, err := variable.normalize(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+
+		if variable.Type != TypeList && variable.Type != TypeMap {
+			variables.SetValue(name, normalized)
+		}
+	}
+
+	for _, name := range schema.Names() {
+		if schema[name].Required && !given[name] {
+			problems = append(problems, fmt.Sprintf("%s is required: %s", name, schema[name].Description))
+		}
+	}
+
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// topLevelNames returns sorted names of the variables, nested values are listed by Keys as dotted keys
+func topLevelNames(variables Config) []string {
+	given := map[string]bool{}
+	names := []string{}
+
+	for _, key := range variables.Keys() {
+		name := strings.SplitN(key, ".", 2)[0]
+		if !given[name] {
+			given[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// normalize checks the value has the type of the variable and is allowed,
+// it returns the value as it's passed to templates
+func (variable Variable) normalize(value interface{}) (interface{}, error) {
+	var normalized interface{}
+
+	switch variable.Type {
+	case TypeString, "":
+		switch typed := value.(type) {
+		case string:
+			normalized = typed
+		case float64:
+			normalized = strconv.FormatFloat(typed, 'f', -1, 64)
+		case bool:
+			normalized = strconv.FormatBool(typed)
+		default:
+			return nil, fmt.Errorf("expected %s, got %v", TypeString, value)
+		}
+	case TypeNumber:
+		switch typed := value.(type) {
+		case float64:
+			normalized = strconv.FormatFloat(typed, 'f', -1, 64)
+		case string:
+			if _, err := strconv.ParseFloat(strings.TrimSpace(typed), 64); err != nil {
+				return nil, fmt.Errorf("expected %s, got %q", TypeNumber, typed)
+			}
+
+			normalized = strings.TrimSpace(typed)
+		default:
+			return nil, fmt.Errorf("expected %s, got %v", TypeNumber, value)
+		}
+	case TypeBool:
+		switch typed := value.(type) {
+		case bool:
+			normalized = strconv.FormatBool(typed)
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(typed))
+			if err != nil {
+				return nil, fmt.Errorf("expected %s, got %q", TypeBool, typed)
+			}
+
+			normalized = strconv.FormatBool(parsed)
+		default:
+			return nil, fmt.Errorf("expected %s, got %v", TypeBool, value)
+		}
+	case TypeList:
+		if _, ok := value.([]interface{}); !ok {
+			return nil, fmt.Errorf("expected %s, got %v", TypeList, value)
+		}
+
+		return value, nil
+	case TypeMap:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("expected %s, got %v", TypeMap, value)
+		}
+
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unknown type %s of the variable", variable.Type)
+	}
+
+	if len(variable.Allowed) != 0 {
+		for _, allowed := range variable.Allowed {
+			if normalized == allowed {
+				return normalized, nil
+			}
+		}
+
+		return nil, fmt.Errorf("%v is not allowed, expected one of {%s}", normalized,
+			strings.Join(variable.Allowed, ", "))
+	}
+
+	return normalized, nil
+}
+
+// suggest returns known names close to the unknown one
+func (schema Schema) suggest(unknown string) []string {
+	best := maxSuggestionDistance + 1
+	result := []string{}
+
+	for _, name := range schema.Names() {
+		distance := editDistance(strings.ToLower(unknown), strings.ToLower(name))
+
+		switch {
+		case distance < best:
+			best = distance
+			result = []string{name}
+		case distance == best:
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+// editDistance returns Levenshtein distance between the strings
+func editDistance(first, second string) int {
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(second)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+var testSchema = Schema{
+	"worker_count":    {Type: TypeNumber, Description: "number of worker nodes"},
+	"image_name":      {Type: TypeString, Description: "name of the image", Required: true},
+	"preemptible":     {Type: TypeBool, Description: "use preemptible nodes"},
+	"machine_family":  {Type: TypeString, Description: "family of machines", Allowed: []string{"n1", "n2"}},
+	"action_timeouts": {Type: TypeMap, Description: "timeouts of actions"},
+}
+
+func TestSchemaCheck(t *testing.T) {
+	variables := CreateJSONConfig()
+	variables.SetValue("image_name", "img")
+	variables.SetValue("worker_count", float64(4))
+	variables.SetValue("preemptible", "True")
+	variables.SetValue("machine_family", "n2")
+	variables.SetValue("action_timeouts", map[string]interface{}{"create": "3h"})
+
+	if err := testSchema.Check(variables); err != nil {
+		t.Fatalf("Check function returned error: [%s]", err)
+	}
+
+	for key, expected := range map[string]string{"worker_count": "4", "preemptible": "true"} {
+		if actual, err := variables.GetValue(key); err != nil || actual != expected {
+			t.Errorf("wrong normalized value of %s: [%v]!=[%v] [%v]", key, expected, actual, err)
+		}
+	}
+
+	wrong := CreateJSONConfig()
+	wrong.SetValue("worker_cont", "4")
+	wrong.SetValue("preemptible", "maybe")
+	wrong.SetValue("machine_family", "e2")
+	wrong.SetValue("action_timeouts", "3h")
+
+	err := testSchema.Check(wrong)
+	if err == nil {
+		t.Fatalf("Check function accepted wrong variables")
+	}
+
+	for _, problem := range []string{
+		"unknown variable worker_cont, did you mean worker_count?",
+		"preemptible: expected bool",
+		"e2 is not allowed",
+		"action_timeouts: expected map",
+		"image_name is required",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("error [%s] doesn't report [%s]", err, problem)
+		}
+	}
+
+	unrelated := CreateJSONConfig()
+	unrelated.SetValue("image_name", "img")
+	unrelated.SetValue("labels", "x")
+
+	if err := testSchema.Check(unrelated); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("wrong suggestions for the unknown variable: [%v]", err)
+	}
+}
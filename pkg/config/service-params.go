@@ -1,8 +1,43 @@
 package config
 
+import "time"
+
 // ServiceParams is structure for handling user's parameters that
 // do not affect the final result of enzyme's commands
 type ServiceParams struct {
 	SocksProxyHost string
 	SocksProxyPort int
+	// TerraformBackend keeps terraform states of entities in a bucket when set
+	TerraformBackend *TerraformBackend
+	// ChangedVariables says what to do with stored objects made with other user variables
+	ChangedVariables ChangedVariablesPolicy
+	// ActionTimeouts override default timeouts of actions of the object and its prerequisites
+	// by the kind of action, they are given in the parameters file of the object
+	ActionTimeouts map[string]time.Duration
+}
+
+// ChangedVariablesPolicy says what to do with a stored object made with other user variables
+type ChangedVariablesPolicy int
+
+const (
+	// RefuseChangedVariables stops with the differences of variables if the object exists in the cloud,
+	// stored states of objects which don't exist are replaced
+	RefuseChangedVariables ChangedVariablesPolicy = iota
+	// AdoptChangedVariables keeps the existing object loaded with the requested variables,
+	// they are recorded when the object is saved
+	AdoptChangedVariables
+	// ReportChangedVariables reports the differences of variables of any stored object
+	// without changing it, it's used to show them
+	ReportChangedVariables
+)
+
+// TerraformBackend describes the bucket of an S3-compatible object store keeping terraform states,
+// credentials are taken by terraform from the environment
+type TerraformBackend struct {
+	// Endpoint is the URL of the store, empty means AWS S3 in Region
+	Endpoint string
+	Bucket   string
+	Region   string
+	// Prefix is prepended to keys of all states
+	Prefix string
 }
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FailurePolicy tells what happens to things moved by an execution which has failed
+type FailurePolicy int
+
+const (
+	// KeepOnFailure leaves things in statuses they have reached
+	KeepOnFailure FailurePolicy = iota
+	// RollbackOnFailure brings things back to statuses they had before the execution,
+	// or destroys them if the previous status cannot be reached
+	RollbackOnFailure
+	// DestroyCreatedOnFailure destroys things that had no cloud resources before the execution,
+	// things which existed before are kept
+	DestroyCreatedOnFailure
+)
+
+var failurePolicyNames = map[FailurePolicy]string{
+	KeepOnFailure:           "keep",
+	RollbackOnFailure:       "rollback",
+	DestroyCreatedOnFailure: "destroy-created",
+}
+
+func (policy FailurePolicy) String() string {
+	if name, ok := failurePolicyNames[policy]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// ParseFailurePolicy converts the name of a policy to FailurePolicy
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	for policy, known := range failurePolicyNames {
+		if known == name {
+			return policy, nil
+		}
+	}
+
+	return KeepOnFailure, fmt.Errorf("unknown failure policy %q, supported policies are {%s, %s, %s}",
+		name, KeepOnFailure, RollbackOnFailure, DestroyCreatedOnFailure)
+}
+
+// Destructible is implemented by things which can be destroyed, i.e. brought
+// to a status where they hold no cloud resources
+type Destructible interface {
+	GetDestroyedTarget() Target
+}
+
+// CompensationEvent describes what was done to a thing after the execution had failed
+type CompensationEvent struct {
+	Time    time.Time
+	Policy  string
+	Thing   string
+	ThingID string `json:",omitempty"`
+	// From is the status the thing had before the execution, Reached is the status it had
+	// when the execution failed and To is the status it was brought to
+	From    string
+	Reached string
+	To      string
+	// Kept is true if the policy doesn't touch the thing
+	Kept bool  `json:",omitempty"`
+	Err  error `json:"-"`
+}
+
+// CompensationObserver is an optional companion interface of Observer which gets notified
+// about every thing moved by a failed execution once its failure policy was applied
+type CompensationObserver interface {
+	Observer
+	ThingCompensated(event CompensationEvent)
+}
+
+// movedThing is a thing whose status was changed by the execution
+type movedThing struct {
+	thing Thing
+	from  Status
+}
+
+// recordMoved remembers the status the thing had before it was moved for the first time,
+// the latest object is kept as the same thing can be represented by several objects
+func (exec *executorState) recordMoved(thing Thing, from Status) {
+	for idx := range exec.moved {
+		if sameThing(exec.moved[idx].thing, thing) {
+			exec.moved[idx].thing = thing
+			return
+		}
+	}
+
+	exec.moved = append(exec.moved, movedThing{thing: thing, from: from})
+}
+
+// compensationTarget returns the target the moved thing should reach according to the policy,
+// false means the thing is kept as it is
+func compensationTarget(moved movedThing, policy FailurePolicy) (Target, bool) {
+	destructible, canDestroy := moved.thing.(Destructible)
+
+	switch policy {
+	case RollbackOnFailure:
+		target := Target{Thing: moved.thing, DesiredStatus: moved.from, MatchExact: true}
+		if _, err := buildStatusChains(moved.thing, moved.from, true, map[Status]bool{}); err == nil || !canDestroy {
+			return target, true
+		}
+		// e.g. there is no way back to "nothing", destroying is the closest we can get
+		return destructible.GetDestroyedTarget(), true
+	case DestroyCreatedOnFailure:
+		if !canDestroy {
+			return Target{}, false
+		}
+
+		target := destructible.GetDestroyedTarget()
+		// things which had no more than the destroyed status were created during the execution
+		if target.DesiredStatus.Satisfies(moved.from) {
+			return target, true
+		}
+	}
+
+	return Target{}, false
+}
+
+// compensate applies the failure policy to things moved by the execution, most recently moved
+// things go first so things depending on others are handled before them
+func (exec *executorState) compensate(ctx context.Context, policy FailurePolicy) {
+	moved := exec.moved
+	exec.moved = nil
+	// transitions failed while moving forward don't block moving back
+	exec.failed = nil
+
+	for idx := len(moved) - 1; idx >= 0; idx-- {
+		event := CompensationEvent{
+			Policy:  policy.String(),
+			Thing:   fmt.Sprintf("%s", moved[idx].thing),
+			ThingID: thingID(moved[idx].thing),
+			From:    fmt.Sprintf("%s", moved[idx].from),
+			Reached: fmt.Sprintf("%s", moved[idx].thing.Status()),
+		}
+
+		target, ok := compensationTarget(moved[idx], policy)
+		if ok {
+			event.To = fmt.Sprintf("%s", target.DesiredStatus)
+
+			log.WithFields(log.Fields{
+				"thing":  moved[idx].thing,
+				"target": target,
+				"policy": policy,
+			}).Info("compensate: moving thing back after failed execution")
+
+			if ctx.Err() != nil {
+				event.Err = interruptedError(ctx)
+			} else if results := exec.execute(ctx, []Target{target}); results[0].Err != nil {
+				event.Err = results[0].Err
+			}
+		} else {
+			event.Kept = true
+			event.To = event.Reached
+		}
+
+		if event.Err != nil {
+			log.WithFields(log.Fields{
+				"thing":  moved[idx].thing,
+				"policy": policy,
+			}).Errorf("compensate: cannot move thing back: %s", event.Err)
+		}
+
+		event.Time = time.Now()
+		exec.notify(func(observer Observer) {
+			if casted, ok := observer.(CompensationObserver); ok {
+				casted.ThingCompensated(event)
+			}
+		})
+	}
+}
@@ -1 +1,693 @@
 package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard) // logs hide
+}
+
+func TestJournal(t *testing.T) {
+	dirTempFolder, errTempDir := ioutil.TempDir("", "controller_unit_tests_temp")
+	if errTempDir != nil {
+		t.Fatalf("TempDir function returned error: [%s]", errTempDir)
+	}
+	defer os.RemoveAll(dirTempFolder)
+
+	path := filepath.Join(dirTempFolder, "run.jsonl")
+
+	journal, err := OpenJournal("test-run", path)
+	if err != nil {
+		t.Fatalf("OpenJournal function returned error: [%s]", err)
+	}
+
+	journal.RecordInvocation([]string{"create", "cluster"})
+	journal.write(JournalRecord{Event: JournalStarted, Thing: "first", Action: "spawn", From: "a", To: "b"})
+	journal.write(JournalRecord{Event: JournalStarted, Thing: "second", Action: "spawn", From: "a", To: "b"})
+	journal.write(JournalRecord{Event: JournalCompleted, Thing: "first", Action: "spawn", From: "a", To: "b"})
+
+	if err := journal.Close(); err != nil {
+		t.Errorf("Close method returned error: [%s]", err)
+	}
+
+	records, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("ReadJournal function returned error: [%s]", err)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("wrong number of journal records: [4]!=[%d]", len(records))
+	}
+
+	if records[0].Event != JournalInvocation || len(records[0].Args) != 2 {
+		t.Errorf("invocation record wasn't restored: [%v]", records[0])
+	}
+
+	unfinished := UnfinishedTransitions(records)
+	if len(unfinished) != 1 || unfinished[0].Thing != "second" {
+		t.Errorf("wrong unfinished transitions: [%v]", unfinished)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var journal *Journal
+
+	journal.RecordInvocation([]string{"run"})
+	journal.recordFinished(nil)
+
+	if err := journal.Close(); err != nil {
+		t.Errorf("Close method of nil journal returned error: [%s]", err)
+	}
+}
+
+type testStatus int
+
+const (
+	testNothing testStatus = iota
+	testDone
+	testHalfway
+)
+
+func (s testStatus) Satisfies(other Status) bool {
+	return s.Equals(other)
+}
+
+func (s testStatus) Equals(other Status) bool {
+	casted, ok := other.(testStatus)
+	return ok && s == casted
+}
+
+func (s testStatus) String() string {
+	switch s {
+	case testDone:
+		return "done"
+	case testHalfway:
+		return "halfway"
+	}
+
+	return "nothing"
+}
+
+type testThing struct {
+	name    string
+	status  Status
+	prereqs []Target
+	failing bool
+	applied int
+	// reversible things can go back from done to nothing
+	reversible bool
+	resource   string
+}
+
+func (thing *testThing) String() string {
+	return thing.name
+}
+
+func (thing *testThing) Status() Status {
+	return thing.status
+}
+
+func (thing *testThing) SetStatus(status Status) error {
+	thing.status = status
+	return nil
+}
+
+func (thing *testThing) GetTransitions(to Status) ([]Status, error) {
+	if to.Equals(testDone) {
+		return []Status{testNothing}, nil
+	}
+
+	if to.Equals(testNothing) && thing.reversible {
+		return []Status{testDone}, nil
+	}
+
+	return []Status{}, nil
+}
+
+func (thing *testThing) GetAction(current Status, target Status) (Action, error) {
+	return testAction{thing: thing}, nil
+}
+
+func (thing *testThing) Equals(other Thing) bool {
+	casted, ok := other.(*testThing)
+	return ok && thing == casted
+}
+
+type testAction struct {
+	thing *testThing
+}
+
+func (action testAction) String() string {
+	return fmt.Sprintf("Make %s", action.thing.name)
+}
+
+func (action testAction) Apply(ctx context.Context) error {
+	action.thing.applied++
+	if action.thing.failing {
+		return fmt.Errorf("%s failed", action.thing.name)
+	}
+
+	return nil
+}
+
+func (action testAction) IsExclusive() bool {
+	return false
+}
+
+func (action testAction) ResourceClass() string {
+	return action.thing.resource
+}
+
+func (action testAction) Prerequisites() ([]Target, error) {
+	return action.thing.prereqs, nil
+}
+
+func TestPlan(t *testing.T) {
+	first := &testThing{name: "first", status: testNothing}
+	second := &testThing{name: "second", status: testNothing}
+	last := &testThing{name: "last", status: testNothing, prereqs: []Target{
+		{Thing: first, DesiredStatus: testDone},
+		{Thing: second, DesiredStatus: testDone},
+	}}
+
+	plan := NewPlan()
+
+	err := ReachTarget(context.Background(), last, testDone, ExecOptions{Simulate: true, Plan: plan})
+	if err != nil {
+		t.Fatalf("ReachTarget function returned error: [%s]", err)
+	}
+
+	if len(plan.Things) != 3 || len(plan.Actions) != 3 {
+		t.Fatalf("wrong number of planned things and actions: [3, 3]!=[%d, %d]", len(plan.Things), len(plan.Actions))
+	}
+
+	if plan.Actions[0].Group != plan.Actions[1].Group {
+		t.Errorf("independent actions aren't in the same parallel group: [%v] [%v]", plan.Actions[0], plan.Actions[1])
+	}
+
+	lastAction := plan.Actions[2]
+	if lastAction.Group == plan.Actions[0].Group {
+		t.Errorf("dependent action is in the same parallel group as its prerequisites: [%v]", lastAction)
+	}
+
+	if len(lastAction.Prerequisites) != 2 || lastAction.Prerequisites[0].Action < 0 ||
+		lastAction.Prerequisites[1].Action < 0 {
+		t.Errorf("prerequisites aren't linked to actions reaching them: [%v]", lastAction.Prerequisites)
+	}
+
+	var jsonBuf, dotBuf bytes.Buffer
+
+	if err := plan.WriteJSON(&jsonBuf); err != nil {
+		t.Errorf("WriteJSON method returned error: [%s]", err)
+	}
+
+	restored := Plan{}
+	if err := json.Unmarshal(jsonBuf.Bytes(), &restored); err != nil || len(restored.Actions) != 3 {
+		t.Errorf("cannot restore plan from JSON: [%v] [%s]", err, jsonBuf.String())
+	}
+
+	if err := plan.WriteDOT(&dotBuf); err != nil {
+		t.Errorf("WriteDOT method returned error: [%s]", err)
+	}
+
+	if !strings.HasPrefix(dotBuf.String(), "digraph plan {") || !strings.Contains(dotBuf.String(), "rank=same") {
+		t.Errorf("unexpected DOT output: [%s]", dotBuf.String())
+	}
+}
+
+type testFlakyAction struct {
+	testAction
+	failures int
+	attempts *int
+}
+
+func (action testFlakyAction) Apply(ctx context.Context) error {
+	*action.attempts++
+	if *action.attempts <= action.failures {
+		return fmt.Errorf("transient failure %d", *action.attempts)
+	}
+
+	return nil
+}
+
+func (action testFlakyAction) RetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3}
+}
+
+func (action testFlakyAction) ShouldRetry(err error) bool {
+	return true
+}
+
+func TestRetryableAction(t *testing.T) {
+	tests := []struct {
+		failures int
+		fails    bool
+	}{
+		{0, false},
+		{2, false},
+		{3, true},
+	}
+
+	for _, test := range tests {
+		attempts := 0
+		thing := &testThing{name: "flaky", status: testNothing}
+		exec := executorState{done: make(chan executorTaskState)}
+		task := &transition{
+			target: Target{Thing: thing, DesiredStatus: testDone},
+			action: testFlakyAction{testAction: testAction{thing: thing}, failures: test.failures, attempts: &attempts},
+		}
+
+		err := exec.applyTask(context.Background(), task)
+		if (err != nil) != test.fails {
+			t.Errorf("unexpected result of action failing %d times: [%v]", test.failures, err)
+		}
+
+		if expected := test.failures + 1; !test.fails && attempts != expected {
+			t.Errorf("wrong number of attempts: [%d]!=[%d]", expected, attempts)
+		}
+	}
+}
+
+type testHangingAction struct {
+	testAction
+}
+
+func (action testHangingAction) Apply(ctx context.Context) error {
+	<-ctx.Done()
+	return fmt.Errorf("hanging action stopped: %w", ctx.Err())
+}
+
+type testTimedThing struct {
+	*testThing
+	timeouts map[string]time.Duration
+}
+
+func (thing testTimedThing) ActionTimeouts() map[string]time.Duration {
+	return thing.timeouts
+}
+
+func TestActionTimeout(t *testing.T) {
+	thing := &testThing{name: "hanging", status: testNothing}
+	action := testHangingAction{testAction: testAction{thing: thing}}
+	exec := executorState{
+		done:     make(chan executorTaskState),
+		timeouts: map[string]time.Duration{ActionKind(action): 10 * time.Millisecond},
+	}
+	task := &transition{
+		target: Target{Thing: thing, DesiredStatus: testDone},
+		action: action,
+	}
+
+	if kind := ActionKind(action); kind != "controller.testHangingAction" {
+		t.Errorf("wrong action kind: [controller.testHangingAction]!=[%s]", kind)
+	}
+
+	var timeoutErr *TimeoutError
+
+	err := exec.applyOnce(context.Background(), task)
+	if !errors.As(err, &timeoutErr) || timeoutErr.Deadline {
+		t.Errorf("action wasn't stopped by its timeout: [%v]", err)
+	}
+
+	exec.timeouts = map[string]time.Duration{ActionKind(action): time.Hour}
+	task.target.Thing = testTimedThing{thing, map[string]time.Duration{ActionKind(action): 10 * time.Millisecond}}
+
+	err = exec.applyOnce(context.Background(), task)
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout != 10*time.Millisecond {
+		t.Errorf("action wasn't stopped by the timeout of its thing: [%v]", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	exec.timeouts = nil
+	task.target.Thing = thing
+
+	err = exec.applyOnce(ctx, task)
+	if !errors.As(err, &timeoutErr) || !timeoutErr.Deadline {
+		t.Errorf("action wasn't stopped by execution deadline: [%v]", err)
+	}
+}
+
+func TestObservers(t *testing.T) {
+	first := &testThing{name: "first", status: testNothing}
+	last := &testThing{name: "last", status: testNothing, prereqs: []Target{{Thing: first, DesiredStatus: testDone}}}
+
+	var consoleBuf, jsonBuf bytes.Buffer
+
+	err := ReachTarget(context.Background(), last, testDone, ExecOptions{
+		Simulate:  true,
+		Observers: []Observer{NewConsoleObserver(&consoleBuf), NewJSONObserver(&jsonBuf)},
+	})
+	if err != nil {
+		t.Fatalf("ReachTarget function returned error: [%s]", err)
+	}
+
+	expectedConsole := "simulating:\tMake first\nsimulated:\tMake first\nsimulating:\tMake last\nsimulated:\tMake last\n"
+	if consoleBuf.String() != expectedConsole {
+		t.Errorf("unexpected console output: [%s]!=[%s]", expectedConsole, consoleBuf.String())
+	}
+
+	events := []string{}
+
+	for _, line := range strings.Split(strings.TrimSpace(jsonBuf.String()), "\n") {
+		var record struct {
+			Event string
+			Thing string
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("cannot parse JSON progress line [%s]: [%s]", line, err)
+		}
+
+		events = append(events, record.Event+":"+record.Thing)
+	}
+
+	expectedEvents := "planned:last planned:first started:first completed:first started:last completed:last"
+	if strings.Join(events, " ") != expectedEvents {
+		t.Errorf("unexpected JSON progress events: [%s]!=[%s]", expectedEvents, strings.Join(events, " "))
+	}
+}
+
+func TestReachTargets(t *testing.T) {
+	shared := &testThing{name: "shared", status: testNothing}
+	first := &testThing{name: "first", status: testNothing, prereqs: []Target{{Thing: shared, DesiredStatus: testDone}}}
+	second := &testThing{name: "second", status: testNothing, prereqs: []Target{{Thing: shared, DesiredStatus: testDone}}}
+	broken := &testThing{name: "broken", status: testNothing, failing: true}
+	dependent := &testThing{name: "dependent", status: testNothing, prereqs: []Target{{Thing: broken, DesiredStatus: testDone}}}
+
+	targets := []Target{
+		{Thing: first, DesiredStatus: testDone},
+		{Thing: dependent, DesiredStatus: testDone},
+		{Thing: second, DesiredStatus: testDone},
+	}
+
+	results, err := ReachTargets(context.Background(), targets, ExecOptions{})
+	if err == nil {
+		t.Errorf("ReachTargets function didn't report the failed target")
+	}
+
+	if len(results) != len(targets) {
+		t.Fatalf("wrong number of results: [%d]!=[%d]", len(targets), len(results))
+	}
+
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("independent targets weren't reached: [%v] [%v]", results[0].Err, results[2].Err)
+	}
+
+	if results[1].Err == nil || dependent.applied != 0 {
+		t.Errorf("target depending on failed action was reached: [%v]", results[1])
+	}
+
+	if shared.applied != 1 || broken.applied != 1 {
+		t.Errorf("actions were applied wrong number of times: shared [1]!=[%d], broken [1]!=[%d]",
+			shared.applied, broken.applied)
+	}
+
+	_, err = ReachTargets(context.Background(), []Target{targets[0], targets[0]}, ExecOptions{})
+	if err == nil {
+		t.Errorf("ReachTargets function accepted the same thing twice")
+	}
+}
+
+type costlyThing struct {
+	*testThing
+	costs map[[2]Status]Cost
+}
+
+func (thing *costlyThing) EstimatedCost(from, to Status) (Cost, bool) {
+	cost, ok := thing.costs[[2]Status{from, to}]
+	return cost, ok
+}
+
+func TestChooseChain(t *testing.T) {
+	direct := []Status{testNothing, testDone}
+	detour := []Status{testNothing, testHalfway, testDone}
+	chains := [][]Status{detour, direct}
+
+	thing := &costlyThing{
+		testThing: &testThing{name: "costly", status: testNothing},
+		costs: map[[2]Status]Cost{
+			{testNothing, testDone}:    {Duration: 30 * time.Minute, InstanceTime: time.Minute},
+			{testNothing, testHalfway}: {Duration: 5 * time.Minute, InstanceTime: 10 * time.Minute},
+			{testHalfway, testDone}:    {Duration: 5 * time.Minute, InstanceTime: 10 * time.Minute},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		thing  Thing
+		metric CostMetric
+		chosen int
+	}{
+		{"shortest without estimates", thing.testThing, CostByTime, 1},
+		{"cheapest by time", thing, CostByTime, 0},
+		{"cheapest by money", thing, CostByMoney, 1},
+	}
+
+	for _, test := range tests {
+		choice := chooseChain(test.thing, chains, test.metric)
+		if choice.index != test.chosen {
+			t.Errorf("%s: wrong chain chosen: [%d]!=[%d], rationale: %s", test.name, test.chosen, choice.index,
+				choice.rationale)
+		}
+	}
+
+	delete(thing.costs, [2]Status{testHalfway, testDone})
+
+	if choice := chooseChain(thing, chains, CostByTime); choice.index != 1 || choice.costs != nil {
+		t.Errorf("partially estimated chains aren't compared by length: %v", choice)
+	}
+}
+
+type compensationRecorder struct {
+	*ConsoleObserver
+	events []CompensationEvent
+}
+
+func (recorder *compensationRecorder) ThingCompensated(event CompensationEvent) {
+	recorder.events = append(recorder.events, event)
+}
+
+func TestFailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy FailurePolicy
+		status Status
+		events int
+	}{
+		{KeepOnFailure, testDone, 0},
+		{RollbackOnFailure, testNothing, 1},
+		{DestroyCreatedOnFailure, testDone, 1},
+	}
+
+	for _, test := range tests {
+		first := &testThing{name: "first", status: testNothing, reversible: true}
+		broken := &testThing{name: "broken", status: testNothing, failing: true}
+		last := &testThing{name: "last", status: testNothing, prereqs: []Target{
+			{Thing: first, DesiredStatus: testDone},
+			{Thing: broken, DesiredStatus: testDone},
+		}}
+		recorder := &compensationRecorder{ConsoleObserver: NewConsoleObserver(ioutil.Discard)}
+
+		err := ReachTarget(context.Background(), last, testDone, ExecOptions{
+			Observers: []Observer{recorder},
+			OnFailure: test.policy,
+		})
+		if err == nil {
+			t.Errorf("%s: ReachTarget function didn't fail", test.policy)
+		}
+
+		if !first.Status().Equals(test.status) {
+			t.Errorf("%s: wrong status after failure: [%s]!=[%s]", test.policy, test.status, first.Status())
+		}
+
+		if len(recorder.events) != test.events {
+			t.Fatalf("%s: wrong number of compensation events: [%d]!=[%d]", test.policy, test.events,
+				len(recorder.events))
+		}
+
+		// test things are not destructible, so destroy-created policy keeps them
+		if test.events != 0 && recorder.events[0].Kept != (test.policy == DestroyCreatedOnFailure) {
+			t.Errorf("%s: wrong compensation event: %v", test.policy, recorder.events[0])
+		}
+	}
+}
+
+func TestValidateGraph(t *testing.T) {
+	statuses := []Status{testNothing, testDone}
+
+	valid := &testThing{name: "valid", reversible: true}
+	if problems := ValidateGraph(valid, statuses); len(problems) != 0 {
+		t.Errorf("problems found in valid graph: %v", problems)
+	}
+
+	// test things have actions for every pair of statuses but only reversible ones list
+	// the transition back from done to nothing
+	drifted := &testThing{name: "drifted"}
+	if problems := ValidateGraph(drifted, statuses); len(problems) != 1 {
+		t.Errorf("wrong problems found in graph with unlisted transition: %v", problems)
+	}
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxParallel int
+		limits      map[string]int
+		groups      int
+		waiting     int
+	}{
+		{"no limits", 0, nil, 1, 0},
+		{"max parallel", 2, nil, 2, 1},
+		{"resource limit", 0, map[string]int{"tool": 1}, 2, 1},
+		{"unlimited resource", 0, map[string]int{"other": 1}, 1, 0},
+	}
+
+	for _, test := range tests {
+		targets := []Target{}
+		for _, name := range []string{"first", "second", "third"} {
+			thing := &testThing{name: name, status: testNothing}
+			if name != "third" {
+				thing.resource = "tool"
+			}
+
+			targets = append(targets, Target{Thing: thing, DesiredStatus: testDone})
+		}
+
+		var out bytes.Buffer
+
+		plan := NewPlan()
+
+		_, err := ReachTargets(context.Background(), targets, ExecOptions{
+			Simulate:       true,
+			Plan:           plan,
+			Observers:      []Observer{NewConsoleObserver(&out)},
+			MaxParallel:    test.maxParallel,
+			ResourceLimits: test.limits,
+		})
+		if err != nil {
+			t.Errorf("%s: ReachTargets function failed: [%s]", test.name, err)
+		}
+
+		groups := map[int]bool{}
+		for _, action := range plan.Actions {
+			groups[action.Group] = true
+		}
+
+		if len(groups) != test.groups {
+			t.Errorf("%s: wrong number of parallel groups: [%d]!=[%d]", test.name, test.groups, len(groups))
+		}
+
+		if waiting := strings.Count(out.String(), "Waiting: "); waiting != test.waiting {
+			t.Errorf("%s: wrong number of waiting actions: [%d]!=[%d]", test.name, test.waiting, waiting)
+		}
+	}
+}
+
+type lockedThing struct {
+	*testThing
+	holder string
+	locked int
+}
+
+func (thing *lockedThing) Lock() (func(), error) {
+	if thing.holder != "" {
+		return nil, fmt.Errorf("%s is locked by %s", thing.name, thing.holder)
+	}
+
+	thing.locked++
+
+	return func() { thing.locked-- }, nil
+}
+
+func (thing *lockedThing) Equals(other Thing) bool {
+	casted, ok := other.(*lockedThing)
+	return ok && thing == casted
+}
+
+func TestLockable(t *testing.T) {
+	free := &lockedThing{testThing: &testThing{name: "free", status: testNothing}}
+	busy := &lockedThing{testThing: &testThing{name: "busy", status: testNothing}, holder: "another process"}
+
+	results, _ := ReachTargets(context.Background(), []Target{
+		{Thing: free, DesiredStatus: testDone},
+		{Thing: busy, DesiredStatus: testDone},
+	}, ExecOptions{})
+
+	if results[0].Err != nil || free.locked != 0 || free.applied != 1 {
+		t.Errorf("free thing wasn't locked, changed and unlocked: [%v], locked [%d], applied [%d]",
+			results[0].Err, free.locked, free.applied)
+	}
+
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "another process") || busy.applied != 0 {
+		t.Errorf("locked thing was changed: [%v], applied [%d]", results[1].Err, busy.applied)
+	}
+}
+
+// driftedThing is done according to its status, but its resources are gone
+type driftedThing struct {
+	*lockedThing
+	refreshed int
+}
+
+func (thing *driftedThing) Refresh(ctx context.Context) (Drift, error) {
+	thing.refreshed++
+
+	if thing.locked == 0 {
+		return Drift{}, fmt.Errorf("%s is refreshed without lock", thing.name)
+	}
+
+	drift := Drift{Stored: thing.status, Actual: thing.status}
+	if thing.status.Equals(testDone) {
+		drift.Actual, drift.Details = testNothing, "resources are deleted"
+	}
+
+	return drift, nil
+}
+
+func (thing *driftedThing) Reconcile(drift Drift) error {
+	return thing.SetStatus(drift.Actual)
+}
+
+func TestRefreshThing(t *testing.T) {
+	thing := &driftedThing{lockedThing: &lockedThing{testThing: &testThing{name: "drifted", status: testDone}}}
+
+	drift, err := RefreshThing(context.Background(), thing, false)
+	if err != nil || !drift.Drifted() || !drift.Fixable() || !thing.status.Equals(testDone) {
+		t.Errorf("drift is not found or is fixed without asking: [%v], drift %+v, status %s", err, drift,
+			thing.status)
+	}
+
+	drift, err = RefreshThing(context.Background(), thing, true)
+	if err != nil || !drift.Fixable() || !thing.status.Equals(testNothing) || thing.locked != 0 {
+		t.Errorf("drift is not fixed: [%v], drift %+v, status %s, locked %d", err, drift, thing.status,
+			thing.locked)
+	}
+
+	drift, err = RefreshThing(context.Background(), thing, true)
+	if err != nil || drift.Drifted() || drift.Fixable() {
+		t.Errorf("drift is found in fixed thing: [%v], drift %+v", err, drift)
+	}
+
+	busy := &driftedThing{lockedThing: &lockedThing{testThing: &testThing{name: "busy", status: testDone},
+		holder: "another process"}}
+	if _, err := RefreshThing(context.Background(), busy, true); err == nil || busy.refreshed != 0 {
+		t.Errorf("locked thing is refreshed: [%v], refreshed %d", err, busy.refreshed)
+	}
+
+	if _, err := RefreshThing(context.Background(), &testThing{name: "plain", status: testDone}, true); err == nil {
+		t.Errorf("thing without Refresher is refreshed")
+	}
+}
@@ -0,0 +1,42 @@
+// Package controllertest provides checks shared by tests of things managed by the controller
+package controllertest
+
+import (
+	"testing"
+
+	"enzyme/pkg/controller"
+)
+
+// Transition is a change of status expected from the status graph, empty Action means that
+// the thing must have no action for it
+type Transition struct {
+	From   controller.Status
+	To     controller.Status
+	Action string
+}
+
+// CheckStatusGraph validates the status graph of the thing and checks the actions it gives
+// for the transitions
+func CheckStatusGraph(t *testing.T, thing controller.Thing, statuses []controller.Status,
+	transitions []Transition) {
+	t.Helper()
+
+	for _, problem := range controller.ValidateGraph(thing, statuses) {
+		t.Errorf("status graph problem: [%s]", problem)
+	}
+
+	for _, transition := range transitions {
+		action, err := thing.GetAction(transition.From, transition.To)
+
+		switch {
+		case transition.Action == "" && err == nil:
+			t.Errorf("unexpected action for %s -> %s: [%s]", transition.From, transition.To,
+				controller.ActionKind(action))
+		case transition.Action != "" && err != nil:
+			t.Errorf("cannot get action for %s -> %s: [%s]", transition.From, transition.To, err)
+		case transition.Action != "" && controller.ActionKind(action) != transition.Action:
+			t.Errorf("wrong action for %s -> %s: [%s]!=[%s]", transition.From, transition.To,
+				transition.Action, controller.ActionKind(action))
+		}
+	}
+}
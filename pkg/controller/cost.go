@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cost is an estimate of how expensive a transition is
+type Cost struct {
+	// Duration is the wall-clock time the transition takes
+	Duration time.Duration
+	// InstanceTime is the billable time of cloud instances running during the transition,
+	// it stands for money as actual prices depend on the provider and instance types
+	InstanceTime time.Duration
+}
+
+func (cost Cost) add(other Cost) Cost {
+	return Cost{
+		Duration:     cost.Duration + other.Duration,
+		InstanceTime: cost.InstanceTime + other.InstanceTime,
+	}
+}
+
+func (cost Cost) String() string {
+	return fmt.Sprintf("~%s, %s of instance time", cost.Duration, cost.InstanceTime)
+}
+
+// CostEstimator is an optional companion interface of Thing which lets the planner choose
+// the cheapest status chain instead of the shortest one
+type CostEstimator interface {
+	Thing
+	// EstimatedCost returns the cost of transition between adjacent statuses, ok being false
+	// means the cost is unknown
+	EstimatedCost(from, to Status) (cost Cost, ok bool)
+}
+
+// CostMetric tells which part of the Cost is minimized when choosing a status chain
+type CostMetric int
+
+const (
+	// CostByTime chooses the chain which is done the soonest
+	CostByTime CostMetric = iota
+	// CostByMoney chooses the chain which keeps cloud instances running for the shortest time
+	CostByMoney
+)
+
+var costMetricNames = map[CostMetric]string{
+	CostByTime:  "time",
+	CostByMoney: "money",
+}
+
+func (metric CostMetric) String() string {
+	if name, ok := costMetricNames[metric]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// ParseCostMetric converts the name of a metric to CostMetric
+func ParseCostMetric(name string) (CostMetric, error) {
+	for metric, known := range costMetricNames {
+		if known == name {
+			return metric, nil
+		}
+	}
+
+	return CostByTime, fmt.Errorf("unknown cost metric %q, supported metrics are {%s, %s}",
+		name, CostByTime, CostByMoney)
+}
+
+// primary returns the part of the cost minimized by the metric, the other part breaks ties
+func (metric CostMetric) primary(cost Cost) (time.Duration, time.Duration) {
+	if metric == CostByMoney {
+		return cost.InstanceTime, cost.Duration
+	}
+
+	return cost.Duration, cost.InstanceTime
+}
+
+func (metric CostMetric) less(first, second Cost) bool {
+	firstMain, firstOther := metric.primary(first)
+	secondMain, secondOther := metric.primary(second)
+
+	if firstMain != secondMain {
+		return firstMain < secondMain
+	}
+
+	return firstOther < secondOther
+}
+
+// chainCost sums estimated costs of all transitions in the chain, ok is false
+// if the thing cannot estimate any of them
+func chainCost(thing Thing, chain []Status) (Cost, bool) {
+	estimator, ok := thing.(CostEstimator)
+	if !ok {
+		return Cost{}, false
+	}
+
+	total := Cost{}
+
+	for idx := 1; idx < len(chain); idx++ {
+		cost, ok := estimator.EstimatedCost(chain[idx-1], chain[idx])
+		if !ok {
+			return Cost{}, false
+		}
+
+		total = total.add(cost)
+	}
+
+	return total, true
+}
+
+// chainChoice is the result of choosing among status chains
+type chainChoice struct {
+	index int
+	// costs are estimates of every chain, nil if some of them are unknown
+	costs     []Cost
+	rationale string
+}
+
+// chooseChain picks the cheapest of full status chains (ending with the desired status) if costs
+// of all of them can be estimated, otherwise the shortest one; the earliest chain wins a tie
+func chooseChain(thing Thing, chains [][]Status, metric CostMetric) chainChoice {
+	choice := chainChoice{index: 0}
+
+	for idx, chain := range chains {
+		if len(chain) < len(chains[choice.index]) {
+			choice.index = idx
+		}
+	}
+
+	if len(chains) == 1 {
+		choice.rationale = "the only path"
+		return choice
+	}
+
+	costs := make([]Cost, 0, len(chains))
+
+	for _, chain := range chains {
+		cost, ok := chainCost(thing, chain)
+		if !ok {
+			choice.rationale = fmt.Sprintf("the shortest of %d paths, costs are not estimated", len(chains))
+			return choice
+		}
+
+		costs = append(costs, cost)
+	}
+
+	choice.index = 0
+
+	for idx := range chains {
+		if metric.less(costs[idx], costs[choice.index]) ||
+			(costs[idx] == costs[choice.index] && len(chains[idx]) < len(chains[choice.index])) {
+			choice.index = idx
+		}
+	}
+
+	rejected := []string{}
+
+	for idx, chain := range chains {
+		if idx != choice.index {
+			rejected = append(rejected, fmt.Sprintf("%s (%s)", strings.Join(statusStrings(chain), " -> "), costs[idx]))
+		}
+	}
+
+	choice.costs = costs
+	choice.rationale = fmt.Sprintf("the cheapest by %s (%s), rejected: %s", metric, costs[choice.index],
+		strings.Join(rejected, "; "))
+
+	return choice
+}
@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -19,6 +22,21 @@ type executorState struct {
 	constraints       []Target
 	done              chan executorTaskState
 	simulate          bool
+	observers         []Observer
+	planned           map[string]string // last status chain chosen for each thing
+	plan              *Plan
+	timeouts          map[string]time.Duration
+	failed            []failedTransition
+	costMetric        CostMetric
+	moved             []movedThing
+	maxParallel       int
+	resourceLimits    map[string]int
+	waiting           map[string]string // reason why a transition of each thing is queued
+}
+
+type failedTransition struct {
+	task *transition
+	err  error
 }
 
 func targetsConflict(t1, t2 Target) bool {
@@ -57,24 +75,48 @@ func (exec *executorState) canExecute(t *transition) bool {
 		}
 	}
 
+	if reason := exec.limitReached(t); reason != "" {
+		log.WithField("action", t.action).Infof("action is queued: %s", reason)
+		exec.notifyWaiting(t, reason)
+
+		return false
+	}
+
 	return true
 }
 
-func (exec *executorState) runTask(task *transition) {
+func (exec *executorState) runTask(ctx context.Context, task *transition) {
 	exec.running = append(exec.running, task.target.Thing)
 	exec.constraints = append(exec.constraints, task.prerequisites...)
 
+	task.thingName = fmt.Sprintf("%s", task.target.Thing)
+	task.actionName = fmt.Sprintf("%s", task.action)
+	delete(exec.waiting, thingKey(task.target.Thing))
+
+	task.started = time.Now()
+
 	if exec.simulate {
-		fmt.Printf("simulating:\t%s\n", task.action)
-	} else {
-		task.started = time.Now()
-		fmt.Printf("Starting: %s\n", task.action)
+		exec.plan.recordAction(task)
+	}
+
+	startEvent := transitionEvent(task, exec.simulate)
+	exec.notify(func(observer Observer) { observer.TransitionStarted(startEvent) })
+
+	if staged, ok := task.action.(StagedAction); ok {
+		staged.OnStageChange(func(stage string) {
+			event := transitionEvent(task, exec.simulate)
+			// stages are shown after a colon in action descriptions
+			event.Stage = strings.TrimPrefix(stage, ":")
+			exec.notify(func(observer Observer) { observer.StageChanged(event) })
+		})
 	}
 
+	lockErr := exec.lockThing(task)
+
 	go func() {
-		var err error = nil
-		if !exec.simulate {
-			err = task.action.Apply()
+		err := lockErr
+		if err == nil && !exec.simulate {
+			err = exec.applyTask(ctx, task)
 		}
 		result := executorTaskState{
 			task:       task,
@@ -87,7 +129,86 @@ func (exec *executorState) runTask(task *transition) {
 	exec.activeTransitions = append(exec.activeTransitions, *task)
 }
 
-func (exec *executorState) finishTask(result executorTaskState) error {
+// applyTask applies the action of the task, re-applying it after transient failures
+// if the action is a RetryableAction
+func (exec *executorState) applyTask(ctx context.Context, task *transition) error {
+	err := exec.applyOnce(ctx, task)
+
+	retryable, ok := task.action.(RetryableAction)
+	if !ok {
+		return err
+	}
+
+	policy := retryable.RetryPolicy()
+
+	for attempt := 1; err != nil && attempt < policy.MaxAttempts; attempt++ {
+		if ctx.Err() != nil || !retryable.ShouldRetry(err) {
+			return err
+		}
+
+		delay := policy.delay(attempt)
+
+		log.WithFields(log.Fields{
+			"action":  task.action,
+			"attempt": attempt,
+			"delay":   delay,
+		}).Warnf("applyTask: action failed with transient error, retrying: %s", err)
+
+		event := transitionEvent(task, exec.simulate)
+		event.Attempt, event.MaxAttempts, event.Delay, event.Err = attempt+1, policy.MaxAttempts, delay, err
+		exec.notify(func(observer Observer) { observer.TransitionRetrying(event) })
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		err = exec.applyOnce(ctx, task)
+	}
+
+	return err
+}
+
+// lockThing locks the thing of the task against other processes, re-reading its state
+// which could be changed by them
+func (exec *executorState) lockThing(task *transition) error {
+	lockable, ok := task.target.Thing.(Lockable)
+	if exec.simulate || !ok {
+		return nil
+	}
+
+	unlock, err := lockable.Lock()
+	if err != nil {
+		return err
+	}
+
+	task.unlock = unlock
+
+	if reloadable, ok := task.target.Thing.(Reloadable); ok {
+		if err := reloadable.Reload(); err != nil {
+			return err
+		}
+	}
+
+	if !task.target.Thing.Status().Equals(task.fromStatus) {
+		return fmt.Errorf("%s was changed by another process, its status is %s now",
+			task.thingName, task.target.Thing.Status())
+	}
+
+	return nil
+}
+
+func (exec *executorState) finishTask(ctx context.Context, result executorTaskState) error {
+	if result.task.unlock != nil {
+		// the lock is held until the new status is saved
+		defer result.task.unlock()
+	}
+
+	if staged, ok := result.task.action.(StagedAction); ok {
+		staged.OnStageChange(nil)
+	}
+
 	found := false
 
 	for idx, runner := range exec.running {
@@ -136,6 +257,8 @@ func (exec *executorState) finishTask(result executorTaskState) error {
 		}
 	}
 
+	var timeoutErr *TimeoutError
+
 	if result.err == nil {
 		if !result.task.target.Thing.Status().Equals(result.fromStatus) {
 			log.WithFields(log.Fields{
@@ -143,10 +266,12 @@ func (exec *executorState) finishTask(result executorTaskState) error {
 				"expected status": result.fromStatus,
 				"current status":  result.task.target.Thing.Status(),
 			}).Errorf("transition failed, unexpected current status")
-			fmt.Printf("Failed: %s [took %s]\n", result.task.action, time.Since(result.task.started))
 
-			return fmt.Errorf("unexpected current status (%v), expected %v",
+			err := fmt.Errorf("unexpected current status (%v), expected %v",
 				result.task.target.Thing.Status(), result.fromStatus)
+			exec.notifyFailed(result.task, err, false, false)
+
+			return err
 		}
 
 		if err := result.task.target.Thing.SetStatus(result.task.target.DesiredStatus); err != nil {
@@ -154,28 +279,48 @@ func (exec *executorState) finishTask(result executorTaskState) error {
 				"thing":          result.task.target.Thing,
 				"desired status": result.task.target.DesiredStatus,
 			}).Errorf("cannot set status: %s", err)
-			fmt.Printf("Failed: %s [took %s]\n", result.task.action, time.Since(result.task.started))
+			exec.notifyFailed(result.task, err, false, false)
 
 			return err
 		}
 
-		if exec.simulate {
-			fmt.Printf("simulated:\t%s\n", result.task.action)
-		} else {
-			fmt.Printf("Complete: %s [took %s]\n", result.task.action, time.Since(result.task.started))
-		}
+		exec.recordMoved(result.task.target.Thing, result.fromStatus)
+
+		event := transitionEvent(result.task, exec.simulate)
+		exec.notify(func(observer Observer) { observer.TransitionCompleted(event) })
+	} else if errors.Is(ctx.Err(), context.Canceled) {
+		log.WithFields(log.Fields{
+			"thing":          result.task.target.Thing,
+			"desired status": result.task.target.DesiredStatus,
+		}).Warnf("transition interrupted: %s", result.err)
+		exec.notifyFailed(result.task, result.err, true, false)
+	} else if errors.As(result.err, &timeoutErr) {
+		log.WithFields(log.Fields{
+			"thing":          result.task.target.Thing,
+			"desired status": result.task.target.DesiredStatus,
+			"timeout":        timeoutErr.Timeout,
+		}).Errorf("transition timed out: %s", result.err)
+		exec.notifyFailed(result.task, result.err, false, true)
 	} else {
 		log.WithFields(log.Fields{
 			"thing":          result.task.target.Thing,
 			"desired status": result.task.target.DesiredStatus,
 		}).Errorf("transition failed: %s", result.err)
-		fmt.Printf("Failed: %s [took %s]\n", result.task.action, time.Since(result.task.started))
+		exec.notifyFailed(result.task, result.err, false, false)
 	}
 
 	return result.err
 }
 
+func (exec *executorState) notifyFailed(task *transition, err error, interrupted, timedOut bool) {
+	event := transitionEvent(task, exec.simulate)
+	event.Err, event.Interrupted, event.TimedOut = err, interrupted, timedOut
+	exec.notify(func(observer Observer) { observer.TransitionFailed(event) })
+}
+
 func (exec *executorState) waitForAny(ticker *time.Ticker) executorTaskState {
+	exec.plan.closeGroup()
+
 	if exec.simulate {
 		return <-exec.done
 	}
@@ -190,56 +335,138 @@ func (exec *executorState) waitForAny(ticker *time.Ticker) executorTaskState {
 		case res := <-exec.done:
 			return res
 		case <-ticker.C:
-			for _, transition := range exec.activeTransitions {
-				fmt.Printf("Running: %s [%s]\n", transition.action, time.Since(transition.started))
+			for idx := range exec.activeTransitions {
+				event := transitionEvent(&exec.activeTransitions[idx], exec.simulate)
+				exec.notify(func(observer Observer) { observer.TransitionRunning(event) })
 			}
 		}
 	}
 }
 
-func (exec *executorState) execute(target Target) error {
+func (exec *executorState) drainRunning(ctx context.Context, ticker *time.Ticker) {
+	for len(exec.running) != 0 {
+		taskResult := exec.waitForAny(ticker)
+
+		if err := exec.finishTask(ctx, taskResult); err != nil {
+			log.WithField("task", taskResult.task).Errorf("drainRunning: task failed: %s", err)
+		}
+	}
+}
+
+// failedBefore returns an error if the same transition has already failed during this execution,
+// so targets depending on it are not trying it again and again
+func (exec *executorState) failedBefore(task *transition) error {
+	for _, failed := range exec.failed {
+		if sameThing(failed.task.target.Thing, task.target.Thing) &&
+			failed.task.fromStatus.Equals(task.fromStatus) &&
+			failed.task.target.DesiredStatus.Equals(task.target.DesiredStatus) {
+			return fmt.Errorf("%s failed: %w", failed.task.actionName, failed.err)
+		}
+	}
+
+	return nil
+}
+
+// reloadTargets makes target things which are the same as the finished task's thing but are
+// different objects re-read their state, otherwise they would try to repeat the transition
+func (exec *executorState) reloadTargets(targets []Target, task *transition) {
+	for _, target := range targets {
+		if target.Thing == task.target.Thing || !sameThing(target.Thing, task.target.Thing) {
+			continue
+		}
+
+		if reloadable, ok := target.Thing.(Reloadable); ok {
+			if err := reloadable.Reload(); err != nil {
+				log.WithField("thing", target.Thing).Warnf("reloadTargets: cannot reload thing: %s", err)
+			}
+		}
+	}
+}
+
+func (exec *executorState) execute(ctx context.Context, targets []Target) []TargetResult {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
-	for !targetDone(target) {
-		candidate, err := exec.findTransition(target)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"target":   target,
-				"executor": exec,
-			}).Errorf("execute: cannot find a transition: %s", err)
+	results := make([]TargetResult, len(targets))
+	for idx, target := range targets {
+		results[idx].Target = target
+	}
 
-			return err
+	for {
+		if ctx.Err() != nil {
+			log.WithField("targets", targets).Warn("execute: execution cancelled, waiting for running actions")
+			exec.drainRunning(ctx, ticker)
+
+			for idx := range results {
+				if results[idx].Err == nil && !targetDone(targets[idx]) {
+					results[idx].Err = interruptedError(ctx)
+				}
+			}
+
+			return results
 		}
 
-		if candidate != nil {
-			log.WithFields(log.Fields{
-				"candidate": candidate,
-				"executor":  exec,
-			}).Info("execute: executing candidate")
-			exec.runTask(candidate)
-		} else {
-			if len(exec.running) == 0 {
-				return fmt.Errorf("execute: blocked execution - nothing runs but no candidate found")
+		pending, started := false, false
+
+		for idx, target := range targets {
+			if results[idx].Err != nil || targetDone(target) {
+				continue
 			}
 
-			taskResult := exec.waitForAny(ticker)
+			pending = true
 
-			if err := exec.finishTask(taskResult); err != nil {
-				// empty up running tasks
-				for len(exec.running) != 0 {
-					taskResult = exec.waitForAny(ticker)
+			candidate, err := exec.findTransition(target)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"target":   target,
+					"executor": exec,
+				}).Errorf("execute: cannot find a transition: %s", err)
 
-					if err := exec.finishTask(taskResult); err != nil {
-						log.WithField("task", taskResult.task.String).Fatalf(
-							"execute: finishTask failed: %s", err)
-					}
-				}
+				results[idx].Err = err
+
+				continue
+			}
+
+			if candidate != nil {
+				log.WithFields(log.Fields{
+					"candidate": candidate,
+					"executor":  exec,
+				}).Info("execute: executing candidate")
+				exec.runTask(ctx, candidate)
+
+				started = true
+			}
+		}
 
-				return err
+		if !pending {
+			break
+		}
+
+		if started {
+			continue
+		}
+
+		if len(exec.running) == 0 {
+			for idx, target := range targets {
+				if results[idx].Err == nil && !targetDone(target) {
+					results[idx].Err = fmt.Errorf("execute: blocked execution - nothing runs but no candidate found")
+				}
 			}
+
+			break
+		}
+
+		taskResult := exec.waitForAny(ticker)
+
+		if err := exec.finishTask(ctx, taskResult); err != nil {
+			exec.failed = append(exec.failed, failedTransition{task: taskResult.task, err: err})
+		} else {
+			exec.reloadTargets(targets, taskResult.task)
 		}
 	}
 
-	return nil
+	// targets could fail while independent actions are still running
+	exec.drainRunning(ctx, ticker)
+
+	return results
 }
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"fmt"
+)
+
+// GraphEdge is a transition between two statuses together with the kind of action performing it
+type GraphEdge struct {
+	From   Status
+	To     Status
+	Action string
+}
+
+// StatusGraph returns all transitions of the thing between given statuses as reported by GetTransitions
+func StatusGraph(thing Thing, allStatuses []Status) ([]GraphEdge, error) {
+	edges := []GraphEdge{}
+
+	for _, to := range allStatuses {
+		froms, err := thing.GetTransitions(to)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get transitions to %s: %w", to, err)
+		}
+
+		for _, from := range froms {
+			edge := GraphEdge{From: from, To: to}
+			if action, err := thing.GetAction(from, to); err == nil {
+				edge.Action = ActionKind(action)
+			}
+
+			edges = append(edges, edge)
+		}
+	}
+
+	return edges, nil
+}
+
+func hasStatus(statuses []Status, status Status) bool {
+	for _, known := range statuses {
+		if known.Equals(status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canReach tells if desired status is reachable from the given one by following the edges
+func canReach(edges []GraphEdge, from Status, desired Status, matchExact bool) bool {
+	visited := []Status{from}
+	queue := []Status{from}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if compareStatus(current, desired, matchExact) {
+			return true
+		}
+
+		for _, edge := range edges {
+			if edge.From.Equals(current) && !hasStatus(visited, edge.To) {
+				visited = append(visited, edge.To)
+				queue = append(queue, edge.To)
+			}
+		}
+	}
+
+	return false
+}
+
+// validateStatuses checks that Equals and Satisfies of statuses are consistent with each other
+func validateStatuses(allStatuses []Status) []error {
+	problems := []error{}
+
+	for _, first := range allStatuses {
+		if !first.Equals(first) || !first.Satisfies(first) {
+			problems = append(problems, fmt.Errorf("status %s doesn't equal or satisfy itself", first))
+		}
+
+		for _, second := range allStatuses {
+			if first.Equals(second) != second.Equals(first) {
+				problems = append(problems, fmt.Errorf("equality of %s and %s isn't symmetric", first, second))
+			}
+
+			if first.Equals(second) && !first.Satisfies(second) {
+				problems = append(problems, fmt.Errorf("status %s equals %s but doesn't satisfy it", first, second))
+			}
+
+			if !first.Satisfies(second) {
+				continue
+			}
+
+			for _, third := range allStatuses {
+				if second.Satisfies(third) && !first.Satisfies(third) {
+					problems = append(problems, fmt.Errorf(
+						"satisfaction isn't transitive: %s satisfies %s which satisfies %s", first, second, third))
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// ValidateGraph statically checks the status graph of the thing: every transition reported by
+// GetTransitions must have an action and vice versa, the destroyed target of Destructible things
+// must be reachable from every status, and statuses must be consistent in Equals and Satisfies.
+// The thing itself isn't changed, so it may be a zero value which was never loaded or saved.
+func ValidateGraph(thing Thing, allStatuses []Status) []error {
+	problems := validateStatuses(allStatuses)
+
+	edges, err := StatusGraph(thing, allStatuses)
+	if err != nil {
+		return append(problems, err)
+	}
+
+	for _, edge := range edges {
+		if !hasStatus(allStatuses, edge.From) {
+			problems = append(problems, fmt.Errorf("transition %s -> %s starts from unknown status", edge.From, edge.To))
+		}
+
+		if edge.Action == "" {
+			_, err := thing.GetAction(edge.From, edge.To)
+			problems = append(problems, fmt.Errorf("transition %s -> %s has no action: %s", edge.From, edge.To, err))
+		}
+	}
+
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			if from.Equals(to) {
+				continue
+			}
+
+			listed := false
+
+			for _, edge := range edges {
+				if edge.From.Equals(from) && edge.To.Equals(to) {
+					listed = true
+					break
+				}
+			}
+
+			if action, err := thing.GetAction(from, to); err == nil && !listed {
+				problems = append(problems, fmt.Errorf("action %s for %s -> %s isn't listed in transitions",
+					ActionKind(action), from, to))
+			}
+		}
+	}
+
+	if destructible, ok := thing.(Destructible); ok {
+		destroyed := destructible.GetDestroyedTarget()
+
+		for _, from := range allStatuses {
+			if !canReach(edges, from, destroyed.DesiredStatus, destroyed.MatchExact) {
+				problems = append(problems, fmt.Errorf("destroyed status %s cannot be reached from %s",
+					destroyed.DesiredStatus, from))
+			}
+		}
+	}
+
+	return problems
+}
@@ -1,7 +1,11 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // Status of a Thing, like "doesn't exist", "created", "spawned", etc.
@@ -12,7 +16,8 @@ type Status interface {
 
 // Action to be performed on a Thing to change its Status from one to other
 type Action interface {
-	Apply() error
+	// Apply performs the action; it should stop as soon as possible when ctx is cancelled
+	Apply(ctx context.Context) error
 	// IsExclusive() being true means the action can not be run in parallel with
 	// any other actions and that we shouldn't print "running..." messages.
 	// One example of such action is running a user application on remote cluster.
@@ -46,19 +51,141 @@ type Thing interface {
 	Equals(other Thing) bool
 }
 
+// Reloadable is an optional companion interface of Thing which keeps its state persistently,
+// it's used when the same persistent thing is represented by several objects
+type Reloadable interface {
+	// Reload re-reads the stored state of the thing
+	Reload() error
+}
+
+// Lockable is an optional companion interface of Thing whose state is shared by several
+// processes; the executor holds the lock while a transition of the thing is performed
+type Lockable interface {
+	// Lock acquires exclusive lock of the thing, returned function releases it
+	Lock() (unlock func(), err error)
+}
+
+// ExecOptions tune the way executor performs the actions
+type ExecOptions struct {
+	// Simulate being true means no actions are applied, only the statuses are changed
+	Simulate bool
+	// Observers get notified about progress of the execution
+	Observers []Observer
+	// Journal, if set, gets a record of every transition planned or performed
+	Journal *Journal
+	// Plan, if set, collects the graph of actions; it's only filled when simulating
+	Plan *Plan
+	// ActionTimeouts override default timeouts of actions by their ActionKind, zero means no limit
+	ActionTimeouts map[string]time.Duration
+	// Deadline, if not zero, is the time by which the whole execution must be done
+	Deadline time.Time
+	// CostMetric tells how to choose among status chains of things implementing CostEstimator
+	CostMetric CostMetric
+	// OnFailure tells what to do with things moved by the execution if some target isn't reached;
+	// things are not compensated if the execution was interrupted
+	OnFailure FailurePolicy
+	// MaxParallel limits the number of actions running at once, zero means no limit
+	MaxParallel int
+	// ResourceLimits limit the number of running actions by their ResourceClass, zero means no limit
+	ResourceLimits map[string]int
+}
+
 // ReachTarget plans and performs the execution of the graph so that given
 // Thing reaches desired status, e.g. cluster reaches "spawned" status.
-// Thing is considered done when its status Satisfies desired
-func ReachTarget(thing Thing, desiredStatus Status, simulate bool) error {
-	return ReachTargetEx(Target{thing, desiredStatus, false}, simulate)
+// Thing is considered done when its status Satisfies desired.
+// Cancelling ctx interrupts running actions and stops the execution.
+func ReachTarget(ctx context.Context, thing Thing, desiredStatus Status, opts ExecOptions) error {
+	return ReachTargetEx(ctx, Target{thing, desiredStatus, false}, opts)
 }
 
 // ReachTargetEx does the same as ReachTarget but gives more flexibility in composing the target
-func ReachTargetEx(target Target, simulate bool) error {
+func ReachTargetEx(ctx context.Context, target Target, opts ExecOptions) error {
+	_, err := ReachTargets(ctx, []Target{target}, opts)
+
+	return err
+}
+
+// TargetResult is the outcome of reaching one of the targets
+type TargetResult struct {
+	Target Target
+	// Err is nil if the target was reached
+	Err error
+}
+
+// ReachTargets plans and performs the execution for all targets at once: common prerequisites
+// are reached only once and independent actions run in parallel. Failure of one target doesn't
+// stop reaching targets which don't depend on the failed action. Returned error is nil only
+// if all targets were reached.
+func ReachTargets(ctx context.Context, targets []Target, opts ExecOptions) ([]TargetResult, error) {
+	for idx, target := range targets {
+		for _, other := range targets[:idx] {
+			if sameThing(target.Thing, other.Thing) {
+				return nil, fmt.Errorf("%s is given more than once", target.Thing)
+			}
+		}
+	}
+
+	// compensation must not be limited by the deadline the failed execution has possibly exceeded
+	runCtx := ctx
+
+	if !opts.Deadline.IsZero() {
+		var cancel context.CancelFunc
+
+		runCtx, cancel = context.WithDeadline(ctx, opts.Deadline)
+		defer cancel()
+	}
+
 	executor := executorState{
-		done:     make(chan executorTaskState),
-		simulate: simulate,
+		done:           make(chan executorTaskState),
+		simulate:       opts.Simulate,
+		observers:      append([]Observer{}, opts.Observers...),
+		planned:        make(map[string]string),
+		plan:           opts.Plan,
+		timeouts:       opts.ActionTimeouts,
+		costMetric:     opts.CostMetric,
+		maxParallel:    opts.MaxParallel,
+		resourceLimits: opts.ResourceLimits,
+		waiting:        make(map[string]string),
+	}
+
+	if opts.Journal != nil {
+		executor.observers = append(executor.observers, opts.Journal)
+	}
+
+	results := executor.execute(runCtx, targets)
+	err := summarizeResults(results)
+
+	if err != nil && opts.OnFailure != KeepOnFailure {
+		if ctx.Err() != nil {
+			log.WithField("policy", opts.OnFailure).Warn("ReachTargets: execution interrupted, failure policy isn't applied")
+		} else {
+			executor.compensate(ctx, opts.OnFailure)
+		}
+	}
+
+	opts.Journal.recordFinished(err)
+
+	return results, err
+}
+
+func summarizeResults(results []TargetResult) error {
+	var firstErr error
+
+	failed := 0
+
+	for _, result := range results {
+		if result.Err != nil {
+			if firstErr == nil {
+				firstErr = result.Err
+			}
+
+			failed++
+		}
+	}
+
+	if failed == 0 || len(results) == 1 {
+		return firstErr
 	}
 
-	return executor.execute(target)
+	return fmt.Errorf("%d of %d targets failed, first error: %w", failed, len(results), firstErr)
 }
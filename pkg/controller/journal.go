@@ -0,0 +1,298 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JournalEvent is a kind of record stored in the execution journal
+type JournalEvent string
+
+// Kinds of journal records
+const (
+	// JournalInvocation records the command line which started the run
+	JournalInvocation JournalEvent = "invocation"
+	// JournalResumed records that an interrupted run was picked up again
+	JournalResumed JournalEvent = "resumed"
+	// JournalPlanned records the status chain chosen for a thing
+	JournalPlanned JournalEvent = "planned"
+	// JournalStarted records that an action was started
+	JournalStarted JournalEvent = "started"
+	// JournalCompleted records that an action was finished and thing status was updated
+	JournalCompleted JournalEvent = "completed"
+	// JournalFailed records that an action was finished with an error
+	JournalFailed JournalEvent = "failed"
+	// JournalRetrying records that an action failed with a transient error and will be applied again
+	JournalRetrying JournalEvent = "retrying"
+	// JournalInterrupted records that an action was stopped because execution was cancelled
+	JournalInterrupted JournalEvent = "interrupted"
+	// JournalCompensated records what the failure policy did to a thing moved by failed execution
+	JournalCompensated JournalEvent = "compensated"
+	// JournalFinished records that executor has stopped, successfully or not
+	JournalFinished JournalEvent = "finished"
+)
+
+// JournalRecord is a single line of the execution journal
+type JournalRecord struct {
+	Time    time.Time
+	Event   JournalEvent
+	Args    []string `json:",omitempty"`
+	Thing   string   `json:",omitempty"`
+	ThingID string   `json:",omitempty"`
+	Action  string   `json:",omitempty"`
+	From    string   `json:",omitempty"`
+	To      string   `json:",omitempty"`
+	Chain   []string `json:",omitempty"`
+	Error   string   `json:",omitempty"`
+	// Rationale tells why the planned chain was chosen
+	Rationale string `json:",omitempty"`
+}
+
+func (rec JournalRecord) String() string {
+	return fmt.Sprintf("%s %s [%s: %s -> %s]", rec.Event, rec.Action, rec.Thing, rec.From, rec.To)
+}
+
+// Journal keeps an on-disk record of everything the executor planned and performed
+// during one invocation, so an interrupted run can be inspected and resumed.
+// All methods are no-op on nil Journal.
+type Journal struct {
+	RunID string
+
+	path string
+	file *os.File
+	enc  *json.Encoder
+	mux  sync.Mutex
+}
+
+type hierarchical interface {
+	Hierarchy() ([]string, error)
+}
+
+// thingID returns identifier of a thing as used by persistent state, or empty string
+// if the thing isn't persistent
+func thingID(thing Thing) string {
+	if hier, ok := thing.(hierarchical); ok {
+		if parts, err := hier.Hierarchy(); err == nil {
+			return strings.Join(parts, "/")
+		}
+	}
+
+	return ""
+}
+
+// OpenJournal opens (creating if needed) the journal of run with given ID at given path,
+// new records are appended to existing ones
+func OpenJournal(runID string, path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"run-id": runID,
+			"path":   path,
+		}).Errorf("OpenJournal: cannot open journal: %s", err)
+
+		return nil, err
+	}
+
+	return &Journal{
+		RunID: runID,
+		path:  path,
+		file:  file,
+		enc:   json.NewEncoder(file),
+	}, nil
+}
+
+// Close flushes and closes the journal
+func (journal *Journal) Close() error {
+	if journal == nil {
+		return nil
+	}
+
+	journal.mux.Lock()
+	defer journal.mux.Unlock()
+
+	return journal.file.Close()
+}
+
+func (journal *Journal) write(rec JournalRecord) {
+	if journal == nil {
+		return
+	}
+
+	journal.mux.Lock()
+	defer journal.mux.Unlock()
+
+	rec.Time = time.Now()
+
+	err := journal.enc.Encode(rec)
+	if err == nil {
+		// make sure the record survives a crash right after it was written
+		err = journal.file.Sync()
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":   journal.path,
+			"record": rec,
+		}).Warnf("Journal: cannot write record: %s", err)
+	}
+}
+
+// RecordInvocation stores the command line arguments which started the run
+func (journal *Journal) RecordInvocation(args []string) {
+	journal.write(JournalRecord{Event: JournalInvocation, Args: args})
+}
+
+// RecordResumed marks the point where an interrupted run was resumed
+func (journal *Journal) RecordResumed() {
+	journal.write(JournalRecord{Event: JournalResumed})
+}
+
+// TransitionPlanned records the chosen status chain
+func (journal *Journal) TransitionPlanned(event PlanEvent) {
+	journal.write(JournalRecord{
+		Event:     JournalPlanned,
+		Thing:     event.Thing,
+		ThingID:   event.ThingID,
+		Chain:     event.Chain,
+		Rationale: event.Rationale,
+	})
+}
+
+func (journal *Journal) recordTransition(kind JournalEvent, event TransitionEvent) {
+	if event.Simulated {
+		return
+	}
+
+	rec := JournalRecord{
+		Event:   kind,
+		Thing:   event.Thing,
+		ThingID: event.ThingID,
+		Action:  event.Action,
+		From:    event.From,
+		To:      event.To,
+	}
+	if event.Err != nil {
+		rec.Error = event.Err.Error()
+	}
+
+	journal.write(rec)
+}
+
+// TransitionStarted records that an action was started
+func (journal *Journal) TransitionStarted(event TransitionEvent) {
+	journal.recordTransition(JournalStarted, event)
+}
+
+// TransitionWaiting records nothing, queued transitions are recorded when started
+func (journal *Journal) TransitionWaiting(event TransitionEvent) {}
+
+// TransitionRunning records nothing
+func (journal *Journal) TransitionRunning(event TransitionEvent) {}
+
+// StageChanged records nothing
+func (journal *Journal) StageChanged(event TransitionEvent) {}
+
+// TransitionRetrying records that an action will be applied again
+func (journal *Journal) TransitionRetrying(event TransitionEvent) {
+	journal.recordTransition(JournalRetrying, event)
+}
+
+// TransitionCompleted records that an action was finished
+func (journal *Journal) TransitionCompleted(event TransitionEvent) {
+	journal.recordTransition(JournalCompleted, event)
+}
+
+// TransitionFailed records that an action failed or was interrupted
+func (journal *Journal) TransitionFailed(event TransitionEvent) {
+	if event.Interrupted {
+		journal.recordTransition(JournalInterrupted, event)
+	} else {
+		journal.recordTransition(JournalFailed, event)
+	}
+}
+
+// ThingCompensated records that failure policy was applied to a thing
+func (journal *Journal) ThingCompensated(event CompensationEvent) {
+	rec := JournalRecord{
+		Event:   JournalCompensated,
+		Thing:   event.Thing,
+		ThingID: event.ThingID,
+		Action:  event.Policy,
+		From:    event.Reached,
+		To:      event.To,
+	}
+	if event.Err != nil {
+		rec.Error = event.Err.Error()
+	}
+
+	journal.write(rec)
+}
+
+func (journal *Journal) recordFinished(err error) {
+	rec := JournalRecord{Event: JournalFinished}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	journal.write(rec)
+}
+
+// ReadJournal loads all records of the journal stored at given path
+func ReadJournal(path string) ([]JournalRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := []JournalRecord{}
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// last line could be cut short if enzyme died while writing it
+			log.WithFields(log.Fields{
+				"path": path,
+				"line": line,
+			}).Warnf("ReadJournal: skipping broken record: %s", err)
+
+			continue
+		}
+
+		result = append(result, rec)
+	}
+
+	return result, scanner.Err()
+}
+
+// UnfinishedTransitions returns "started" records which have no matching
+// "completed" or "failed" record, i.e. transitions that were interrupted
+// either gracefully or by a crash
+func UnfinishedTransitions(records []JournalRecord) []JournalRecord {
+	result := []JournalRecord{}
+
+	for _, rec := range records {
+		switch rec.Event {
+		case JournalStarted:
+			result = append(result, rec)
+		case JournalCompleted, JournalFailed:
+			for idx, started := range result {
+				if started.ThingID == rec.ThingID && started.Thing == rec.Thing &&
+					started.From == rec.From && started.To == rec.To {
+					result = append(result[:idx], result[idx+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+)
+
+// ResourceAction is an optional companion interface of Action which consumes a limited resource,
+// e.g. runs a tool which hits cloud API quotas or loads local CPU when many instances run at once
+type ResourceAction interface {
+	Action
+	// ResourceClass returns the name of the consumed resource like "terraform", empty name means none
+	ResourceClass() string
+}
+
+// ResourceClass returns the class of resource consumed by the action or empty string
+func ResourceClass(action Action) string {
+	if casted, ok := action.(ResourceAction); ok {
+		return casted.ResourceClass()
+	}
+
+	return ""
+}
+
+// thingKey identifies a thing for bookkeeping of the executor
+func thingKey(thing Thing) string {
+	if id := thingID(thing); id != "" {
+		return id
+	}
+
+	return fmt.Sprintf("%p", thing)
+}
+
+// limitReached returns the reason why the transition cannot start because of concurrency limits,
+// empty string means it can start
+func (exec *executorState) limitReached(t *transition) string {
+	if exec.maxParallel > 0 && len(exec.running) >= exec.maxParallel {
+		return fmt.Sprintf("limit of %d running actions reached", exec.maxParallel)
+	}
+
+	class := ResourceClass(t.action)
+	limit := exec.resourceLimits[class]
+
+	if class == "" || limit <= 0 {
+		return ""
+	}
+
+	count := 0
+
+	for idx := range exec.activeTransitions {
+		if ResourceClass(exec.activeTransitions[idx].action) == class {
+			count++
+		}
+	}
+
+	if count >= limit {
+		return fmt.Sprintf("limit of %d running %s actions reached", limit, class)
+	}
+
+	return ""
+}
+
+// notifyWaiting tells observers that the transition is queued, only once until the reason changes
+func (exec *executorState) notifyWaiting(t *transition, reason string) {
+	key := thingKey(t.target.Thing)
+	if exec.waiting[key] == reason {
+		return
+	}
+
+	exec.waiting[key] = reason
+
+	t.thingName = fmt.Sprintf("%s", t.target.Thing)
+	event := transitionEvent(t, exec.simulate)
+	event.WaitingFor = reason
+	exec.notify(func(observer Observer) { observer.TransitionWaiting(event) })
+}
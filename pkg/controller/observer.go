@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanEvent is sent when a status chain leading to desired status is chosen for a thing
+type PlanEvent struct {
+	Time    time.Time
+	Thing   string
+	ThingID string `json:",omitempty"`
+	Chain   []string
+	// Rationale tells why the chain was chosen among other possible ones
+	Rationale string `json:",omitempty"`
+}
+
+// TransitionEvent describes the state of a transition of a thing from one status to another
+type TransitionEvent struct {
+	Time time.Time
+	// Thing is the description of the thing captured when the transition was started
+	Thing   string
+	ThingID string `json:",omitempty"`
+	// Action is the current description of the action, it may include the stage
+	Action    string
+	Kind      string
+	From      string
+	To        string
+	Simulated bool `json:",omitempty"`
+	Started   time.Time
+	Elapsed   time.Duration
+	Stage     string `json:",omitempty"`
+
+	// Attempt and MaxAttempts are set for retries, Delay is the time before the next attempt
+	Attempt     int           `json:",omitempty"`
+	MaxAttempts int           `json:",omitempty"`
+	Delay       time.Duration `json:",omitempty"`
+
+	// WaitingFor is the reason why a queued transition cannot start yet
+	WaitingFor string `json:",omitempty"`
+
+	Err         error `json:"-"`
+	Interrupted bool  `json:",omitempty"`
+	TimedOut    bool  `json:",omitempty"`
+}
+
+// Observer gets notified about everything the executor plans and performs.
+// Methods can be called from different goroutines.
+type Observer interface {
+	TransitionPlanned(event PlanEvent)
+	// TransitionWaiting is sent when a transition could start but is queued because of concurrency limits
+	TransitionWaiting(event TransitionEvent)
+	TransitionStarted(event TransitionEvent)
+	// TransitionRunning is sent periodically while non-exclusive actions are running
+	TransitionRunning(event TransitionEvent)
+	StageChanged(event TransitionEvent)
+	TransitionRetrying(event TransitionEvent)
+	TransitionCompleted(event TransitionEvent)
+	// TransitionFailed is also sent for interrupted and timed out transitions
+	TransitionFailed(event TransitionEvent)
+}
+
+// StagedAction is an optional companion interface of Action which goes through named stages
+type StagedAction interface {
+	Action
+	// OnStageChange registers a function called every time the action enters another stage,
+	// nil removes the registered function
+	OnStageChange(callback func(stage string))
+}
+
+// ConsoleObserver prints human readable progress messages
+type ConsoleObserver struct {
+	out io.Writer
+}
+
+// NewConsoleObserver creates an observer printing progress to out
+func NewConsoleObserver(out io.Writer) *ConsoleObserver {
+	return &ConsoleObserver{out: out}
+}
+
+func (console *ConsoleObserver) printf(format string, args ...interface{}) {
+	if _, err := fmt.Fprintf(console.out, format, args...); err != nil {
+		log.Warnf("ConsoleObserver: cannot print progress: %s", err)
+	}
+}
+
+// TransitionPlanned prints nothing, chains are in the logs
+func (console *ConsoleObserver) TransitionPlanned(event PlanEvent) {}
+
+// TransitionWaiting prints that an action is queued
+func (console *ConsoleObserver) TransitionWaiting(event TransitionEvent) {
+	console.printf("Waiting: %s [%s]\n", event.Action, event.WaitingFor)
+}
+
+// TransitionStarted prints that an action was started
+func (console *ConsoleObserver) TransitionStarted(event TransitionEvent) {
+	if event.Simulated {
+		console.printf("simulating:\t%s\n", event.Action)
+	} else {
+		console.printf("Starting: %s\n", event.Action)
+	}
+}
+
+// TransitionRunning prints that an action is still running
+func (console *ConsoleObserver) TransitionRunning(event TransitionEvent) {
+	console.printf("Running: %s [%s]\n", event.Action, event.Elapsed)
+}
+
+// StageChanged prints nothing, the stage is shown as a part of action description
+func (console *ConsoleObserver) StageChanged(event TransitionEvent) {}
+
+// TransitionRetrying prints that an action failed and will be applied again
+func (console *ConsoleObserver) TransitionRetrying(event TransitionEvent) {
+	console.printf("Retrying: %s [attempt %d of %d in %s]: %s\n", event.Action, event.Attempt, event.MaxAttempts,
+		event.Delay, event.Err)
+}
+
+// TransitionCompleted prints that an action was finished
+func (console *ConsoleObserver) TransitionCompleted(event TransitionEvent) {
+	if event.Simulated {
+		console.printf("simulated:\t%s\n", event.Action)
+	} else {
+		console.printf("Complete: %s [took %s]\n", event.Action, event.Elapsed)
+	}
+}
+
+// TransitionFailed prints that an action failed, was interrupted or timed out
+func (console *ConsoleObserver) TransitionFailed(event TransitionEvent) {
+	switch {
+	case event.Interrupted:
+		console.printf("Interrupted: %s [took %s]\n", event.Action, event.Elapsed)
+	case event.TimedOut:
+		console.printf("Timed out: %s [took %s]\n", event.Action, event.Elapsed)
+	default:
+		console.printf("Failed: %s [took %s]\n", event.Action, event.Elapsed)
+	}
+}
+
+// ThingCompensated prints a line of the summary of applying the failure policy
+func (console *ConsoleObserver) ThingCompensated(event CompensationEvent) {
+	verb := "Rolled back"
+	if event.Policy == DestroyCreatedOnFailure.String() {
+		verb = "Destroyed"
+	}
+
+	switch {
+	case event.Kept:
+		console.printf("Kept: %s [%s]\n", event.Thing, event.Reached)
+	case event.Err != nil:
+		console.printf("Not %s: %s [%s -> %s]: %s\n", strings.ToLower(verb), event.Thing, event.Reached, event.To,
+			event.Err)
+	default:
+		console.printf("%s: %s [%s -> %s]\n", verb, event.Thing, event.Reached, event.To)
+	}
+}
+
+// JSONObserver writes every event as a separate line of JSON
+type JSONObserver struct {
+	enc *json.Encoder
+	mux sync.Mutex
+}
+
+type jsonPlanRecord struct {
+	Event string
+	PlanEvent
+}
+
+type jsonCompensationRecord struct {
+	Event string
+	CompensationEvent
+	Error string `json:",omitempty"`
+}
+
+type jsonTransitionRecord struct {
+	Event string
+	TransitionEvent
+	Error string `json:",omitempty"`
+}
+
+// NewJSONObserver creates an observer writing JSON lines to out
+func NewJSONObserver(out io.Writer) *JSONObserver {
+	return &JSONObserver{enc: json.NewEncoder(out)}
+}
+
+func (observer *JSONObserver) write(record interface{}) {
+	observer.mux.Lock()
+	defer observer.mux.Unlock()
+
+	if err := observer.enc.Encode(record); err != nil {
+		log.Warnf("JSONObserver: cannot write event: %s", err)
+	}
+}
+
+func (observer *JSONObserver) writeTransition(name string, event TransitionEvent) {
+	record := jsonTransitionRecord{Event: name, TransitionEvent: event}
+	if event.Err != nil {
+		record.Error = event.Err.Error()
+	}
+
+	observer.write(record)
+}
+
+// TransitionPlanned writes "planned" event
+func (observer *JSONObserver) TransitionPlanned(event PlanEvent) {
+	observer.write(jsonPlanRecord{Event: "planned", PlanEvent: event})
+}
+
+// TransitionWaiting writes "waiting" event
+func (observer *JSONObserver) TransitionWaiting(event TransitionEvent) {
+	observer.writeTransition("waiting", event)
+}
+
+// TransitionStarted writes "started" event
+func (observer *JSONObserver) TransitionStarted(event TransitionEvent) {
+	observer.writeTransition("started", event)
+}
+
+// TransitionRunning writes "running" event
+func (observer *JSONObserver) TransitionRunning(event TransitionEvent) {
+	observer.writeTransition("running", event)
+}
+
+// StageChanged writes "stage" event
+func (observer *JSONObserver) StageChanged(event TransitionEvent) {
+	observer.writeTransition("stage", event)
+}
+
+// TransitionRetrying writes "retrying" event
+func (observer *JSONObserver) TransitionRetrying(event TransitionEvent) {
+	observer.writeTransition("retrying", event)
+}
+
+// TransitionCompleted writes "completed" event
+func (observer *JSONObserver) TransitionCompleted(event TransitionEvent) {
+	observer.writeTransition("completed", event)
+}
+
+// TransitionFailed writes "failed" event
+func (observer *JSONObserver) TransitionFailed(event TransitionEvent) {
+	observer.writeTransition("failed", event)
+}
+
+// ThingCompensated writes "compensated" event
+func (observer *JSONObserver) ThingCompensated(event CompensationEvent) {
+	record := jsonCompensationRecord{Event: "compensated", CompensationEvent: event}
+	if event.Err != nil {
+		record.Error = event.Err.Error()
+	}
+
+	observer.write(record)
+}
+
+// transitionEvent describes current state of the task
+func transitionEvent(task *transition, simulated bool) TransitionEvent {
+	now := time.Now()
+	event := TransitionEvent{
+		Time:      now,
+		Thing:     task.thingName,
+		ThingID:   thingID(task.target.Thing),
+		Action:    fmt.Sprintf("%s", task.action),
+		Kind:      ActionKind(task.action),
+		From:      fmt.Sprintf("%s", task.fromStatus),
+		To:        fmt.Sprintf("%s", task.target.DesiredStatus),
+		Simulated: simulated,
+		Started:   task.started,
+	}
+
+	if !task.started.IsZero() {
+		event.Elapsed = now.Sub(task.started)
+	}
+
+	return event
+}
+
+func (exec *executorState) notify(callback func(observer Observer)) {
+	for _, observer := range exec.observers {
+		callback(observer)
+	}
+}
@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// PlanGoal is a status some thing had to reach together with all status chains
+// leading there and the chain which was chosen
+type PlanGoal struct {
+	Desired string
+	Chains  [][]string
+	// Costs are estimated costs of Chains, empty if the thing cannot estimate them
+	Costs     []Cost `json:",omitempty"`
+	Chosen    []string
+	Rationale string
+}
+
+// PlanThing describes a thing taking part in the execution
+type PlanThing struct {
+	ID     string `json:",omitempty"`
+	Name   string
+	Status string
+	Goals  []PlanGoal
+}
+
+// PlanPrerequisite is a target that has to be reached before an action can start
+type PlanPrerequisite struct {
+	Thing  string
+	Status string
+	Exact  bool `json:",omitempty"`
+	// Action is the index of planned action that reaches the prerequisite or -1
+	// if the prerequisite was satisfied from the very beginning
+	Action int
+}
+
+// PlanAction is a single action the executor would perform
+type PlanAction struct {
+	Index         int
+	Name          string
+	Kind          string
+	Thing         string
+	From          string
+	To            string
+	Exclusive     bool `json:",omitempty"`
+	Prerequisites []PlanPrerequisite
+	// Group is the number of parallel group, actions of the same group run simultaneously
+	Group int
+}
+
+// Plan collects the graph of everything the executor is going to do, it is filled
+// when executing with Simulate option and can be exported to JSON or DOT.
+// All methods are no-op on nil Plan.
+type Plan struct {
+	Things  []*PlanThing
+	Actions []*PlanAction
+
+	things      []Thing
+	reached     []Target
+	group       int
+	groupClosed bool
+	mux         sync.Mutex
+}
+
+// NewPlan creates an empty plan
+func NewPlan() *Plan {
+	return &Plan{
+		Things:  []*PlanThing{},
+		Actions: []*PlanAction{},
+	}
+}
+
+func statusStrings(chain []Status) []string {
+	result := make([]string, 0, len(chain))
+	for _, status := range chain {
+		result = append(result, fmt.Sprintf("%s", status))
+	}
+
+	return result
+}
+
+// sameThing tells if both values describe the same thing; entities compare their statuses
+// in Equals and get re-created when loaded from state, so persistent identifiers are preferred
+func sameThing(first, second Thing) bool {
+	firstID, secondID := thingID(first), thingID(second)
+	if firstID != "" && secondID != "" {
+		return firstID == secondID
+	}
+
+	return first.Equals(second)
+}
+
+// planThing finds or adds a thing description, must be called under lock
+func (plan *Plan) planThing(thing Thing) *PlanThing {
+	for idx, known := range plan.things {
+		if sameThing(known, thing) {
+			return plan.Things[idx]
+		}
+	}
+
+	result := &PlanThing{
+		ID:     thingID(thing),
+		Name:   fmt.Sprintf("%s", thing),
+		Status: fmt.Sprintf("%s", thing.Status()),
+		Goals:  []PlanGoal{},
+	}
+
+	plan.things = append(plan.things, thing)
+	plan.Things = append(plan.Things, result)
+
+	return result
+}
+
+func (plan *Plan) recordChains(target Target, chains [][]Status, choice chainChoice) {
+	if plan == nil {
+		return
+	}
+
+	plan.mux.Lock()
+	defer plan.mux.Unlock()
+
+	desc := plan.planThing(target.Thing)
+	desired := fmt.Sprintf("%s", target.DesiredStatus)
+
+	for _, goal := range desc.Goals {
+		if goal.Desired == desired {
+			// executor re-plans on every step, only the first plan shows the whole path
+			return
+		}
+	}
+
+	goal := PlanGoal{
+		Desired:   desired,
+		Chains:    [][]string{},
+		Costs:     choice.costs,
+		Chosen:    statusStrings(chains[choice.index]),
+		Rationale: choice.rationale,
+	}
+
+	for _, chain := range chains {
+		goal.Chains = append(goal.Chains, statusStrings(chain))
+	}
+
+	desc.Goals = append(desc.Goals, goal)
+}
+
+// reachedBy returns index of the planned action after which target is reached, must be called under lock
+func (plan *Plan) reachedBy(target Target) int {
+	for idx := len(plan.reached) - 1; idx >= 0; idx-- {
+		reached := plan.reached[idx]
+		if sameThing(reached.Thing, target.Thing) &&
+			compareStatus(reached.DesiredStatus, target.DesiredStatus, target.MatchExact) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func (plan *Plan) recordAction(task *transition) {
+	if plan == nil {
+		return
+	}
+
+	plan.mux.Lock()
+	defer plan.mux.Unlock()
+
+	if plan.groupClosed {
+		plan.group++
+		plan.groupClosed = false
+	}
+
+	desc := plan.planThing(task.target.Thing)
+	action := &PlanAction{
+		Index:         len(plan.Actions),
+		Name:          fmt.Sprintf("%s", task.action),
+		Kind:          ActionKind(task.action),
+		Thing:         desc.Name,
+		From:          fmt.Sprintf("%s", task.fromStatus),
+		To:            fmt.Sprintf("%s", task.target.DesiredStatus),
+		Exclusive:     task.action.IsExclusive(),
+		Prerequisites: []PlanPrerequisite{},
+		Group:         plan.group,
+	}
+
+	for _, prereq := range task.prerequisites {
+		action.Prerequisites = append(action.Prerequisites, PlanPrerequisite{
+			Thing:  plan.planThing(prereq.Thing).Name,
+			Status: fmt.Sprintf("%s", prereq.DesiredStatus),
+			Exact:  prereq.MatchExact,
+			Action: plan.reachedBy(prereq),
+		})
+	}
+
+	plan.Actions = append(plan.Actions, action)
+	plan.reached = append(plan.reached, task.target)
+}
+
+// closeGroup is called when executor waits for running actions, so actions started
+// after that don't belong to the same parallel group
+func (plan *Plan) closeGroup() {
+	if plan == nil {
+		return
+	}
+
+	plan.mux.Lock()
+	plan.groupClosed = true
+	plan.mux.Unlock()
+}
+
+// WriteJSON writes the plan as indented JSON document
+func (plan *Plan) WriteJSON(out io.Writer) error {
+	plan.mux.Lock()
+	defer plan.mux.Unlock()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(plan)
+}
+
+func dotQuote(str string) string {
+	return fmt.Sprintf("%q", str)
+}
+
+// dotLines quotes lines as a single left-justified label
+func dotLines(lines []string) string {
+	quoted := make([]string, 0, len(lines))
+	for _, line := range lines {
+		str := dotQuote(line)
+		quoted = append(quoted, str[1:len(str)-1])
+	}
+
+	return "\"" + strings.Join(quoted, "\\l") + "\\l\""
+}
+
+// WriteDOT writes the plan as a graph in Graphviz DOT language: statuses of every thing
+// are grouped in a cluster with the chosen path in bold, actions are boxes with dashed
+// edges to their prerequisites, actions of the same parallel group are ranked together
+func (plan *Plan) WriteDOT(out io.Writer) error {
+	plan.mux.Lock()
+	defer plan.mux.Unlock()
+
+	var buf strings.Builder
+
+	buf.WriteString("digraph plan {\n\tcompound=true;\n\trankdir=LR;\n")
+
+	statusNode := func(thingIdx int, status string) string {
+		return dotQuote(fmt.Sprintf("thing%d:%s", thingIdx, status))
+	}
+
+	thingIndex := func(name string) int {
+		for idx, desc := range plan.Things {
+			if desc.Name == name {
+				return idx
+			}
+		}
+
+		return -1
+	}
+
+	for thingIdx, desc := range plan.Things {
+		lines := []string{desc.Name}
+		for _, goal := range desc.Goals {
+			lines = append(lines, fmt.Sprintf("%s: %s", goal.Desired, goal.Rationale))
+		}
+
+		fmt.Fprintf(&buf, "\tsubgraph cluster_thing%d {\n\t\tlabel=%s;\n", thingIdx, dotLines(lines))
+		fmt.Fprintf(&buf, "\t\t%s [label=%s, shape=doublecircle];\n",
+			statusNode(thingIdx, desc.Status), dotQuote(desc.Status))
+
+		edges := map[string]bool{}
+		declared := map[string]bool{desc.Status: true}
+
+		for _, goal := range desc.Goals {
+			for _, chain := range goal.Chains {
+				for _, status := range chain {
+					if !declared[status] {
+						declared[status] = true
+						fmt.Fprintf(&buf, "\t\t%s [label=%s, shape=ellipse];\n",
+							statusNode(thingIdx, status), dotQuote(status))
+					}
+				}
+			}
+
+			chosen := map[string]bool{}
+			for idx := 1; idx < len(goal.Chosen); idx++ {
+				chosen[goal.Chosen[idx-1]+"\x00"+goal.Chosen[idx]] = true
+			}
+
+			for _, chain := range goal.Chains {
+				for idx := 1; idx < len(chain); idx++ {
+					key := chain[idx-1] + "\x00" + chain[idx]
+					if edges[key] {
+						continue
+					}
+
+					edges[key] = true
+					style := "dotted"
+
+					if chosen[key] {
+						style = "bold"
+					}
+
+					fmt.Fprintf(&buf, "\t\t%s -> %s [style=%s];\n",
+						statusNode(thingIdx, chain[idx-1]), statusNode(thingIdx, chain[idx]), style)
+				}
+			}
+		}
+
+		buf.WriteString("\t}\n")
+	}
+
+	groups := map[int][]string{}
+	groupOrder := []int{}
+
+	for _, action := range plan.Actions {
+		node := dotQuote(fmt.Sprintf("action%d", action.Index))
+		label := fmt.Sprintf("%d: %s\\n%s -> %s", action.Index, action.Name, action.From, action.To)
+
+		fmt.Fprintf(&buf, "\t%s [label=\"%s\", shape=box];\n", node, strings.ReplaceAll(label, "\"", "\\\""))
+
+		if thingIdx := thingIndex(action.Thing); thingIdx >= 0 {
+			fmt.Fprintf(&buf, "\t%s -> %s [label=\"applies\", arrowhead=none];\n",
+				node, statusNode(thingIdx, action.To))
+		}
+
+		for _, prereq := range action.Prerequisites {
+			if prereq.Action >= 0 {
+				fmt.Fprintf(&buf, "\t%s -> %s [style=dashed, label=\"requires\"];\n",
+					node, dotQuote(fmt.Sprintf("action%d", prereq.Action)))
+			} else if thingIdx := thingIndex(prereq.Thing); thingIdx >= 0 {
+				fmt.Fprintf(&buf, "\t%s -> %s [style=dashed, label=\"requires\"];\n",
+					node, statusNode(thingIdx, prereq.Status))
+			}
+		}
+
+		if _, ok := groups[action.Group]; !ok {
+			groupOrder = append(groupOrder, action.Group)
+		}
+
+		groups[action.Group] = append(groups[action.Group], node)
+	}
+
+	for _, group := range groupOrder {
+		if len(groups[group]) > 1 {
+			fmt.Fprintf(&buf, "\t{ rank=same; %s; } // parallel group %d\n", strings.Join(groups[group], "; "), group)
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	_, err := io.WriteString(out, buf.String())
+
+	return err
+}
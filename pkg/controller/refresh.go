@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Drift tells how real resources of a Thing differ from its stored status
+type Drift struct {
+	// Stored is the status the thing has
+	Stored Status
+	// Actual is the status matching real resources, it equals Stored unless the stored status is wrong
+	Actual Status
+	// Details describe found differences, empty if there are none
+	Details string
+}
+
+// Drifted is true if real resources differ from what is known about the thing
+func (drift Drift) Drifted() bool {
+	return drift.Details != ""
+}
+
+// Fixable is true if the stored status is wrong and can be rewritten by the actual one
+func (drift Drift) Fixable() bool {
+	return drift.Actual != nil && !drift.Actual.Equals(drift.Stored)
+}
+
+// Refresher is an optional companion interface of Thing which can check its real resources
+// in the cloud, e.g. to find out the cluster was deleted by someone bypassing enzyme
+type Refresher interface {
+	// Refresh compares real resources with the stored status, nothing is changed
+	Refresh(ctx context.Context) (Drift, error)
+	// Reconcile makes the thing have the actual status found by Refresh
+	Reconcile(drift Drift) error
+}
+
+// RefreshThing checks real resources of the thing implementing Refresher and, if fix is true,
+// rewrites its status when it's wrong. The thing is locked and reloaded if it supports that,
+// so the status changed by another process is not overwritten.
+func RefreshThing(ctx context.Context, thing Thing, fix bool) (Drift, error) {
+	refresher, ok := thing.(Refresher)
+	if !ok {
+		return Drift{}, fmt.Errorf("%s cannot be refreshed", thing)
+	}
+
+	if lockable, ok := thing.(Lockable); ok {
+		unlock, err := lockable.Lock()
+		if err != nil {
+			log.WithField("thing", thing).Errorf("RefreshThing: cannot lock: %s", err)
+			return Drift{}, err
+		}
+		defer unlock()
+	}
+
+	if reloadable, ok := thing.(Reloadable); ok {
+		if err := reloadable.Reload(); err != nil {
+			log.WithField("thing", thing).Errorf("RefreshThing: cannot reload: %s", err)
+			return Drift{}, err
+		}
+	}
+
+	drift, err := refresher.Refresh(ctx)
+	if err != nil {
+		log.WithField("thing", thing).Errorf("RefreshThing: cannot refresh: %s", err)
+		return drift, err
+	}
+
+	if fix && drift.Fixable() {
+		if err := refresher.Reconcile(drift); err != nil {
+			log.WithFields(log.Fields{
+				"thing":  thing,
+				"actual": drift.Actual,
+			}).Errorf("RefreshThing: cannot fix the status: %s", err)
+
+			return drift, err
+		}
+	}
+
+	return drift, nil
+}
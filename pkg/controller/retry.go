@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"time"
+)
+
+// RetryPolicy tells how many times and how often an action can be attempted
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, it doubles with every next attempt
+	Backoff time.Duration
+	// MaxBackoff limits the delay between attempts, no limit if zero
+	MaxBackoff time.Duration
+}
+
+// RetryableAction is an optional companion interface of Action which failures
+// can be transient, e.g. rate limits or eventual consistency errors of the cloud
+type RetryableAction interface {
+	Action
+	RetryPolicy() RetryPolicy
+	// ShouldRetry classifies the error returned by Apply, true means applying
+	// the action again might succeed
+	ShouldRetry(err error) bool
+}
+
+// delay returns how long to wait after given failed attempt (counting from 1)
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	result := policy.Backoff
+
+	for idx := 1; idx < attempt; idx++ {
+		result *= 2
+
+		if policy.MaxBackoff > 0 && result >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+
+	return result
+}
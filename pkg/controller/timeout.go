@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimedAction is an optional companion interface of Action which has a sensible limit
+// on how long it can run, e.g. building an image shouldn't take a day
+type TimedAction interface {
+	Action
+	// DefaultTimeout returns the limit of a single Apply, zero means no limit
+	DefaultTimeout() time.Duration
+}
+
+// TimeoutConfigurer is an optional companion interface of Thing whose timeouts of actions are
+// configured together with the thing, e.g. by its parameters file
+type TimeoutConfigurer interface {
+	// ActionTimeouts return timeouts by ActionKind, they override ExecOptions.ActionTimeouts
+	ActionTimeouts() map[string]time.Duration
+}
+
+// TimeoutError is returned when an action was stopped because it ran out of time
+type TimeoutError struct {
+	Action  string
+	Timeout time.Duration
+	// Deadline is true if the whole execution ran out of time, not only the action
+	Deadline bool
+	Err      error
+}
+
+func (timeoutErr *TimeoutError) Error() string {
+	if timeoutErr.Deadline {
+		return fmt.Sprintf("%s stopped by execution deadline: %s", timeoutErr.Action, timeoutErr.Err)
+	}
+
+	return fmt.Sprintf("%s timed out after %s: %s", timeoutErr.Action, timeoutErr.Timeout, timeoutErr.Err)
+}
+
+// Unwrap returns the error returned by the stopped action
+func (timeoutErr *TimeoutError) Unwrap() error {
+	return timeoutErr.Err
+}
+
+// ActionKind returns the name of action type used to configure actions of that type,
+// e.g. "image.buildImage"
+func ActionKind(action Action) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", action), "*")
+}
+
+// actionTimeout returns the limit for the action of the task: configured for its kind by the thing
+// or by the execution if any, otherwise its default one; zero means no limit
+func (exec *executorState) actionTimeout(task *transition) time.Duration {
+	action := task.action
+
+	if configurer, ok := task.target.Thing.(TimeoutConfigurer); ok {
+		if timeout, ok := configurer.ActionTimeouts()[ActionKind(action)]; ok {
+			return timeout
+		}
+	}
+
+	if timeout, ok := exec.timeouts[ActionKind(action)]; ok {
+		return timeout
+	}
+
+	if timed, ok := action.(TimedAction); ok {
+		return timed.DefaultTimeout()
+	}
+
+	return 0
+}
+
+// applyOnce applies the action limiting it by its timeout, if the limit is hit the error
+// is replaced by TimeoutError
+func (exec *executorState) applyOnce(ctx context.Context, task *transition) error {
+	timeout := exec.actionTimeout(task)
+	if timeout <= 0 {
+		err := task.action.Apply(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &TimeoutError{Action: task.actionName, Deadline: true, Err: err}
+		}
+
+		return err
+	}
+
+	actionCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := task.action.Apply(actionCtx)
+	if err != nil && errors.Is(actionCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{
+			Action:   task.actionName,
+			Timeout:  timeout,
+			Deadline: errors.Is(ctx.Err(), context.DeadlineExceeded),
+			Err:      err,
+		}
+	}
+
+	return err
+}
+
+// interruptedError describes why the execution was stopped when ctx is done
+func interruptedError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("execution deadline exceeded: %w", ctx.Err())
+	}
+
+	return fmt.Errorf("execution interrupted: %w", ctx.Err())
+}
@@ -14,6 +14,13 @@ type transition struct {
 	fromStatus    Status
 	prerequisites []Target
 	started       time.Time
+
+	// descriptions captured when the transition is started, as they may change later
+	thingName  string
+	actionName string
+
+	// unlock releases the lock of the thing held while the transition is performed
+	unlock func()
 }
 
 func (t transition) String() string {
@@ -147,6 +154,28 @@ func (exec *executorState) makeAction(target Target, toStatus Status) (*transiti
 	}, nil
 }
 
+// notifyPlanned tells observers about the chosen status chain unless it's the same as before,
+// as the chain is re-built on every step of the execution
+func (exec *executorState) notifyPlanned(thing Thing, chain []string, rationale string) {
+	event := PlanEvent{
+		Time:      time.Now(),
+		Thing:     fmt.Sprintf("%s", thing),
+		ThingID:   thingID(thing),
+		Chain:     chain,
+		Rationale: rationale,
+	}
+
+	key := thingKey(thing)
+
+	joined := strings.Join(chain, " -> ")
+	if exec.planned[key] == joined {
+		return
+	}
+
+	exec.planned[key] = joined
+	exec.notify(func(observer Observer) { observer.TransitionPlanned(event) })
+}
+
 func (exec *executorState) findTransition(target Target) (*transition, error) {
 	logger := log.WithFields(log.Fields{
 		"thing":       target.Thing,
@@ -163,33 +192,30 @@ func (exec *executorState) findTransition(target Target) (*transition, error) {
 		return nil, err
 	}
 
-	minLen, minIdx := len(chains[0]), 0
-
-	for idx, chain := range chains {
-		if len(chain) < minLen {
-			minLen = len(chain)
-			minIdx = idx
-		}
-	}
-
-	chain := chains[minIdx]
-	if len(chain) == 0 {
+	if len(chains) == 0 {
 		logger.Infof("findTransition: already at desired status, nothing to do")
 		return nil, nil
 	}
 
-	if !chain[0].Equals(target.Thing.Status()) {
-		logger.Fatalf("findTransition: first element in status chain %s is not equal to from-status", chain[0])
+	fullChains := make([][]Status, 0, len(chains))
+	for _, chain := range chains {
+		// copy before appending so chains don't share the underlying arrays
+		fullChains = append(fullChains, append(chain[:len(chain):len(chain)], target.DesiredStatus))
 	}
 
-	chain = append(chain, target.DesiredStatus)
-	chainStrs := []string{}
+	choice := chooseChain(target.Thing, fullChains, exec.costMetric)
 
-	for _, status := range chain {
-		chainStrs = append(chainStrs, fmt.Sprintf("%s", status))
+	chain := fullChains[choice.index]
+	if !chain[0].Equals(target.Thing.Status()) {
+		logger.Fatalf("findTransition: first element in status chain %s is not equal to from-status", chain[0])
 	}
 
-	logger.Infof("findTransition: created status chain: %s", strings.Join(chainStrs, " -> "))
+	chainStrs := statusStrings(chain)
+
+	logger.Infof("findTransition: created status chain: %s, chosen as %s", strings.Join(chainStrs, " -> "),
+		choice.rationale)
+	exec.notifyPlanned(target.Thing, chainStrs, choice.rationale)
+	exec.plan.recordChains(target, fullChains, choice)
 
 	toStatus := chain[1]
 
@@ -198,6 +224,13 @@ func (exec *executorState) findTransition(target Target) (*transition, error) {
 		return nil, err
 	}
 
+	if transit != nil {
+		if err := exec.failedBefore(transit); err != nil {
+			logger.Errorf("findTransition: cannot reach target: %s", err)
+			return nil, err
+		}
+	}
+
 	if transit != nil && exec.canExecute(transit) {
 		return transit, nil
 	}
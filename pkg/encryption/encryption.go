@@ -0,0 +1,339 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// KeyEnv is the environment variable keeping the key as hex or base64 encoded 32 bytes
+	KeyEnv = "ENZYME_ENCRYPTION_KEY"
+	// PassphraseEnv is the environment variable keeping the passphrase the key is derived from
+	PassphraseEnv = "ENZYME_ENCRYPTION_PASSPHRASE"
+
+	keySize  = 32
+	saltSize = 16
+
+	// encrypted contents are a single text line, so they can be kept wherever JSON is kept
+	header = "enzyme-encrypted:v1:"
+
+	// scrypt parameters recommended for interactive logins
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	// ErrNoKey is returned when encrypted contents are read without a key
+	ErrNoKey = errors.New("contents are encrypted, the key is given by --encryption-key-file, " +
+		KeyEnv + " or " + PassphraseEnv)
+	// ErrWrongKey is returned when encrypted contents cannot be decrypted by known keys
+	ErrWrongKey = errors.New("contents are encrypted by another key")
+
+	keys struct {
+		sync.RWMutex
+		current  *Key
+		previous []*Key
+	}
+)
+
+// Key encrypts contents by AES-256-GCM, it is either given as is or derived from a passphrase
+// by scrypt with a random salt kept in encrypted contents
+type Key struct {
+	raw        []byte
+	passphrase string
+
+	mutex    sync.Mutex
+	derived  map[string]cipher.AEAD
+	sealSalt string
+}
+
+// KeyFromBytes returns the key given as 32 bytes
+func KeyFromBytes(raw []byte) (*Key, error) {
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes long, got %d", keySize, len(raw))
+	}
+
+	return &Key{raw: append([]byte{}, raw...)}, nil
+}
+
+// KeyFromString returns the key given as hex or base64 encoded 32 bytes
+func KeyFromString(encoded string) (*Key, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	if raw, err := hex.DecodeString(encoded); err == nil && len(raw) == keySize {
+		return KeyFromBytes(raw)
+	}
+
+	if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(raw) == keySize {
+		return KeyFromBytes(raw)
+	}
+
+	return nil, fmt.Errorf("key must be %d bytes encoded as hex or base64", keySize)
+}
+
+// KeyFromFile reads the key kept in the file as 32 raw bytes, or as hex or base64 text
+func KeyFromFile(path string) (*Key, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) == keySize {
+		return KeyFromBytes(content)
+	}
+
+	key, err := KeyFromString(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// KeyFromPassphrase returns the key derived from the passphrase
+func KeyFromPassphrase(passphrase string) (*Key, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+
+	return &Key{passphrase: passphrase}, nil
+}
+
+// aead returns the cipher for contents encrypted with given salt, keys derived from
+// the passphrase are cached as scrypt is deliberately slow
+func (key *Key) aead(salt string) (cipher.AEAD, error) {
+	key.mutex.Lock()
+	defer key.mutex.Unlock()
+
+	if aead, ok := key.derived[salt]; ok {
+		return aead, nil
+	}
+
+	raw := key.raw
+
+	if key.passphrase != "" {
+		if salt == "" {
+			// contents encrypted by a key given as is have no salt
+			return nil, ErrWrongKey
+		}
+
+		saltBytes, err := base64.StdEncoding.DecodeString(salt)
+		if err != nil || len(saltBytes) != saltSize {
+			return nil, errors.New("encrypted contents have malformed salt")
+		}
+
+		if raw, err = scrypt.Key([]byte(key.passphrase), saltBytes, scryptN, scryptR, scryptP,
+			keySize); err != nil {
+			return nil, err
+		}
+	} else if salt != "" {
+		return nil, ErrWrongKey
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.derived == nil {
+		key.derived = map[string]cipher.AEAD{}
+	}
+
+	key.derived[salt] = aead
+
+	return aead, nil
+}
+
+// salt returns the salt new contents are encrypted with; a passphrase key reuses the salt of
+// contents it has decrypted, so the key isn't derived again for every file
+func (key *Key) salt() (string, error) {
+	if key.passphrase == "" {
+		return "", nil
+	}
+
+	key.mutex.Lock()
+	defer key.mutex.Unlock()
+
+	if key.sealSalt == "" {
+		for salt := range key.derived {
+			key.sealSalt = salt
+			return salt, nil
+		}
+
+		saltBytes := make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, saltBytes); err != nil {
+			return "", err
+		}
+
+		key.sealSalt = base64.StdEncoding.EncodeToString(saltBytes)
+	}
+
+	return key.sealSalt, nil
+}
+
+// Seal encrypts the contents
+func (key *Key) Seal(content []byte) ([]byte, error) {
+	salt, err := key.salt()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := key.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, content, nil)
+
+	return []byte(header + salt + ":" + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// Open decrypts contents encrypted by the key
+func (key *Key) Open(content []byte) ([]byte, error) {
+	if !IsSealed(content) {
+		return nil, errors.New("contents are not encrypted")
+	}
+
+	fields := strings.SplitN(strings.TrimSpace(string(content[len(header):])), ":", 2)
+	if len(fields) != 2 {
+		return nil, errors.New("encrypted contents are malformed")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("encrypted contents are malformed: %w", err)
+	}
+
+	aead, err := key.aead(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted contents are truncated")
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+
+	return plain, nil
+}
+
+// IsSealed tells if the contents are encrypted
+func IsSealed(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(header))
+}
+
+// Use sets the key encrypting contents written from now on, nil keeps them unencrypted;
+// contents are decrypted by the key or any of previous keys, so they can be rotated
+func Use(key *Key, previous ...*Key) {
+	keys.Lock()
+	defer keys.Unlock()
+
+	keys.current = key
+	keys.previous = previous
+}
+
+// Enabled tells if written contents are encrypted
+func Enabled() bool {
+	keys.RLock()
+	defer keys.RUnlock()
+
+	return keys.current != nil
+}
+
+// Seal encrypts the contents by the key in use, contents are returned as is if there is none
+func Seal(content []byte) ([]byte, error) {
+	keys.RLock()
+	current := keys.current
+	keys.RUnlock()
+
+	if current == nil {
+		return content, nil
+	}
+
+	return current.Seal(content)
+}
+
+// open decrypts the contents by known keys and tells whether they were encrypted by the key in use
+func open(content []byte) ([]byte, bool, error) {
+	keys.RLock()
+	current, previous := keys.current, keys.previous
+	keys.RUnlock()
+
+	if !IsSealed(content) {
+		return content, current == nil, nil
+	}
+
+	if current == nil && len(previous) == 0 {
+		return nil, false, ErrNoKey
+	}
+
+	for idx, key := range append([]*Key{current}, previous...) {
+		if key == nil {
+			continue
+		}
+
+		plain, err := key.Open(content)
+		if err == nil {
+			return plain, idx == 0, nil
+		}
+
+		if err != ErrWrongKey {
+			return nil, false, err
+		}
+	}
+
+	return nil, false, ErrWrongKey
+}
+
+// Open decrypts the contents by the key in use or previous keys, unencrypted contents are returned as is
+func Open(content []byte) ([]byte, error) {
+	plain, _, err := open(content)
+	return plain, err
+}
+
+// Unchanged tells if stored contents are the contents written as Seal would write them now,
+// i.e. they are equal and encrypted by the key in use, or unencrypted if there is none
+func Unchanged(stored, content []byte) bool {
+	plain, current, err := open(stored)
+	return err == nil && current && bytes.Equal(plain, content)
+}
+
+// ResealContent returns the contents encrypted by the key in use, or unencrypted if there is none,
+// and tells whether they differ from the given ones
+func ResealContent(content []byte) ([]byte, bool, error) {
+	plain, current, err := open(content)
+	if err != nil || current {
+		return content, false, err
+	}
+
+	sealed, err := Seal(plain)
+
+	return sealed, err == nil, err
+}
@@ -0,0 +1,259 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+func TestSealOpen(t *testing.T) {
+	rawKey, err := KeyFromString(hex.EncodeToString([]byte(strings.Repeat("k", keySize))))
+	if err != nil {
+		t.Fatalf("KeyFromString function returned error: [%s]", err)
+	}
+
+	passphraseKey, err := KeyFromPassphrase("passphrase")
+	if err != nil {
+		t.Fatalf("KeyFromPassphrase function returned error: [%s]", err)
+	}
+
+	otherKey, err := KeyFromPassphrase("other passphrase")
+	if err != nil {
+		t.Fatalf("KeyFromPassphrase function returned error: [%s]", err)
+	}
+
+	content := []byte(`{"Provider": {"Creds": "secret"}}`)
+
+	for _, key := range []*Key{rawKey, passphraseKey} {
+		sealed, err := key.Seal(content)
+		if err != nil {
+			t.Fatalf("Seal function returned error: [%s]", err)
+		}
+
+		if !IsSealed(sealed) || bytes.Contains(sealed, []byte("secret")) {
+			t.Errorf("contents are not encrypted: %s", sealed)
+		}
+
+		if opened, err := key.Open(sealed); err != nil || !bytes.Equal(opened, content) {
+			t.Errorf("wrong decrypted contents: [%s]!=[%s] [%v]", content, opened, err)
+		}
+
+		if _, err := otherKey.Open(sealed); err != ErrWrongKey {
+			t.Errorf("contents are decrypted by another key: [%v]", err)
+		}
+	}
+
+	if _, err := KeyFromString("short"); err == nil {
+		t.Errorf("KeyFromString function accepted a short key")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	defer Use(nil)
+
+	oldKey, _ := KeyFromPassphrase("old")
+	newKey, _ := KeyFromPassphrase("new")
+	content := []byte(`{"Status": 1}`)
+
+	Use(nil)
+
+	if sealed, err := Seal(content); err != nil || !bytes.Equal(sealed, content) {
+		t.Errorf("contents are encrypted without a key: [%s] [%v]", sealed, err)
+	}
+
+	Use(oldKey)
+
+	sealed, err := Seal(content)
+	if err != nil {
+		t.Fatalf("Seal function returned error: [%s]", err)
+	}
+
+	if !Unchanged(sealed, content) || Unchanged(sealed, []byte(`{"Status": 2}`)) {
+		t.Errorf("wrong comparison of encrypted contents")
+	}
+
+	Use(nil)
+
+	if _, err := Open(sealed); err != ErrNoKey {
+		t.Errorf("encrypted contents are opened without a key: [%v]", err)
+	}
+
+	Use(newKey, oldKey)
+
+	if Unchanged(sealed, content) {
+		t.Errorf("contents encrypted by the previous key are unchanged")
+	}
+
+	resealed, changed, err := ResealContent(sealed)
+	if err != nil || !changed {
+		t.Fatalf("contents are not reencrypted: [%v]", err)
+	}
+
+	if _, changed, err := ResealContent(resealed); err != nil || changed {
+		t.Errorf("contents encrypted by the key in use are reencrypted: [%v]", err)
+	}
+
+	Use(newKey)
+
+	if opened, err := Open(resealed); err != nil || !bytes.Equal(opened, content) {
+		t.Errorf("wrong reencrypted contents: [%s]!=[%s] [%v]", content, opened, err)
+	}
+
+	if _, err := Open(sealed); err != ErrWrongKey {
+		t.Errorf("contents are opened by the rotated key: [%v]", err)
+	}
+}
+
+func TestOpenForTool(t *testing.T) {
+	defer Use(nil)
+
+	dir, err := ioutil.TempDir("", "encryption_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	openedDir = filepath.Join(dir, "opened")
+
+	key, _ := KeyFromBytes([]byte(strings.Repeat("k", keySize)))
+	Use(key)
+
+	config := filepath.Join(dir, "config.tf.json")
+	if err := WriteFile(config, []byte(`{"resource": {}}`)); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	packerConfig := filepath.Join(dir, "packer", "config.json")
+	if err := WriteFile(packerConfig, []byte(`{"builders": []}`)); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	reseal, err := OpenForTool(dir, []string{"apply", "packer/config.json"})
+	if err != nil {
+		t.Fatalf("OpenForTool function returned error: [%s]", err)
+	}
+
+	for _, path := range []string{config, packerConfig} {
+		if content, _ := ioutil.ReadFile(path); IsSealed(content) {
+			t.Errorf("%s is not decrypted for the tool", path)
+		}
+	}
+
+	// the tool writes its state and a file enzyme doesn't encrypt
+	state := filepath.Join(dir, "terraform.tfstate")
+	if err := ioutil.WriteFile(state, []byte(`{"version": 4}`), 0640); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	lockFile := filepath.Join(dir, ".terraform.lock.hcl")
+	if err := ioutil.WriteFile(lockFile, []byte(`provider {}`), 0640); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	if markers, _ := filepath.Glob(filepath.Join(openedDir, "*"+openedExt)); len(markers) != 1 {
+		t.Errorf("decrypted files are recorded in %d markers", len(markers))
+	}
+
+	if err := reseal(); err != nil {
+		t.Fatalf("reseal function returned error: [%s]", err)
+	}
+
+	if markers, _ := filepath.Glob(filepath.Join(openedDir, "*"+openedExt)); len(markers) != 0 {
+		t.Errorf("markers of encrypted files are kept: %v", markers)
+	}
+
+	for _, path := range []string{config, packerConfig, state} {
+		if content, _ := ioutil.ReadFile(path); !IsSealed(content) {
+			t.Errorf("%s is not encrypted back", path)
+		}
+	}
+
+	if content, _ := ioutil.ReadFile(lockFile); IsSealed(content) {
+		t.Errorf("%s is encrypted", lockFile)
+	}
+
+	Use(nil)
+
+	if _, err := OpenForTool(dir, nil); err != ErrNoKey {
+		t.Errorf("OpenForTool function decrypted files without a key: [%v]", err)
+	}
+}
+
+func TestResealLeftovers(t *testing.T) {
+	defer Use(nil)
+
+	dir, err := ioutil.TempDir("", "encryption_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	openedDir = filepath.Join(dir, "opened")
+
+	key, _ := KeyFromBytes([]byte(strings.Repeat("k", keySize)))
+	Use(key)
+
+	config := filepath.Join(dir, "config.tf.json")
+	if err := WriteFile(config, []byte(`{"resource": {}}`)); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	if _, err := OpenForTool(dir, nil); err != nil {
+		t.Fatalf("OpenForTool function returned error: [%s]", err)
+	}
+
+	if err := ResealLeftovers(); err != nil {
+		t.Fatalf("ResealLeftovers function returned error: [%s]", err)
+	}
+
+	if content, _ := ioutil.ReadFile(config); IsSealed(content) {
+		t.Errorf("files of the running process are encrypted")
+	}
+
+	// the process which decrypted the files dies
+	died := exec.Command("true")
+	if err := died.Run(); err != nil {
+		t.Skipf("cannot run a process: [%s]", err)
+	}
+
+	markers, _ := filepath.Glob(filepath.Join(openedDir, "*"+openedExt))
+	if len(markers) != 1 {
+		t.Fatalf("decrypted files are recorded in %d markers", len(markers))
+	}
+
+	var opened openedFiles
+	content, _ := ioutil.ReadFile(markers[0])
+	if err := json.Unmarshal(content, &opened); err != nil {
+		t.Fatalf("Unmarshal function returned error: [%s]", err)
+	}
+
+	opened.PID = died.Process.Pid
+	content, _ = json.Marshal(opened)
+	if err := ioutil.WriteFile(markers[0], content, 0640); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	if err := ResealLeftovers(); err != nil {
+		t.Fatalf("ResealLeftovers function returned error: [%s]", err)
+	}
+
+	if content, _ := ioutil.ReadFile(config); !IsSealed(content) {
+		t.Errorf("files left by the dead process are not encrypted")
+	}
+
+	if _, err := os.Stat(markers[0]); !os.IsNotExist(err) {
+		t.Errorf("marker of the encrypted files is kept: [%v]", err)
+	}
+}
@@ -0,0 +1,412 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/storage"
+)
+
+const (
+	// terraformDir keeps providers and the backend of terraform, it isn't read by enzyme
+	terraformDir = ".terraform"
+	filePerm     = 0640
+
+	openedCategory = "opened"
+	openedExt      = ".opened"
+)
+
+var (
+	// openedDir keeps markers of files decrypted while tools run
+	openedDir string
+)
+
+// sealedSuffixes are the files enzyme keeps encrypted: generated configs, states and terraform states
+var sealedSuffixes = []string{".json", ".tfstate", ".tfstate.backup"}
+
+// isSealable tells if the file at path is kept encrypted when encryption is enabled
+func isSealable(path string) bool {
+	for _, suffix := range sealedSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadFile reads the file and decrypts its contents if they are encrypted
+func ReadFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Open(content)
+}
+
+// WriteFile encrypts the contents by the key in use and writes them atomically
+func WriteFile(path string, content []byte) error {
+	sealed, err := Seal(content)
+	if err != nil {
+		return err
+	}
+
+	return storage.WriteFileAtomic(path, filePerm, func(w io.Writer) error {
+		_, err := w.Write(sealed)
+		return err
+	})
+}
+
+// isSealedFile tells if the file is encrypted reading only its beginning
+func isSealedFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	start := make([]byte, len(header))
+	if _, err := io.ReadFull(file, start); err != nil {
+		return false
+	}
+
+	return IsSealed(start)
+}
+
+// Reseal rewrites the file encrypted by the key in use, or unencrypted if there is none,
+// it tells whether the file was changed
+func Reseal(path string) (bool, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	resealed, changed, err := ResealContent(content)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	return true, storage.WriteFileAtomic(path, filePerm, func(w io.Writer) error {
+		_, err := w.Write(resealed)
+		return err
+	})
+}
+
+// ResealTree reseals configs and states kept under root, see Reseal, and returns paths of changed files
+func ResealTree(root string) ([]string, error) {
+	changed := []string{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == terraformDir {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || !isSealable(path) {
+			return nil
+		}
+
+		resealed, err := Reseal(path)
+		if err != nil {
+			log.WithField("path", path).Errorf("ResealTree: cannot reseal file: %s", err)
+			return err
+		}
+
+		if resealed {
+			changed = append(changed, path)
+		}
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// openedFiles records files decrypted for a tool, so that they are encrypted back by the next
+// enzyme command if the process running the tool dies before doing it
+type openedFiles struct {
+	PID   int
+	Host  string
+	Dir   string
+	Paths []string
+}
+
+// OpenForTool decrypts in place files an external tool works with: encrypted files of its working
+// directory and encrypted files given as its arguments. The returned function encrypts them back,
+// together with configs and terraform states the tool wrote to the directory, and must be called
+// when the tool exits. The files stay decrypted while the tool runs; if enzyme is killed meanwhile,
+// they are encrypted by ResealLeftovers at the start of the next command.
+func OpenForTool(workDir string, args []string) (func() error, error) {
+	candidates := []string{}
+
+	if workDir != "" {
+		infos, err := ioutil.ReadDir(workDir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if info.Mode().IsRegular() {
+				candidates = append(candidates, filepath.Join(workDir, info.Name()))
+			}
+		}
+	}
+
+	for _, arg := range args {
+		path := arg
+		if workDir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			candidates = append(candidates, path)
+		}
+	}
+
+	opened := openedFiles{Dir: workDir}
+	for _, path := range candidates {
+		if isSealedFile(path) {
+			opened.Paths = append(opened.Paths, path)
+		}
+	}
+
+	if !Enabled() {
+		if len(opened.Paths) != 0 {
+			return nil, ErrNoKey
+		}
+
+		return func() error { return nil }, nil
+	}
+
+	marker, err := recordOpened(opened)
+	if err != nil {
+		log.WithField("dir", workDir).Errorf("OpenForTool: cannot record files to decrypt: %s", err)
+		return nil, err
+	}
+
+	reseal := func() error {
+		if err := sealOpened(opened); err != nil {
+			return err
+		}
+
+		return removeMarker(marker)
+	}
+
+	for _, path := range opened.Paths {
+		plain, err := ReadFile(path)
+		if err == nil {
+			err = storage.WriteFileAtomic(path, filePerm, func(w io.Writer) error {
+				_, err := w.Write(plain)
+				return err
+			})
+		}
+
+		if err != nil {
+			log.WithField("path", path).Errorf("OpenForTool: cannot decrypt file: %s", err)
+
+			if resealErr := reseal(); resealErr != nil {
+				log.WithField("dir", workDir).Errorf("OpenForTool: cannot encrypt files back: %s", resealErr)
+			}
+
+			return nil, err
+		}
+	}
+
+	return reseal, nil
+}
+
+// ResealLeftovers encrypts files left decrypted by enzyme processes on this host which died while
+// a tool was running, files of running processes are left as they are
+func ResealLeftovers() error {
+	if !Enabled() {
+		return nil
+	}
+
+	infos, err := ioutil.ReadDir(openedDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	for _, info := range infos {
+		marker := filepath.Join(openedDir, info.Name())
+		if !strings.HasSuffix(marker, openedExt) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(marker)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// resealed by another process meanwhile
+				continue
+			}
+
+			return err
+		}
+
+		var opened openedFiles
+		if err := json.Unmarshal(content, &opened); err != nil {
+			log.WithField("marker", marker).Errorf("ResealLeftovers: cannot read decrypted files: %s", err)
+			return err
+		}
+
+		if opened.Host != host || opened.PID == os.Getpid() || storage.ProcessExists(opened.PID) {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"dir": opened.Dir,
+			"pid": opened.PID,
+		}).Warn("ResealLeftovers: encrypting files left decrypted by a dead process")
+
+		if err := sealOpened(opened); err != nil {
+			return err
+		}
+
+		if err := removeMarker(marker); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordOpened writes the marker of files to decrypt and returns its path
+func recordOpened(opened openedFiles) (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	opened.PID, opened.Host = os.Getpid(), host
+
+	if err := os.MkdirAll(openedDir, 0750); err != nil {
+		return "", err
+	}
+
+	file, err := ioutil.TempFile(openedDir, fmt.Sprintf("%d-*%s", opened.PID, openedExt))
+	if err != nil {
+		return "", err
+	}
+
+	if err = json.NewEncoder(file).Encode(opened); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func removeMarker(marker string) error {
+	if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// sealOpened encrypts the decrypted files back, together with configs and terraform states
+// written to the working directory of the tool
+func sealOpened(opened openedFiles) error {
+	resealed := map[string]bool{}
+
+	var result error
+
+	for _, path := range opened.Paths {
+		if err := sealFile(path); err != nil && result == nil {
+			result = err
+		}
+
+		resealed[path] = true
+	}
+
+	if opened.Dir == "" {
+		return result
+	}
+
+	infos, err := ioutil.ReadDir(opened.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result
+		}
+
+		return err
+	}
+
+	for _, info := range infos {
+		path := filepath.Join(opened.Dir, info.Name())
+		if resealed[path] || !info.Mode().IsRegular() || !isSealable(path) {
+			continue
+		}
+
+		if err := sealFile(path); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// sealFile encrypts the file unless it's already encrypted
+func sealFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the tool could remove the file
+			return nil
+		}
+
+		return err
+	}
+
+	if IsSealed(content) || len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+
+	if err := WriteFile(path, content); err != nil {
+		log.WithField("path", path).Errorf("sealFile: cannot encrypt file: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func init() {
+	openedDir = storage.GetStoragePath(openedCategory)
+}
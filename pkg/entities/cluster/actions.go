@@ -1,8 +1,10 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -21,7 +23,7 @@ func (action makeConfig) String() string {
 	return fmt.Sprintf("Configure for %s", action.cluster)
 }
 
-func (action makeConfig) Apply() error {
+func (action makeConfig) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"cluster": action.cluster,
 	}).Info("Cluster.makeConfig.Apply")
@@ -53,8 +55,13 @@ func (action makeConfig) Apply() error {
 		}).Warnf("Cluster.makeConfig: cannot make logfile name: %s", err)
 	}
 
-	if logname, err :=
-		action_pkg.RunLoggedCmdDir(tfLogPrefix, clusterDir, provider.Terraform(), "init"); err != nil {
+	backend := action.cluster.serviceParams.TerraformBackend
+	if err := common.ConfigureTerraformBackend(clusterDir, backend, action.cluster); err != nil {
+		return err
+	}
+
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, clusterDir, provider.Terraform(),
+		common.TerraformInitArgs(backend)...); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": clusterDir,
 		}).Errorf("Cluster.makeConfig: error initializing: %s", err)
@@ -87,6 +94,10 @@ func (action makeConfig) IsExclusive() bool {
 	return false
 }
 
+func (action makeConfig) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action makeConfig) Prerequisites() ([]controller.Target, error) {
 	imageTarget, err := composeImagePrereq(action.cluster, image.Configured)
 	if err != nil {
@@ -105,11 +116,13 @@ func (action *spawnCluster) String() string {
 	return fmt.Sprintf("Spawn%s for %s", action.stage.Get(), action.cluster)
 }
 
-func (action *spawnCluster) Apply() error {
+func (action *spawnCluster) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"cluster": action.cluster,
 	}).Info("Cluster.spawnCluster.Apply")
 
+	action.stage.Reset()
+
 	clusterDir := action.cluster.getClusterDir()
 
 	tfLogPrefix, err := action.cluster.makeToolLogPrefix("terraform")
@@ -119,7 +132,7 @@ func (action *spawnCluster) Apply() error {
 		}).Warnf("Cluster.spawnCluster: cannot make logfile name: %s", err)
 	}
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, clusterDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, clusterDir, provider.Terraform(),
 		"apply", "-auto-approve"); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": clusterDir,
@@ -129,7 +142,7 @@ func (action *spawnCluster) Apply() error {
 		log.Info("Cluster.spawnCluster: destroying half-spawned cluster ...")
 		action.stage.Set(":destroying half-spawned")
 
-		if logname, destroyErr := action_pkg.RunLoggedCmdDir(tfLogPrefix, clusterDir, provider.Terraform(),
+		if logname, destroyErr := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, clusterDir, provider.Terraform(),
 			"destroy", "-force"); destroyErr != nil {
 			log.WithFields(log.Fields{
 				"storage-dir": clusterDir,
@@ -138,12 +151,12 @@ func (action *spawnCluster) Apply() error {
 			fmt.Fprintf(os.Stderr, "Cannot destroy half-spawned cluster, see log for details: %s\n", logname)
 		}
 
-		return err
+		return &common.ToolError{Err: err, LogFile: logname}
 	}
 
 	action.stage.Set(":getting connect info")
 
-	if err := refreshConnectDetails(action.cluster, Spawned); err != nil {
+	if err := refreshConnectDetails(ctx, action.cluster, Spawned); err != nil {
 		log.WithField("cluster", action.cluster).Errorf(
 			"Cluster.spawnCluster: cannot get connection details: %s", err)
 		return err
@@ -154,10 +167,30 @@ func (action *spawnCluster) Apply() error {
 	return nil
 }
 
+func (action *spawnCluster) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *spawnCluster) IsExclusive() bool {
 	return false
 }
 
+func (action *spawnCluster) ResourceClass() string {
+	return common.TerraformResource
+}
+
+func (action *spawnCluster) RetryPolicy() controller.RetryPolicy {
+	return common.ToolRetryPolicy
+}
+
+func (action *spawnCluster) ShouldRetry(err error) bool {
+	return common.IsTransientToolError(err)
+}
+
+func (action *spawnCluster) DefaultTimeout() time.Duration {
+	return time.Hour
+}
+
 func (action *spawnCluster) Prerequisites() ([]controller.Target, error) {
 	imageTarget, err := composeImagePrereq(action.cluster, image.Created)
 	if err != nil {
@@ -175,7 +208,7 @@ func (action destroyCluster) String() string {
 	return fmt.Sprintf("Destroy for %s", action.cluster)
 }
 
-func (action destroyCluster) Apply() error {
+func (action destroyCluster) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"cluster": action.cluster,
 	}).Info("Cluster.destroyCluster.Apply")
@@ -192,7 +225,7 @@ func (action destroyCluster) Apply() error {
 	// reset connect details as cluster is being destroyed now, so assume it's no longer accessible
 	action.cluster.connection = ConnectDetails{}
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, clusterDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, clusterDir, provider.Terraform(),
 		"destroy", "-force"); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": clusterDir,
@@ -209,6 +242,10 @@ func (action destroyCluster) IsExclusive() bool {
 	return false
 }
 
+func (action destroyCluster) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action destroyCluster) Prerequisites() ([]controller.Target, error) {
 	return []controller.Target{}, nil
 }
@@ -3,6 +3,7 @@ package cluster
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -71,6 +72,12 @@ func (s Status) String() string {
 	return result
 }
 
+// StatusGraph returns a blank cluster together with all its statuses for static checks
+// of the status graph, e.g. by controller.ValidateGraph
+func StatusGraph() (controller.Thing, []controller.Status) {
+	return &clusterState{}, []controller.Status{Nothing, Configured, Spawned}
+}
+
 type clusterState struct {
 	status        Status
 	name          string
@@ -303,3 +310,8 @@ func CreateClusterTarget(prov provider.Provider, userVariables config.Config,
 
 	return &cluster, nil
 }
+
+// ActionTimeouts return timeouts of actions given in the parameters of the cluster
+func (cluster *clusterState) ActionTimeouts() map[string]time.Duration {
+	return cluster.serviceParams.ActionTimeouts
+}
@@ -1 +1,91 @@
 package cluster
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"enzyme/pkg/config"
+	"enzyme/pkg/controller/controllertest"
+	"enzyme/pkg/state"
+)
+
+func TestStatusGraph(t *testing.T) {
+	thing, statuses := StatusGraph()
+
+	controllertest.CheckStatusGraph(t, thing, statuses, []controllertest.Transition{
+		{From: Nothing, To: Configured, Action: "cluster.makeConfig"},
+		{From: Configured, To: Spawned, Action: "cluster.spawnCluster"},
+		{From: Spawned, To: Configured, Action: "cluster.destroyCluster"},
+		{From: Nothing, To: Spawned},
+		{From: Configured, To: Nothing},
+		{From: Spawned, To: Nothing},
+	})
+}
+
+func TestChangedVariables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluster_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentials := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(credentials, []byte("{}"), 0600); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	userVariables := config.CreateJSONConfig()
+	userVariables.SetValue("worker_count", "4")
+
+	stored := persistent{
+		SchemaVersion: schemaVersion,
+		Name:          "sample",
+		Provider:      providerPersist{Name: "gcp", Region: "us-central1", Zone: "a", Creds: credentials},
+		UserVars:      userVarsPersist{WorkerCount: "2"},
+	}
+
+	tests := []struct {
+		status  Status
+		policy  config.ChangedVariablesPolicy
+		changed bool
+		loaded  bool
+	}{
+		{Configured, config.RefuseChangedVariables, false, false},
+		{Spawned, config.RefuseChangedVariables, true, false},
+		{Configured, config.ReportChangedVariables, true, false},
+		{Spawned, config.AdoptChangedVariables, false, true},
+	}
+
+	for _, test := range tests {
+		stored.Status = int(test.status)
+		blueprint := &clusterState{
+			name:          "sample",
+			userVariables: userVariables,
+			fetcher:       state.Fetcher{Chest: &state.MemChest{}},
+			serviceParams: config.ServiceParams{ChangedVariables: test.policy},
+		}
+
+		loaded, err := blueprint.FromPublic(stored)
+
+		var changedErr *state.ChangedVariablesError
+		if changed := errors.As(err, &changedErr); changed != test.changed {
+			t.Errorf("%s, policy %d: wrong error: [%v]", test.status, test.policy, err)
+		} else if changed && (len(changedErr.Changes) != 1 ||
+			changedErr.Changes[0] != state.Change{Name: "worker_count", Stored: "2", Requested: "4"}) {
+			t.Errorf("%s, policy %d: wrong changes: [%v]", test.status, test.policy, changedErr.Changes)
+		}
+
+		if (loaded != nil) != test.loaded {
+			t.Errorf("%s, policy %d: wrong loaded state: [%v]", test.status, test.policy, loaded)
+		}
+
+		if test.loaded {
+			if saved, _ := blueprint.fetcher.Load(loaded); saved != nil {
+				t.Errorf("adopted cluster is saved while it's loaded: [%v]", saved)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/entities/common"
+	"enzyme/pkg/provider"
+)
+
+// Import adopts resources of the cluster existing in the cloud under cloudID, ids given by resource
+// addresses override the ones found by the provider. The cluster must be configured. It becomes spawned
+// if the resources match the configuration, otherwise it stays configured, so spawning it applies
+// the configuration to the imported resources.
+func (cluster *clusterState) Import(ctx context.Context, cloudID string, ids map[string]string) error {
+	if cluster.status != Configured {
+		return fmt.Errorf("cluster must be configured to import resources, it is %s", cluster.status)
+	}
+
+	variables := map[string]string{}
+
+	for _, name := range []string{"worker_count", "project_name"} {
+		value, err := getVariable(cluster.userVariables, cluster.templatePath, name)
+		if err != nil {
+			return err
+		}
+
+		variables[name] = value
+	}
+
+	resources, err := common.ResolveImportedResources(cluster.provider, provider.ClusterDescriptor, cloudID,
+		variables, ids)
+	if err != nil {
+		return err
+	}
+
+	tfLogPrefix, err := cluster.makeToolLogPrefix("terraform")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cluster": cluster,
+		}).Warnf("Cluster.Import: cannot make logfile name: %s", err)
+	}
+
+	imported, err := common.ImportTerraformResources(ctx, tfLogPrefix, cluster.getClusterDir(), resources)
+	if err != nil {
+		return err
+	}
+
+	if imported.Changed {
+		log.WithFields(log.Fields{
+			"cluster":   cluster,
+			"resources": imported.Resources,
+		}).Info("Cluster.Import: imported resources differ from the configuration")
+
+		return nil
+	}
+
+	if err := refreshConnectDetails(ctx, cluster, Spawned); err != nil {
+		return err
+	}
+
+	return cluster.SetStatus(Spawned)
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -19,7 +20,7 @@ type ResourceDescriptor struct {
 
 // GetNetworkResources retrieves network resources managed by the cluster, usually
 // "network" and "subnetwork" parts
-func GetNetworkResources(from controller.Thing) ([]ResourceDescriptor, error) {
+func GetNetworkResources(ctx context.Context, from controller.Thing) ([]ResourceDescriptor, error) {
 	result := []ResourceDescriptor{}
 
 	cluster, ok := from.(*clusterState)
@@ -37,7 +38,7 @@ func GetNetworkResources(from controller.Thing) ([]ResourceDescriptor, error) {
 		return result, fmt.Errorf("cluster must be spawned")
 	}
 
-	json, err := parseTerraformJSON(cluster)
+	json, err := parseTerraformJSON(ctx, cluster)
 	if err != nil {
 		return result, err
 	}
@@ -98,7 +99,7 @@ func GetConnectDetails(from controller.Thing) (ConnectDetails, error) {
 	return cluster.connection, nil
 }
 
-func refreshConnectDetails(cluster *clusterState, nextStatus Status) error {
+func refreshConnectDetails(ctx context.Context, cluster *clusterState, nextStatus Status) error {
 	if !nextStatus.Satisfies(Spawned) {
 		log.WithFields(log.Fields{
 			"cluster": cluster,
@@ -108,7 +109,7 @@ func refreshConnectDetails(cluster *clusterState, nextStatus Status) error {
 		return fmt.Errorf("cluster must be spawned")
 	}
 
-	json, err := parseTerraformJSON(cluster)
+	json, err := parseTerraformJSON(ctx, cluster)
 	if err != nil {
 		return err
 	}
@@ -128,7 +129,7 @@ func refreshConnectDetails(cluster *clusterState, nextStatus Status) error {
 	return nil
 }
 
-func parseTerraformJSON(cluster *clusterState) (config.Config, error) {
+func parseTerraformJSON(ctx context.Context, cluster *clusterState) (config.Config, error) {
 	clusterRootDir, _ := filepath.Split(cluster.configPath)
 	logger := log.WithField("cluster", cluster)
 
@@ -137,7 +138,7 @@ func parseTerraformJSON(cluster *clusterState) (config.Config, error) {
 		logger.Warnf("parseTerraformJSON: cannot make logfile name: %s", err)
 	}
 
-	return provider.ParseTerraformOutputs(clusterRootDir, tfLogPrefix, logger)
+	return provider.ParseTerraformOutputs(ctx, clusterRootDir, tfLogPrefix, logger)
 }
 
 // for additional information provided by "enzyme state"
@@ -6,6 +6,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"enzyme/pkg/provider"
+	"enzyme/pkg/secret"
 	"enzyme/pkg/state"
 )
 
@@ -37,17 +38,23 @@ type providerPersist struct {
 }
 
 type userVarsPersist struct {
-	KeyName            string
-	WorkerCount        string
-	LoginInstanceType  string
-	WorkedInstanceType string
-	LoginRootDiskSize  string
-	UserName           string
-	ProjectName        string
-	SSHKeyPairPath     string
+	KeyName            string `var:"key_name"`
+	WorkerCount        string `var:"worker_count"`
+	LoginInstanceType  string `var:"instance_type_login_node"`
+	WorkedInstanceType string `var:"instance_type_worker_node"`
+	LoginRootDiskSize  string `var:"login_node_root_size"`
+	UserName           string `var:"user_name"`
+	ProjectName        string `var:"project_name"`
+	SSHKeyPairPath     string `var:"ssh_key_pair_path"`
 }
 
+// schemaVersion is the version of persistent layout, it's increased together with registering
+// a state migration from the previous version whenever persistent changes
+const schemaVersion = 1
+
 type persistent struct {
+	SchemaVersion int
+
 	Status       int
 	Name         string
 	ImageName    string
@@ -115,11 +122,15 @@ func (cluster *clusterState) getUserVars() userVarsPersist {
 		result.SSHKeyPairPath = ""
 	}
 
+	// values containing secrets are kept as their fingerprints
+	secret.FingerprintFields(&result)
+
 	return result
 }
 
 func (cluster *clusterState) ToPublic() (interface{}, error) {
 	return persistent{
+		schemaVersion,
 		int(cluster.status),
 		cluster.name,
 		cluster.imageName,
@@ -148,14 +159,10 @@ func (cluster *clusterState) FromPublic(v interface{}) (state.Entry, error) {
 	}
 
 	if cluster.userVariables != nil {
-		userVars := cluster.getUserVars()
-		if persist.UserVars != userVars {
-			log.WithFields(log.Fields{
-				"loaded-vars":  persist.UserVars,
-				"current-vars": userVars,
-			}).Info("Cluster.FromPublic: loaded user variables differ from current, invalidating stored state")
-
-			return nil, nil
+		keep, err := state.CheckVariables(persist.UserVars, cluster.getUserVars(), Status(persist.Status) == Spawned,
+			cluster.serviceParams.ChangedVariables)
+		if !keep {
+			return nil, err
 		}
 	} else {
 		log.WithFields(log.Fields{
@@ -197,6 +204,28 @@ func (cluster *clusterState) FromPublic(v interface{}) (state.Entry, error) {
 	}, nil
 }
 
+// Reload re-reads the stored state of the cluster, it's needed when the same cluster
+// was changed through another object
+func (cluster *clusterState) Reload() error {
+	loaded, err := cluster.fetcher.Load(cluster)
+	if err != nil {
+		log.WithField("cluster", cluster).Errorf("Cluster.Reload: cannot load state: %s", err)
+		return err
+	}
+
+	if loaded != nil {
+		*cluster = *loaded.(*clusterState)
+	}
+
+	return nil
+}
+
+// Lock acquires the lock of the cluster shared by all enzyme processes, it also guards
+// the directory with its configuration files
+func (cluster *clusterState) Lock() (func(), error) {
+	return cluster.fetcher.Lock(cluster)
+}
+
 func handler(hier []string, fetcher state.Fetcher) state.Entry {
 	if len(hier) != 0 && hier[0] == "cluster" {
 		return &clusterState{
@@ -209,4 +238,5 @@ func handler(hier []string, fetcher state.Fetcher) state.Entry {
 
 func init() {
 	state.RegisterHandler(handler)
+	state.RegisterSchema("cluster", schemaVersion)
 }
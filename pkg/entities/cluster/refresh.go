@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/entities/common"
+)
+
+// Refresh checks that resources of the cluster exist in the cloud as its status says
+func (cluster *clusterState) Refresh(ctx context.Context) (controller.Drift, error) {
+	drift := controller.Drift{Stored: cluster.status, Actual: cluster.status}
+	if cluster.status == Nothing {
+		return drift, nil
+	}
+
+	tfLogPrefix, err := cluster.makeToolLogPrefix("terraform")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cluster": cluster,
+		}).Warnf("Cluster.Refresh: cannot make logfile name: %s", err)
+	}
+
+	refreshed, err := common.RefreshTerraformState(ctx, tfLogPrefix, cluster.getClusterDir())
+	if err != nil {
+		return drift, err
+	}
+
+	switch {
+	case cluster.status == Spawned && len(refreshed.Resources) == 0:
+		drift.Actual = Configured
+		drift.Details = "cluster resources are not found in the cloud"
+	case cluster.status == Spawned && refreshed.Changed:
+		drift.Details = "cluster resources differ from the configuration, some of them are changed or deleted"
+	case cluster.status == Configured && len(refreshed.Resources) != 0:
+		drift.Details = fmt.Sprintf("%d resources of the cluster are left in the cloud", len(refreshed.Resources))
+	}
+
+	return drift, nil
+}
+
+// Reconcile sets the status found by Refresh, connection details are dropped unless the cluster is spawned
+func (cluster *clusterState) Reconcile(drift controller.Drift) error {
+	status, ok := drift.Actual.(Status)
+	if !ok {
+		return fmt.Errorf("cannot set status of cluster - wrong type")
+	}
+
+	if !status.Satisfies(Spawned) {
+		cluster.connection = ConnectDetails{}
+	}
+
+	return cluster.SetStatus(status)
+}
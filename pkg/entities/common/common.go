@@ -6,8 +6,9 @@ import (
 
 // SyncedStr is a struct that synchronizes reading/writing a string variable
 type SyncedStr struct {
-	value string
-	mux   sync.Mutex
+	value    string
+	onChange func(value string)
+	mux      sync.Mutex
 }
 
 // Get returns synchronized string value
@@ -21,7 +22,21 @@ func (ss *SyncedStr) Get() string {
 // Set puts new value with synchronization
 func (ss *SyncedStr) Set(value string) {
 	ss.mux.Lock()
+	changed := ss.value != value
 	ss.value = value
+	onChange := ss.onChange
+	ss.mux.Unlock()
+
+	if changed && onChange != nil {
+		onChange(value)
+	}
+}
+
+// OnChange registers a function called with the new value every time the value changes,
+// nil removes the registered function
+func (ss *SyncedStr) OnChange(callback func(value string)) {
+	ss.mux.Lock()
+	ss.onChange = callback
 	ss.mux.Unlock()
 }
 
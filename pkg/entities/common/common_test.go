@@ -1 +1,266 @@
 package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/config"
+	"enzyme/pkg/provider"
+	"enzyme/pkg/state"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard) // logs hide
+}
+
+func TestIsTransientToolError(t *testing.T) {
+	dirTempFolder, errTempDir := ioutil.TempDir("", "common_unit_tests_temp")
+	if errTempDir != nil {
+		t.Fatalf("TempDir function returned error: [%s]", errTempDir)
+	}
+	defer os.RemoveAll(dirTempFolder)
+
+	transientLog := filepath.Join(dirTempFolder, "transient.log")
+	if err := ioutil.WriteFile(transientLog, []byte("Error: googleapi: Error 429: Rate Limit Exceeded"), 0644); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	fatalLog := filepath.Join(dirTempFolder, "fatal.log")
+	if err := ioutil.WriteFile(fatalLog, []byte("Error: Invalid value for variable"), 0644); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	exitErr := errors.New("exit status 1")
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&ToolError{Err: exitErr, LogFile: transientLog}, true},
+		{fmt.Errorf("wrapped: %w", &ToolError{Err: exitErr, LogFile: transientLog}), true},
+		{&ToolError{Err: exitErr, LogFile: fatalLog}, false},
+		{&ToolError{Err: exitErr, LogFile: filepath.Join(dirTempFolder, "missing.log")}, false},
+		{&ToolError{Err: context.Canceled, LogFile: transientLog}, false},
+		{exitErr, false},
+	}
+
+	for _, test := range tests {
+		if result := IsTransientToolError(test.err); result != test.expected {
+			t.Errorf("wrong classification of error [%s]: [%t]!=[%t]", test.err, test.expected, result)
+		}
+	}
+}
+
+func TestIsMissingObjectError(t *testing.T) {
+	dirTempFolder, errTempDir := ioutil.TempDir("", "common_unit_tests_temp")
+	if errTempDir != nil {
+		t.Fatalf("TempDir function returned error: [%s]", errTempDir)
+	}
+	defer os.RemoveAll(dirTempFolder)
+
+	missingLog := filepath.Join(dirTempFolder, "missing.log")
+	if err := ioutil.WriteFile(missingLog, []byte("Error: Cannot import non-existent remote object"), 0644); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	deniedLog := filepath.Join(dirTempFolder, "denied.log")
+	if err := ioutil.WriteFile(deniedLog, []byte("Error: googleapi: Error 403: Permission denied"), 0644); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	exitErr := errors.New("exit status 1")
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&ToolError{Err: exitErr, LogFile: missingLog}, true},
+		{fmt.Errorf("wrapped: %w", &ToolError{Err: exitErr, LogFile: missingLog}), true},
+		{&ToolError{Err: exitErr, LogFile: deniedLog}, false},
+		{&ToolError{Err: exitErr, LogFile: filepath.Join(dirTempFolder, "absent.log")}, false},
+		{&ToolError{Err: exitErr}, false},
+		{exitErr, false},
+	}
+
+	for _, test := range tests {
+		if result := isMissingObjectError(test.err); result != test.expected {
+			t.Errorf("wrong classification of error [%s]: [%t]!=[%t]", test.err, test.expected, result)
+		}
+	}
+}
+
+type hierarchyEntry []string
+
+func (entry hierarchyEntry) Hierarchy() ([]string, error) {
+	return entry, nil
+}
+
+func (entry hierarchyEntry) ToPublic() (interface{}, error) {
+	return nil, nil
+}
+
+func (entry hierarchyEntry) FromPublic(v interface{}) (state.Entry, error) {
+	return entry, nil
+}
+
+func TestConfigureTerraformBackend(t *testing.T) {
+	dirTempFolder, errTempDir := ioutil.TempDir("", "common_unit_tests_temp")
+	if errTempDir != nil {
+		t.Fatalf("TempDir function returned error: [%s]", errTempDir)
+	}
+	defer os.RemoveAll(dirTempFolder)
+
+	entry := hierarchyEntry{"cluster", "gcp-zone", "name"}
+	backendFile := filepath.Join(dirTempFolder, terraformBackendFile)
+
+	if err := ConfigureTerraformBackend(dirTempFolder, nil, entry); err != nil {
+		t.Errorf("ConfigureTerraformBackend function returned error: [%s]", err)
+	}
+
+	if _, err := os.Stat(backendFile); !os.IsNotExist(err) || len(TerraformInitArgs(nil)) != 1 {
+		t.Errorf("backend is configured without settings: [%v]", err)
+	}
+
+	backend := &config.TerraformBackend{Endpoint: "http://localhost:9000", Bucket: "team", Region: "us-east-1",
+		Prefix: "enzyme"}
+	if err := ConfigureTerraformBackend(dirTempFolder, backend, entry); err != nil {
+		t.Errorf("ConfigureTerraformBackend function returned error: [%s]", err)
+	}
+
+	content, err := ioutil.ReadFile(backendFile)
+	if err != nil {
+		t.Fatalf("ReadFile function returned error: [%s]", err)
+	}
+
+	for _, expected := range []string{
+		`backend "s3"`,
+		`bucket                      = "team"`,
+		`key                         = "enzyme/terraform/cluster/gcp-zone/name.tfstate"`,
+		`endpoint                    = "http://localhost:9000"`,
+		`force_path_style            = true`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("backend doesn't contain [%s]:\n%s", expected, content)
+		}
+	}
+}
+
+func TestTerraformScratchState(t *testing.T) {
+	dirTempFolder, errTempDir := ioutil.TempDir("", "common_unit_tests_temp")
+	if errTempDir != nil {
+		t.Fatalf("TempDir function returned error: [%s]", errTempDir)
+	}
+	defer os.RemoveAll(dirTempFolder)
+
+	currentState := filepath.Join(dirTempFolder, terraformStateFile)
+	scratchState := filepath.Join(dirTempFolder, "scratch.tfstate")
+
+	// nothing was created yet, so there's nothing to copy
+	scratch, err := NewTerraformScratchState(context.Background(), "", dirTempFolder, "scratch.tfstate")
+	if err != nil {
+		t.Fatalf("NewTerraformScratchState function returned error: [%s]", err)
+	}
+
+	if _, err := os.Stat(scratchState); !os.IsNotExist(err) {
+		t.Errorf("missing state is copied: [%v]", err)
+	}
+
+	if args := scratch.Args(); len(args) != 1 || args[0] != "-state="+scratchState {
+		t.Errorf("wrong arguments of local state: %v", args)
+	}
+
+	if err := ioutil.WriteFile(currentState, []byte("current"), 0640); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	// the copy left by a failed attempt is replaced by the current state
+	if err := ioutil.WriteFile(scratchState, []byte("failed"), 0640); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	scratch, err = NewTerraformScratchState(context.Background(), "", dirTempFolder, "scratch.tfstate")
+	if err != nil {
+		t.Fatalf("NewTerraformScratchState function returned error: [%s]", err)
+	}
+
+	if content, err := ioutil.ReadFile(scratchState); err != nil || string(content) != "current" {
+		t.Errorf("wrong copy of state: [current]!=[%s] [%v]", content, err)
+	}
+
+	if err := ioutil.WriteFile(scratchState, []byte("changed"), 0640); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	if err := scratch.Discard(context.Background()); err != nil {
+		t.Errorf("Discard function returned error: [%s]", err)
+	}
+
+	if content, err := ioutil.ReadFile(currentState); err != nil || string(content) != "current" {
+		t.Errorf("discarded copy replaced state: [current]!=[%s] [%v]", content, err)
+	}
+
+	if err := scratch.Commit(); err != nil {
+		t.Errorf("Commit function returned error: [%s]", err)
+	}
+
+	if content, err := ioutil.ReadFile(currentState); err != nil || string(content) != "changed" {
+		t.Errorf("committed copy didn't replace state: [changed]!=[%s] [%v]", content, err)
+	}
+}
+
+func TestResolveImportedResources(t *testing.T) {
+	gcp, err := provider.CreateProvider(provider.GCPProviderName, "us-central1", "a", "credentials.json")
+	if err != nil {
+		t.Fatalf("CreateProvider function returned error: [%s]", err)
+	}
+
+	aws, err := provider.CreateProvider(provider.AWSProviderName, "us-east-1", "a", "credentials.json")
+	if err != nil {
+		t.Fatalf("CreateProvider function returned error: [%s]", err)
+	}
+
+	variables := map[string]string{"worker_count": "2", "project_name": "zyme"}
+	ids := map[string]string{
+		"module.gcp_provider.google_compute_network.cluster": "projects/zyme/global/networks/net",
+		"module.gcp_provider.google_compute_route.extra":     "extra-route",
+	}
+
+	resources, err := ResolveImportedResources(gcp, provider.ClusterDescriptor, "hpc", variables, ids)
+	if err != nil {
+		t.Fatalf("ResolveImportedResources function returned error: [%s]", err)
+	}
+
+	found := map[string]string{}
+	for _, resource := range resources {
+		found[resource.Address] = resource.ID
+	}
+
+	for address, id := range map[string]string{
+		"module.gcp_provider.google_compute_network.cluster":    "projects/zyme/global/networks/net",
+		"module.gcp_provider.google_compute_instance.login":     "zyme/us-central1-a/hpc-login",
+		"module.gcp_provider.google_compute_instance.worker[1]": "zyme/us-central1-a/hpc-worker-1",
+		"module.gcp_provider.google_compute_route.extra":        "extra-route",
+	} {
+		if found[address] != id {
+			t.Errorf("wrong ID of [%s]: [%s]!=[%s]", address, id, found[address])
+		}
+	}
+
+	if _, err := ResolveImportedResources(aws, provider.ClusterDescriptor, "hpc", variables, nil); err == nil {
+		t.Errorf("resources of aws cluster are found by its name")
+	}
+
+	resources, err = ResolveImportedResources(aws, provider.ClusterDescriptor, "hpc", variables,
+		map[string]string{"module.aws_provider.aws_vpc.cluster": "vpc-1234"})
+	if err != nil || len(resources) != 1 || resources[0].ID != "vpc-1234" || resources[0].Optional {
+		t.Errorf("given resources of aws cluster are not resolved: [%v], %+v", err, resources)
+	}
+}
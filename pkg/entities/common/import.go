@@ -0,0 +1,167 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	action_pkg "enzyme/pkg/action"
+	"enzyme/pkg/provider"
+)
+
+var (
+	// missingObjectMarkers are lowercase substrings of logs of "terraform import" which mean
+	// the imported object doesn't exist in the cloud
+	missingObjectMarkers = []string{
+		"cannot import non-existent remote object",
+	}
+)
+
+// isMissingObjectError tells if err is a ToolError of "terraform import" failed as the object doesn't exist
+func isMissingObjectError(err error) bool {
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.LogFile == "" {
+		return false
+	}
+
+	return findLogMarker(toolErr.LogFile, missingObjectMarkers) != ""
+}
+
+// hasTerraformState tells if terraform of dir has some state, local or kept in the backend
+func hasTerraformState(dir string) bool {
+	for _, name := range []string{terraformBackendFile, terraformStateFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ImportTerraformResources adopts existing cloud resources into terraform state of dir by
+// "terraform import" and refreshes the state, so outputs of the configuration can be read.
+// Resources already kept in the state are skipped, optional resources terraform reports as
+// non-existent are left for it to create, other failures of import are returned. Returned state tells which resources are managed now and whether
+// they match the configuration.
+func ImportTerraformResources(ctx context.Context, logPrefix, dir string,
+	resources []provider.ImportedResource) (RefreshedState, error) {
+	result := RefreshedState{}
+	logger := log.WithField("dir", dir)
+
+	managed := map[string]bool{}
+
+	if hasTerraformState(dir) {
+		known, err := listTerraformResources(ctx, logPrefix, dir, nil)
+		if err != nil {
+			return result, err
+		}
+
+		for _, address := range known {
+			managed[address] = true
+		}
+	}
+
+	for _, resource := range resources {
+		if managed[resource.Address] {
+			logger.WithField("address", resource.Address).Info(
+				"ImportTerraformResources: resource is already managed")
+
+			continue
+		}
+
+		logname, err := action_pkg.RunLoggedCmdDir(ctx, logPrefix, dir, provider.Terraform(),
+			"import", "-no-color", "-input=false", resource.Address, resource.ID)
+		if err != nil {
+			toolErr := &ToolError{
+				Err:     fmt.Errorf("cannot import %s as %s: %w", resource.ID, resource.Address, err),
+				LogFile: logname,
+			}
+
+			if resource.Optional && ctx.Err() == nil && isMissingObjectError(toolErr) {
+				logger.WithFields(log.Fields{
+					"address": resource.Address,
+					"id":      resource.ID,
+				}).Info("ImportTerraformResources: optional resource doesn't exist, it's not imported")
+
+				continue
+			}
+
+			logger.WithFields(log.Fields{
+				"address": resource.Address,
+				"id":      resource.ID,
+			}).Errorf("ImportTerraformResources: cannot import resource: %s", err)
+
+			return result, toolErr
+		}
+	}
+
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, logPrefix, dir, provider.Terraform(),
+		"refresh", "-no-color", "-input=false"); err != nil {
+		logger.Errorf("ImportTerraformResources: 'terraform refresh' failed: %s", err)
+
+		return result, &ToolError{Err: err, LogFile: logname}
+	}
+
+	imported, err := listTerraformResources(ctx, logPrefix, dir, nil)
+	if err != nil {
+		return result, err
+	}
+
+	result.Resources = imported
+
+	result.Changed, err = planHasChanges(ctx, logPrefix, dir, nil)
+
+	return result, err
+}
+
+// ResolveImportedResources returns resources of the object identified by cloudID in the cloud as
+// found by the provider, ids given by resource addresses replace the found ones and add resources
+// the provider doesn't know of. If the provider cannot find resources, all of them must be given.
+func ResolveImportedResources(prov provider.Provider, descriptor, cloudID string, variables map[string]string,
+	ids map[string]string) ([]provider.ImportedResource, error) {
+	resources, err := prov.GetImportedResources(descriptor, cloudID, variables)
+	if err != nil {
+		if len(ids) == 0 {
+			log.WithFields(log.Fields{
+				"descriptor": descriptor,
+				"cloud-id":   cloudID,
+			}).Errorf("ResolveImportedResources: cannot find resources: %s", err)
+
+			return nil, err
+		}
+
+		resources = []provider.ImportedResource{}
+	}
+
+	known := map[string]bool{}
+
+	for idx, resource := range resources {
+		known[resource.Address] = true
+
+		if id, ok := ids[resource.Address]; ok {
+			resources[idx].ID = id
+			resources[idx].Optional = false
+		}
+	}
+
+	addresses := []string{}
+
+	for address := range ids {
+		if !known[address] {
+			addresses = append(addresses, address)
+		}
+	}
+
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		resources = append(resources, provider.ImportedResource{Address: address, ID: ids[address]})
+	}
+
+	return resources, nil
+}
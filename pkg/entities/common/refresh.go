@@ -0,0 +1,118 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	action_pkg "enzyme/pkg/action"
+	"enzyme/pkg/provider"
+)
+
+const (
+	terraformStateFile = "terraform.tfstate"
+	refreshedStateFile = "refreshed.tfstate"
+
+	// planChangesExitCode is returned by "terraform plan -detailed-exitcode" when resources differ
+	planChangesExitCode = 2
+)
+
+// RefreshedState describes real resources known to terraform state of a directory
+type RefreshedState struct {
+	// Resources are addresses of managed resources which still exist in the cloud, data sources
+	// are not included
+	Resources []string
+	// Changed is true if the existing resources differ from the configuration
+	Changed bool
+}
+
+// RefreshTerraformState runs "terraform refresh" in dir and finds out which resources of its state
+// still exist and whether they match the configuration. A local state is refreshed in a copy, so
+// the state itself is not changed; a state kept in the backend is refreshed in place, as terraform
+// does by itself before every plan.
+func RefreshTerraformState(ctx context.Context, logPrefix, dir string) (RefreshedState, error) {
+	result := RefreshedState{}
+	logger := log.WithField("dir", dir)
+
+	var stateArgs, refreshArgs []string
+
+	if _, err := os.Stat(filepath.Join(dir, terraformBackendFile)); os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Join(dir, terraformStateFile)); os.IsNotExist(err) {
+			logger.Info("RefreshTerraformState: no terraform state, nothing was created")
+			return result, nil
+		}
+
+		defer os.Remove(filepath.Join(dir, refreshedStateFile))
+
+		stateArgs = []string{"-state=" + refreshedStateFile}
+		refreshArgs = []string{"-state-out=" + refreshedStateFile, "-backup=-"}
+	}
+
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, logPrefix, dir, provider.Terraform(),
+		append([]string{"refresh", "-no-color", "-input=false"}, refreshArgs...)...); err != nil {
+		logger.Errorf("RefreshTerraformState: 'terraform refresh' failed: %s", err)
+
+		return result, &ToolError{Err: err, LogFile: logname}
+	}
+
+	resources, err := listTerraformResources(ctx, logPrefix, dir, stateArgs)
+	if err != nil {
+		return result, err
+	}
+
+	result.Resources = resources
+	if len(resources) == 0 {
+		return result, nil
+	}
+
+	result.Changed, err = planHasChanges(ctx, logPrefix, dir, stateArgs)
+
+	return result, err
+}
+
+// listTerraformResources returns addresses of managed resources kept in terraform state of dir
+func listTerraformResources(ctx context.Context, logPrefix, dir string, stateArgs []string) ([]string, error) {
+	var buffer bytes.Buffer
+	if logname, err := action_pkg.RunLoggedCmdDirOutput(ctx, logPrefix, dir, &buffer, provider.Terraform(),
+		append([]string{"state", "list"}, stateArgs...)...); err != nil {
+		log.WithField("dir", dir).Errorf("listTerraformResources: 'terraform state list' failed: %s", err)
+
+		return nil, &ToolError{Err: err, LogFile: logname}
+	}
+
+	resources := []string{}
+
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		address := strings.TrimSpace(scanner.Text())
+		if address != "" && !strings.HasPrefix(address, "data.") && !strings.Contains(address, ".data.") {
+			resources = append(resources, address)
+		}
+	}
+
+	return resources, nil
+}
+
+// planHasChanges tells if terraform would change resources of dir to match the configuration
+func planHasChanges(ctx context.Context, logPrefix, dir string, stateArgs []string) (bool, error) {
+	logname, err := action_pkg.RunLoggedCmdDir(ctx, logPrefix, dir, provider.Terraform(),
+		append([]string{"plan", "-no-color", "-input=false", "-refresh=false", "-detailed-exitcode"},
+			stateArgs...)...)
+	if err != nil {
+		if exited, ok := err.(*exec.ExitError); ok && exited.ExitCode() == planChangesExitCode {
+			return true, nil
+		}
+
+		log.WithField("dir", dir).Errorf("planHasChanges: 'terraform plan' failed: %s", err)
+
+		return false, &ToolError{Err: err, LogFile: logname}
+	}
+
+	return false, nil
+}
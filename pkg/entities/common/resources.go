@@ -0,0 +1,11 @@
+package common
+
+// Resource classes of actions limited by the executor, see controller.ResourceAction
+const (
+	// TerraformResource is consumed by actions running terraform
+	TerraformResource = "terraform"
+	// PackerResource is consumed by actions running packer
+	PackerResource = "packer"
+	// SSHResource is consumed by actions talking to cluster nodes over SSH
+	SSHResource = "ssh"
+)
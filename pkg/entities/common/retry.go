@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/controller"
+)
+
+var (
+	// ToolRetryPolicy is used by actions which run terraform or packer against the cloud
+	ToolRetryPolicy = controller.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  2 * time.Minute,
+	}
+
+	// transientErrorMarkers are lowercase substrings of tool logs which mean the failure
+	// was caused by rate limits, eventual consistency or temporary cloud unavailability
+	transientErrorMarkers = []string{
+		"rate limit",
+		"ratelimitexceeded",
+		"requestlimitexceeded",
+		"throttling",
+		"too many requests",
+		"error 429",
+		"error 500",
+		"error 502",
+		"error 503",
+		"backenderror",
+		"serviceunavailable",
+		"internalerror",
+		"resourcenotready",
+		"resourceinusebyanotherresource",
+		"invalidinstanceid.notfound",
+		"invalidgroup.notfound",
+		"invalidsubnetid.notfound",
+		"dependencyviolation",
+		"connection reset by peer",
+		"tls handshake timeout",
+		"i/o timeout",
+	}
+)
+
+// ToolError is returned by actions when an external tool failed,
+// it keeps the name of the tool log so the failure can be classified
+type ToolError struct {
+	Err     error
+	LogFile string
+}
+
+func (toolErr *ToolError) Error() string {
+	return toolErr.Err.Error()
+}
+
+// Unwrap returns the error of the tool
+func (toolErr *ToolError) Unwrap() error {
+	return toolErr.Err
+}
+
+// IsTransientToolError tells if err is a ToolError which log has signs of a temporary failure
+func IsTransientToolError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.LogFile == "" {
+		return false
+	}
+
+	if marker := findLogMarker(toolErr.LogFile, transientErrorMarkers); marker != "" {
+		log.WithFields(log.Fields{
+			"log":    toolErr.LogFile,
+			"marker": marker,
+		}).Info("IsTransientToolError: found transient failure marker")
+
+		return true
+	}
+
+	return false
+}
+
+// findLogMarker returns the first of lowercase markers found in the tool log, or an empty string
+func findLogMarker(logFile string, markers []string) string {
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		log.WithField("log", logFile).Warnf("findLogMarker: cannot read tool log: %s", err)
+		return ""
+	}
+
+	lowered := strings.ToLower(string(content))
+
+	for _, marker := range markers {
+		if strings.Contains(lowered, marker) {
+			return marker
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,210 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	action_pkg "enzyme/pkg/action"
+	"enzyme/pkg/config"
+	"enzyme/pkg/encryption"
+	"enzyme/pkg/provider"
+	"enzyme/pkg/state"
+	"enzyme/pkg/storage"
+)
+
+// terraformBackendFile is merged by terraform into the configuration of the directory
+const terraformBackendFile = "enzyme_backend_override.tf"
+
+// TerraformInitArgs returns arguments of "terraform init" in a directory configured by
+// ConfigureTerraformBackend, the state kept locally so far is copied to the backend
+func TerraformInitArgs(backend *config.TerraformBackend) []string {
+	if backend == nil {
+		return []string{"init"}
+	}
+
+	return []string{"init", "-force-copy"}
+}
+
+// ConfigureTerraformBackend makes terraform in dir keep its state in the backend under the key
+// made of the entity hierarchy, it has to be called before "terraform init". Nil backend leaves
+// the directory as it is, so a state kept in the backend isn't abandoned silently.
+func ConfigureTerraformBackend(dir string, backend *config.TerraformBackend, entry state.Entry) error {
+	if backend == nil {
+		return nil
+	}
+
+	hier, err := entry.Hierarchy()
+	if err != nil {
+		return err
+	}
+
+	settings := [][2]string{
+		{"bucket", fmt.Sprintf("%q", backend.Bucket)},
+		{"key", fmt.Sprintf("%q", path.Join(backend.Prefix, "terraform", strings.Join(hier, "/")+".tfstate"))},
+		{"region", fmt.Sprintf("%q", backend.Region)},
+	}
+
+	if backend.Endpoint != "" {
+		settings = append(settings, [][2]string{
+			{"endpoint", fmt.Sprintf("%q", backend.Endpoint)},
+			{"force_path_style", "true"},
+			{"skip_credentials_validation", "true"},
+			{"skip_metadata_api_check", "true"},
+			{"skip_region_validation", "true"},
+		}...)
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("# generated by enzyme, keeps terraform state in the shared bucket\n")
+	builder.WriteString("terraform {\n  backend \"s3\" {\n")
+
+	for _, setting := range settings {
+		fmt.Fprintf(&builder, "    %-27s = %s\n", setting[0], setting[1])
+	}
+
+	builder.WriteString("  }\n}\n")
+
+	fileName := filepath.Join(dir, terraformBackendFile)
+	if err := ioutil.WriteFile(fileName, []byte(builder.String()), 0640); err != nil {
+		log.WithField("path", fileName).Errorf("ConfigureTerraformBackend: cannot write backend: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// TerraformScratchState lets terraform commands in a directory work on a copy of its state, the
+// copy replaces the state only when all of them succeed
+type TerraformScratchState struct {
+	dir       string
+	logPrefix string
+	// path is the copy the commands work on, or the backup of the state kept in the backend
+	path   string
+	remote bool
+}
+
+// NewTerraformScratchState copies the state of dir to the file name. Terraform can't point its
+// commands to a local copy of the state kept in the backend, so they work on the backend state
+// and the copy is a backup which is pushed back by Discard.
+func NewTerraformScratchState(ctx context.Context, logPrefix, dir, name string) (*TerraformScratchState, error) {
+	scratch := &TerraformScratchState{
+		dir:       dir,
+		logPrefix: logPrefix,
+		path:      filepath.Join(dir, name),
+	}
+	logger := log.WithField("dir", dir)
+
+	// the copy left by a failed attempt may already have some changes, every attempt
+	// starts from the current state
+	for _, leftover := range []string{scratch.path, scratch.path + ".backup"} {
+		if err := os.Remove(leftover); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("NewTerraformScratchState: cannot remove state of previous attempt: %s", err)
+			return nil, err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, terraformBackendFile)); err == nil {
+		scratch.remote = true
+
+		var buffer bytes.Buffer
+		if logname, err := action_pkg.RunLoggedCmdDirOutput(ctx, logPrefix, dir, &buffer, provider.Terraform(),
+			"state", "pull"); err != nil {
+			logger.Errorf("NewTerraformScratchState: 'terraform state pull' failed: %s", err)
+
+			return nil, &ToolError{Err: err, LogFile: logname}
+		}
+
+		if err := encryption.WriteFile(scratch.path, buffer.Bytes()); err != nil {
+			logger.Errorf("NewTerraformScratchState: cannot save state backup: %s", err)
+			return nil, err
+		}
+
+		return scratch, nil
+	}
+
+	currentState := filepath.Join(dir, terraformStateFile)
+	if _, err := os.Stat(currentState); os.IsNotExist(err) {
+		// nothing was created yet, terraform starts the copy by itself
+		return scratch, nil
+	}
+
+	if err := storage.CopyFile(currentState, scratch.path); err != nil {
+		logger.Errorf("NewTerraformScratchState: cannot copy state: %s", err)
+		return nil, err
+	}
+
+	return scratch, nil
+}
+
+// Args returns the arguments pointing terraform commands to the copy of the state
+func (scratch *TerraformScratchState) Args() []string {
+	if scratch.remote {
+		return nil
+	}
+
+	return []string{"-state=" + scratch.path}
+}
+
+// Commit makes the copy the state of the directory
+func (scratch *TerraformScratchState) Commit() error {
+	if scratch.remote {
+		return os.Remove(scratch.path)
+	}
+
+	if err := os.Rename(scratch.path, filepath.Join(scratch.dir, terraformStateFile)); err != nil {
+		log.WithField("dir", scratch.dir).Errorf("TerraformScratchState.Commit: cannot rename state: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// Discard drops the changes the commands made to the state since the copy was made
+func (scratch *TerraformScratchState) Discard(ctx context.Context) error {
+	if !scratch.remote {
+		return nil
+	}
+
+	logger := log.WithField("dir", scratch.dir)
+
+	backup, err := encryption.ReadFile(scratch.path)
+	if err != nil {
+		logger.Errorf("TerraformScratchState.Discard: cannot read state backup: %s", err)
+		return err
+	}
+
+	if len(bytes.TrimSpace(backup)) != 0 {
+		if logname, err := action_pkg.RunLoggedCmdDir(ctx, scratch.logPrefix, scratch.dir, provider.Terraform(),
+			"state", "push", "-force", scratch.path); err != nil {
+			logger.Errorf("TerraformScratchState.Discard: 'terraform state push' failed: %s", err)
+
+			return &ToolError{Err: err, LogFile: logname}
+		}
+
+		return os.Remove(scratch.path)
+	}
+
+	// the backend had no state, so everything the commands added is removed from it
+	resources, err := listTerraformResources(ctx, scratch.logPrefix, scratch.dir, nil)
+	if err != nil || len(resources) == 0 {
+		return err
+	}
+
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, scratch.logPrefix, scratch.dir, provider.Terraform(),
+		append([]string{"state", "rm"}, resources...)...); err != nil {
+		logger.Errorf("TerraformScratchState.Discard: 'terraform state rm' failed: %s", err)
+
+		return &ToolError{Err: err, LogFile: logname}
+	}
+
+	return os.Remove(scratch.path)
+}
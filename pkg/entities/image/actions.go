@@ -2,12 +2,14 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -25,7 +27,7 @@ func (action makeConfig) String() string {
 	return fmt.Sprintf("Configure for %s", action.img)
 }
 
-func (action makeConfig) Apply() error {
+func (action makeConfig) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"image": action.img,
 	}).Info("Image.makeConfig.Apply")
@@ -78,7 +80,7 @@ func (action makeConfig) Apply() error {
 	}
 
 	if logname, err :=
-		action_pkg.RunLoggedCmdDir(tfLogPrefix, imageDestroyDir, provider.Terraform(), "init"); err != nil {
+		action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, imageDestroyDir, provider.Terraform(), "init"); err != nil {
 		log.Errorf("Image.makeConfig: error initializing: %s", err)
 		fmt.Fprintf(os.Stderr, "Failed to initialize tools, see log for details: %s\n", logname)
 
@@ -92,6 +94,10 @@ func (action makeConfig) IsExclusive() bool {
 	return false
 }
 
+func (action makeConfig) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action makeConfig) Prerequisites() ([]controller.Target, error) {
 	return []controller.Target{}, nil
 }
@@ -105,7 +111,7 @@ func (action *buildImage) String() string {
 	return fmt.Sprintf("Build%s for %s", action.stage.Get(), action.img)
 }
 
-func (action *buildImage) imageExists() (bool, error) {
+func (action *buildImage) imageExists(ctx context.Context) (bool, error) {
 	localConfigHash, err := action.img.getConfigHash()
 	if err != nil {
 		return false, err
@@ -125,7 +131,7 @@ func (action *buildImage) imageExists() (bool, error) {
 	action.stage.Set(":checking existence")
 	defer action.stage.Reset()
 
-	if _, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, imageDestroyDir, provider.Terraform(),
+	if _, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, imageDestroyDir, provider.Terraform(),
 		"refresh", "-state-out=checked.tfstate", "-backup=-"); err != nil {
 		if exited, ok := err.(*exec.ExitError); ok {
 			if exited.ExitCode() != -1 {
@@ -136,7 +142,7 @@ func (action *buildImage) imageExists() (bool, error) {
 	}
 
 	var buffer0 bytes.Buffer
-	if logname, err := action_pkg.RunLoggedCmdDirOutput(tfLogPrefix, imageDestroyDir, &buffer0, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDirOutput(ctx, tfLogPrefix, imageDestroyDir, &buffer0, provider.Terraform(),
 		"output", "-state=checked.tfstate", "id"); err != nil {
 		logger.Errorf("Image.imageExists: 'terraform output' failed: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot check if image exists, see log for details: %s\n", logname)
@@ -146,7 +152,7 @@ func (action *buildImage) imageExists() (bool, error) {
 	imageID := strings.TrimSuffix(string(buffer0.Bytes()), "\n")
 
 	imageResourceName := action.img.provider.GetTFImageResourceName()
-	if _, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, imageDestroyDir, provider.Terraform(),
+	if _, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, imageDestroyDir, provider.Terraform(),
 		"import", "-state-out=checked.tfstate", "-backup=-", imageResourceName+".zyme_image",
 		imageID); err != nil {
 		if exited, ok := err.(*exec.ExitError); ok {
@@ -163,7 +169,7 @@ func (action *buildImage) imageExists() (bool, error) {
 	var buffer bytes.Buffer
 
 	if logname, err :=
-		action_pkg.RunLoggedCmdDirOutput(tfLogPrefix, imageDestroyDir, &buffer, provider.Terraform(),
+		action_pkg.RunLoggedCmdDirOutput(ctx, tfLogPrefix, imageDestroyDir, &buffer, provider.Terraform(),
 			"state", "show", "-state=checked.tfstate", imageResourceName+".zyme_image"); err != nil {
 		logger.Errorf("Image.imageExists: cannot read terraform output: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot check if image exists, see log for details: %s\n", logname)
@@ -193,12 +199,12 @@ func (action *buildImage) imageExists() (bool, error) {
 	return remoteConfigHash == localConfigHash, nil
 }
 
-func (action *buildImage) Apply() error {
+func (action *buildImage) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"image": action.img,
 	}).Info("Image.buildImage.Apply")
 
-	exists, err := action.imageExists()
+	exists, err := action.imageExists(ctx)
 	if err != nil {
 		return err
 	}
@@ -230,20 +236,40 @@ func (action *buildImage) Apply() error {
 		}).Warnf("Image.buildImage: cannot make logfile name: %s", err)
 	}
 
-	if logname, err := action_pkg.RunLoggedCmd(packerLogPrefix, provider.Packer(), commandArg...); err != nil {
+	if logname, err := action_pkg.RunLoggedCmd(ctx, packerLogPrefix, provider.Packer(), commandArg...); err != nil {
 		log.Errorf("Image.buildImage: error building: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot build image, see log for details: %s\n", logname)
 
-		return err
+		return &common.ToolError{Err: err, LogFile: logname}
 	}
 
 	return nil
 }
 
+func (action *buildImage) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *buildImage) IsExclusive() bool {
 	return false
 }
 
+func (action *buildImage) ResourceClass() string {
+	return common.PackerResource
+}
+
+func (action *buildImage) RetryPolicy() controller.RetryPolicy {
+	return common.ToolRetryPolicy
+}
+
+func (action *buildImage) ShouldRetry(err error) bool {
+	return common.IsTransientToolError(err)
+}
+
+func (action *buildImage) DefaultTimeout() time.Duration {
+	return 2 * time.Hour
+}
+
 func (action *buildImage) Prerequisites() ([]controller.Target, error) {
 	return []controller.Target{}, nil
 }
@@ -256,7 +282,7 @@ func (action destroyImage) String() string {
 	return fmt.Sprintf("Destroy for %s", action.img)
 }
 
-func (action destroyImage) Apply() error {
+func (action destroyImage) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"image": action.img,
 	}).Info("Image.destroyImage.Apply")
@@ -279,7 +305,7 @@ func (action destroyImage) Apply() error {
 	}
 
 	imageResourceName := action.img.provider.GetTFImageResourceName()
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, imageDestroyDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, imageDestroyDir, provider.Terraform(),
 		"import", "-state-out=imported.tfstate", "-backup=-", imageResourceName+".zyme_image",
 		action.img.name); err != nil {
 		log.Errorf("Image.destroyImage: error importing image: %s", err)
@@ -288,7 +314,7 @@ func (action destroyImage) Apply() error {
 		return err
 	}
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, imageDestroyDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, imageDestroyDir, provider.Terraform(),
 		"destroy", "-state=imported.tfstate", "-backup=-", "-force"); err != nil {
 		log.Errorf("Image.destroyImage: error destroying image: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot destroy image, see log for details: %s\n", logname)
@@ -303,6 +329,10 @@ func (action destroyImage) IsExclusive() bool {
 	return false
 }
 
+func (action destroyImage) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action destroyImage) Prerequisites() ([]controller.Target, error) {
 	return []controller.Target{}, nil
 }
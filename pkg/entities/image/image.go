@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -71,6 +72,12 @@ func (s Status) String() string {
 	return result
 }
 
+// StatusGraph returns a blank image together with all its statuses for static checks
+// of the status graph, e.g. by controller.ValidateGraph
+func StatusGraph() (controller.Thing, []controller.Status) {
+	return &imgState{}, []controller.Status{Nothing, Configured, Created}
+}
+
 type imgState struct {
 	status        Status
 	name          string
@@ -296,3 +303,8 @@ func CreateImageTarget(prov provider.Provider, userVariables config.Config,
 
 	return &image, nil
 }
+
+// ActionTimeouts return timeouts of actions given in the parameters of the image
+func (img *imgState) ActionTimeouts() map[string]time.Duration {
+	return img.serviceParameters.ActionTimeouts
+}
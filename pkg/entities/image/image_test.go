@@ -1 +1,20 @@
 package image
+
+import (
+	"testing"
+
+	"enzyme/pkg/controller/controllertest"
+)
+
+func TestStatusGraph(t *testing.T) {
+	thing, statuses := StatusGraph()
+
+	controllertest.CheckStatusGraph(t, thing, statuses, []controllertest.Transition{
+		{From: Nothing, To: Configured, Action: "image.makeConfig"},
+		{From: Configured, To: Created, Action: "image.buildImage"},
+		{From: Created, To: Configured, Action: "image.destroyImage"},
+		{From: Nothing, To: Created},
+		{From: Configured, To: Nothing},
+		{From: Created, To: Nothing},
+	})
+}
@@ -0,0 +1,59 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	action_pkg "enzyme/pkg/action"
+	"enzyme/pkg/entities/common"
+	"enzyme/pkg/provider"
+)
+
+// Import adopts the image existing in the cloud under cloudID, an id given by the address of the image
+// resource overrides cloudID. Images are not kept in terraform state, they are found by the name
+// whenever needed, so the image is only checked to exist. The image must be configured.
+func (img *imgState) Import(ctx context.Context, cloudID string, ids map[string]string) error {
+	if img.status != Configured {
+		return fmt.Errorf("image must be configured to import it, it is %s", img.status)
+	}
+
+	resources, err := common.ResolveImportedResources(img.provider, provider.ImageDescriptor, cloudID,
+		map[string]string{}, ids)
+	if err != nil {
+		return err
+	}
+
+	imageDestroyDir, _ := filepath.Split(img.configPath)
+
+	tfLogPrefix, err := img.makeToolLogPrefix("terraform")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"image": img,
+		}).Warnf("Image.Import: cannot make logfile name: %s", err)
+	}
+
+	defer os.Remove(filepath.Join(imageDestroyDir, "imported.tfstate"))
+
+	for _, resource := range resources {
+		if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, imageDestroyDir, provider.Terraform(),
+			"import", "-no-color", "-input=false", "-state-out=imported.tfstate", "-backup=-", resource.Address,
+			resource.ID); err != nil {
+			log.WithFields(log.Fields{
+				"image":   img,
+				"address": resource.Address,
+				"id":      resource.ID,
+			}).Errorf("Image.Import: cannot import image: %s", err)
+
+			return &common.ToolError{
+				Err:     fmt.Errorf("cannot import %s as %s: %w", resource.ID, resource.Address, err),
+				LogFile: logname,
+			}
+		}
+	}
+
+	return img.SetStatus(Created)
+}
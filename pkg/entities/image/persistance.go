@@ -6,6 +6,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"enzyme/pkg/provider"
+	"enzyme/pkg/secret"
 	"enzyme/pkg/state"
 )
 
@@ -30,11 +31,11 @@ func (img *imgState) Hierarchy() ([]string, error) {
 }
 
 type userVarsPersist struct {
-	ProjectName   string
-	UserName      string
-	DiskSize      string
-	CentosRelease string
-	SourceImage   string
+	ProjectName   string `var:"project_name"`
+	UserName      string `var:"user_name"`
+	DiskSize      string `var:"disk_size"`
+	CentosRelease string `var:"centos_release"`
+	SourceImage   string `var:"source_image"`
 }
 
 type providerPersist struct {
@@ -44,7 +45,13 @@ type providerPersist struct {
 	Creds  string
 }
 
+// schemaVersion is the version of persistent layout, it's increased together with registering
+// a state migration from the previous version whenever persistent changes
+const schemaVersion = 1
+
 type persistent struct {
+	SchemaVersion int
+
 	Status       int
 	Name         string
 	Provider     providerPersist
@@ -95,11 +102,15 @@ func (img *imgState) getUserVars() userVarsPersist {
 		result.SourceImage = ""
 	}
 
+	// values containing secrets are kept as their fingerprints
+	secret.FingerprintFields(&result)
+
 	return result
 }
 
 func (img *imgState) ToPublic() (interface{}, error) {
 	return persistent{
+		schemaVersion,
 		int(img.status),
 		img.name,
 		img.getProviderVars(),
@@ -125,14 +136,10 @@ func (img *imgState) FromPublic(v interface{}) (state.Entry, error) {
 	}
 
 	if img.userVariables != nil {
-		userVars := img.getUserVars()
-		if persist.UserVars != userVars {
-			log.WithFields(log.Fields{
-				"loaded-vars":  persist.UserVars,
-				"current-vars": userVars,
-			}).Info("Image.FromPublic: loaded user variables differ from current, invalidating stored state")
-
-			return nil, nil
+		keep, err := state.CheckVariables(persist.UserVars, img.getUserVars(), Status(persist.Status) == Created,
+			img.serviceParameters.ChangedVariables)
+		if !keep {
+			return nil, err
 		}
 	} else {
 		log.WithFields(log.Fields{
@@ -171,6 +178,28 @@ func (img *imgState) FromPublic(v interface{}) (state.Entry, error) {
 	}, nil
 }
 
+// Reload re-reads the stored state of the image, it's needed when the same image
+// was changed through another object
+func (img *imgState) Reload() error {
+	loaded, err := img.fetcher.Load(img)
+	if err != nil {
+		log.WithField("image", img).Errorf("Image.Reload: cannot load state: %s", err)
+		return err
+	}
+
+	if loaded != nil {
+		*img = *loaded.(*imgState)
+	}
+
+	return nil
+}
+
+// Lock acquires the lock of the image shared by all enzyme processes, it also guards
+// the directory with its configuration files
+func (img *imgState) Lock() (func(), error) {
+	return img.fetcher.Lock(img)
+}
+
 func handler(hier []string, fetcher state.Fetcher) state.Entry {
 	if len(hier) != 0 && hier[0] == "image" {
 		return &imgState{
@@ -183,4 +212,5 @@ func handler(hier []string, fetcher state.Fetcher) state.Entry {
 
 func init() {
 	state.RegisterHandler(handler)
+	state.RegisterSchema("image", schemaVersion)
 }
@@ -0,0 +1,43 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"enzyme/pkg/controller"
+)
+
+// Refresh checks that the image built from the current configuration exists in the cloud
+// as its status says
+func (img *imgState) Refresh(ctx context.Context) (controller.Drift, error) {
+	drift := controller.Drift{Stored: img.status, Actual: img.status}
+	if img.status == Nothing {
+		return drift, nil
+	}
+
+	exists, err := (&buildImage{img: img}).imageExists(ctx)
+	if err != nil {
+		return drift, err
+	}
+
+	switch {
+	case img.status == Created && !exists:
+		drift.Actual = Configured
+		drift.Details = "image is not found in the cloud or is built from another configuration"
+	case img.status == Configured && exists:
+		drift.Actual = Created
+		drift.Details = "image built from the current configuration exists in the cloud"
+	}
+
+	return drift, nil
+}
+
+// Reconcile sets the status found by Refresh
+func (img *imgState) Reconcile(drift controller.Drift) error {
+	status, ok := drift.Actual.(Status)
+	if !ok {
+		return fmt.Errorf("cannot set status of image - wrong type")
+	}
+
+	return img.SetStatus(status)
+}
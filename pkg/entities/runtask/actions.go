@@ -1,6 +1,7 @@
 package runtask
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"path/filepath"
@@ -71,7 +72,7 @@ func (action makeConnection) String() string {
 	return fmt.Sprintf("GetConnectDetails for %s", action.task)
 }
 
-func (action makeConnection) Apply() error {
+func (action makeConnection) Apply(ctx context.Context) error {
 	clusterTarget, err := composeClusterPrereq(action.task, cluster.Spawned)
 	if err != nil {
 		return err
@@ -122,6 +123,10 @@ func (action makeConnection) IsExclusive() bool {
 	return false
 }
 
+func (action makeConnection) ResourceClass() string {
+	return common.SSHResource
+}
+
 func (action makeConnection) Prerequisites() ([]controller.Target, error) {
 	clusterTarget, err := composeClusterPrereq(action.task, cluster.Spawned)
 	if err != nil {
@@ -153,7 +158,8 @@ func expandExe(exe string) string {
 	return exe
 }
 
-func runRemoteCommand(client ssh.ZymeClient, logger *log.Entry, exe string, args ...string) error {
+func runRemoteCommand(ctx context.Context, client ssh.ZymeClient, logger *log.Entry, exe string,
+	args ...string) error {
 	cmd := []string{escapeArg(exe)}
 
 	for _, arg := range args {
@@ -161,7 +167,7 @@ func runRemoteCommand(client ssh.ZymeClient, logger *log.Entry, exe string, args
 	}
 
 	remoteCmd := strings.Join(cmd, " ")
-	if err := client.ExecuteCommand(remoteCmd, true); err != nil {
+	if err := client.ExecuteCommand(ctx, remoteCmd, true); err != nil {
 		logger.WithField("command", remoteCmd).Errorf("runRemoteCommand: cannot execute command: %s", err)
 		return err
 	}
@@ -178,7 +184,7 @@ func (action *uploadData) String() string {
 	return fmt.Sprintf("UploadData%s for %s", action.stage.Get(), action.task)
 }
 
-func (action *uploadData) Apply() error {
+func (action *uploadData) Apply(ctx context.Context) error {
 	logger := makeStageLogger(action.task, "upload-data")
 
 	if action.task.useStorage {
@@ -195,7 +201,7 @@ func (action *uploadData) Apply() error {
 			return err
 		}
 
-		if err := runRemoteCommand(action.task.client, logger,
+		if err := runRemoteCommand(ctx, action.task.client, logger,
 			expandExe("~/zyme-postprocess/storage/attach-on-head.sh"), connect.InternalAddress); err != nil {
 			logger.Errorf("RunTask.uploadData: cannot attach storage node: %s", err)
 			return err
@@ -229,10 +235,18 @@ func (action *uploadData) Apply() error {
 	return nil
 }
 
+func (action *uploadData) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *uploadData) IsExclusive() bool {
 	return false
 }
 
+func (action *uploadData) ResourceClass() string {
+	return common.SSHResource
+}
+
 func (action *uploadData) Prerequisites() ([]controller.Target, error) {
 	clusterTarget, err := composeClusterPrereq(action.task, cluster.Spawned)
 	if err != nil {
@@ -259,16 +273,20 @@ func (action runRemote) String() string {
 	return fmt.Sprintf("RunRemote for %s", action.task)
 }
 
-func (action runRemote) Apply() error {
+func (action runRemote) Apply(ctx context.Context) error {
 	logger := makeStageLogger(action.task, "run-remote")
 
-	return runRemoteCommand(action.task.client, logger, expandExe(action.task.remotePath), action.task.args...)
+	return runRemoteCommand(ctx, action.task.client, logger, expandExe(action.task.remotePath), action.task.args...)
 }
 
 func (action runRemote) IsExclusive() bool {
 	return true
 }
 
+func (action runRemote) ResourceClass() string {
+	return common.SSHResource
+}
+
 func (action runRemote) Prerequisites() ([]controller.Target, error) {
 	clusterTarget, err := composeClusterPrereq(action.task, cluster.Spawned)
 	if err != nil {
@@ -287,13 +305,13 @@ func (action *downloadResults) String() string {
 	return fmt.Sprintf("DownloadResults%s for %s", action.stage.Get(), action.task)
 }
 
-func (action *downloadResults) Apply() error {
+func (action *downloadResults) Apply(ctx context.Context) error {
 	logger := makeStageLogger(action.task, "download-data")
 
 	if action.task.useStorage {
 		action.stage.Set(":detaching storage")
 
-		if err := runRemoteCommand(action.task.client, logger,
+		if err := runRemoteCommand(ctx, action.task.client, logger,
 			expandExe("~/zyme-postprocess/storage/detach-on-head.sh")); err != nil {
 			logger.Errorf("RunTask.downloadResults: cannot detach storage node: %s", err)
 			return err
@@ -323,10 +341,18 @@ func (action *downloadResults) Apply() error {
 	return nil
 }
 
+func (action *downloadResults) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *downloadResults) IsExclusive() bool {
 	return false
 }
 
+func (action *downloadResults) ResourceClass() string {
+	return common.SSHResource
+}
+
 func (action *downloadResults) Prerequisites() ([]controller.Target, error) {
 	clusterTarget, err := composeClusterPrereq(action.task, cluster.Spawned)
 	if err != nil {
@@ -353,7 +379,7 @@ func (action cleanCluster) String() string {
 	return fmt.Sprintf("CleanCluster for %s", action.task)
 }
 
-func (action cleanCluster) Apply() error {
+func (action cleanCluster) Apply(ctx context.Context) error {
 	log.Info("RunTask.cleanCluster: empty action, needed for prerequisites only")
 	return nil
 }
@@ -1 +1,22 @@
 package runtask
+
+import (
+	"testing"
+
+	"enzyme/pkg/controller/controllertest"
+)
+
+func TestStatusGraph(t *testing.T) {
+	thing, statuses := StatusGraph()
+
+	controllertest.CheckStatusGraph(t, thing, statuses, []controllertest.Transition{
+		{From: NotRunning, To: Connected, Action: "runtask.makeConnection"},
+		{From: Connected, To: DataUploaded, Action: "runtask.uploadData"},
+		{From: DataUploaded, To: CommandFinished, Action: "runtask.runRemote"},
+		{From: CommandFinished, To: ResultsDownloaded, Action: "runtask.downloadResults"},
+		{From: ResultsDownloaded, To: ClusterCleaned, Action: "runtask.cleanCluster"},
+		{From: NotRunning, To: DataUploaded},
+		{From: ClusterCleaned, To: NotRunning},
+		{From: CommandFinished, To: DataUploaded},
+	})
+}
@@ -2,6 +2,7 @@ package runtask
 
 import (
 	"fmt"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -77,6 +78,12 @@ func (s Status) String() string {
 	return result
 }
 
+// StatusGraph returns a blank task together with all its statuses for static checks
+// of the status graph, e.g. by controller.ValidateGraph
+func StatusGraph() (controller.Thing, []controller.Status) {
+	return &taskState{}, []controller.Status{NotRunning, Connected, DataUploaded, CommandFinished, ResultsDownloaded, ClusterCleaned}
+}
+
 type taskState struct {
 	status         Status
 	provider       provider.Provider
@@ -226,3 +233,8 @@ func CreateTaskTarget(prov provider.Provider, userVariables config.Config, servi
 		downloadFiles:     downloadFiles,
 	}, nil
 }
+
+// ActionTimeouts return timeouts of actions given in the parameters of the task
+func (task *taskState) ActionTimeouts() map[string]time.Duration {
+	return task.serviceParameters.ActionTimeouts
+}
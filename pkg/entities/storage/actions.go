@@ -1,10 +1,11 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -34,6 +35,16 @@ func enableConfig(name, path string) (func(), error) {
 	return disabler, err
 }
 
+// discardScratchState drops changes a failed action made to the terraform state and returns
+// the error of the action
+func discardScratchState(ctx context.Context, scratch *common.TerraformScratchState, err error) error {
+	if discardErr := scratch.Discard(ctx); discardErr != nil {
+		log.Errorf("discardScratchState: cannot restore terraform state: %s", discardErr)
+	}
+
+	return err
+}
+
 type makeConfig struct {
 	storage *storageNodeState
 }
@@ -42,7 +53,7 @@ func (action makeConfig) String() string {
 	return fmt.Sprintf("Configure for %s", action.storage)
 }
 
-func (action makeConfig) Apply() error {
+func (action makeConfig) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"storage-node": action.storage,
 	}).Info("StorageNode.makeConfig.Apply")
@@ -56,6 +67,11 @@ func (action makeConfig) Apply() error {
 		}).Warnf("StorageNode.makeConfig: cannot make logfile name: %s", err)
 	}
 
+	backend := action.storage.serviceParams.TerraformBackend
+	if err := common.ConfigureTerraformBackend(configFilesDir, backend, action.storage); err != nil {
+		return err
+	}
+
 	initer := func(name, template, target string) error {
 		log.WithFields(log.Fields{
 			"template": template,
@@ -89,8 +105,8 @@ func (action makeConfig) Apply() error {
 			return err
 		}
 
-		if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
-			"init"); err != nil {
+		if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
+			common.TerraformInitArgs(backend)...); err != nil {
 			log.WithFields(log.Fields{
 				"storage-dir": configFilesDir,
 				"name":        name,
@@ -154,6 +170,10 @@ func (action makeConfig) IsExclusive() bool {
 	return false
 }
 
+func (action makeConfig) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action makeConfig) Prerequisites() ([]controller.Target, error) {
 	imageTarget, err := composeImagePrereq(action.storage, image.Configured)
 	if err != nil {
@@ -172,11 +192,13 @@ func (action *spawnStorage) String() string {
 	return fmt.Sprintf("Spawn%s for %s", action.stage.Get(), action.storage)
 }
 
-func (action *spawnStorage) Apply() error {
+func (action *spawnStorage) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"storage": action.storage,
 	}).Info("StorageNode.spawnStorage.Apply")
 
+	action.stage.Reset()
+
 	if disabler, err := enableConfig("standalone", action.storage.configPath); err == nil {
 		defer disabler()
 	} else {
@@ -193,7 +215,7 @@ func (action *spawnStorage) Apply() error {
 	}
 
 	diskResourceName := action.storage.provider.GetTFStorageResourceName()
-	if _, err = action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
+	if _, err = action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
 		"import", "-no-color", diskResourceName+".storage", action.storage.name+"-disk"); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
@@ -204,7 +226,7 @@ func (action *spawnStorage) Apply() error {
 		}).Info("StorageNode.spawnStorage: successfully imported disk")
 	}
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
 		"apply", "-auto-approve", "-no-color"); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
@@ -213,14 +235,14 @@ func (action *spawnStorage) Apply() error {
 		log.Info("StorageNode.spawnStorage: destroying half-spawned storage node ...")
 		action.stage.Set(":destroying half-spawned")
 		// exclude disk from removal
-		_, rmErr := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
+		_, rmErr := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
 			"state", "rm", diskResourceName+".storage")
 
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
 		}).Infof("StorageNode.spawnStorage: tried to exclude disk from destruction, err=%s", rmErr)
 
-		if logname, destroyErr := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
+		if logname, destroyErr := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
 			"destroy", "-auto-approve", "-no-color"); destroyErr != nil {
 			log.WithFields(log.Fields{
 				"storage-dir": configFilesDir,
@@ -231,12 +253,12 @@ func (action *spawnStorage) Apply() error {
 				logname)
 		}
 
-		return err
+		return &common.ToolError{Err: err, LogFile: logname}
 	}
 
 	action.stage.Set(":getting connect info")
 
-	if err := refreshConnectDetails(action.storage, Detached); err != nil {
+	if err := refreshConnectDetails(ctx, action.storage, Detached); err != nil {
 		log.WithField("storage", action.storage).Errorf(
 			"StorageNode.spawnStorage: cannot refresh connection details: %s", err)
 		return err
@@ -247,10 +269,30 @@ func (action *spawnStorage) Apply() error {
 	return nil
 }
 
+func (action *spawnStorage) RetryPolicy() controller.RetryPolicy {
+	return common.ToolRetryPolicy
+}
+
+func (action *spawnStorage) ShouldRetry(err error) bool {
+	return common.IsTransientToolError(err)
+}
+
+func (action *spawnStorage) DefaultTimeout() time.Duration {
+	return time.Hour
+}
+
+func (action *spawnStorage) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *spawnStorage) IsExclusive() bool {
 	return false
 }
 
+func (action *spawnStorage) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action *spawnStorage) Prerequisites() ([]controller.Target, error) {
 	imageTarget, err := composeImagePrereq(action.storage, image.Created)
 	if err != nil {
@@ -268,7 +310,7 @@ func (action destroyStorage) String() string {
 	return fmt.Sprintf("Destroy for %s", action.storage)
 }
 
-func (action destroyStorage) Apply() error {
+func (action destroyStorage) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"storage": action.storage,
 	}).Info("StorageNode.destroyStorage.Apply")
@@ -308,13 +350,8 @@ func (action destroyStorage) Apply() error {
 		}).Warnf("StorageNode.destroyStorage: cannot make logfile name: %s", err)
 	}
 
-	newTfState, currentTfState := filepath.Join(configFilesDir, "destroying.tfstate"),
-		filepath.Join(configFilesDir, "terraform.tfstate")
-	if err := storage_pkg.CopyFile(currentTfState, newTfState); err != nil {
-		log.WithFields(log.Fields{
-			"storage-dir": configFilesDir,
-		}).Errorf("StorageNode.destroyStorage: cannot copy state: %s", err)
-
+	scratch, err := common.NewTerraformScratchState(ctx, tfLogPrefix, configFilesDir, "destroying.tfstate")
+	if err != nil {
 		return err
 	}
 
@@ -326,10 +363,10 @@ func (action destroyStorage) Apply() error {
 	diskResourceName := action.storage.provider.GetTFStorageResourceName()
 	unmanagedResources = append(unmanagedResources, diskResourceName+".storage")
 
-	rmArgs := []string{"state", "rm", "-state=" + newTfState}
+	rmArgs := append([]string{"state", "rm"}, scratch.Args()...)
 	rmArgs = append(rmArgs, unmanagedResources...)
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
 		rmArgs...); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
@@ -337,34 +374,30 @@ func (action destroyStorage) Apply() error {
 		}).Errorf("StorageNode.spawnStorage: cannot exclude resources from destruction: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot exclude unmanaged resources, see log for details: %s\n", logname)
 
-		return err
+		return discardScratchState(ctx, scratch, err)
 	}
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
-		"destroy", "-auto-approve", "-no-color", "-state="+newTfState); err != nil {
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
+		append([]string{"destroy", "-auto-approve", "-no-color"}, scratch.Args()...)...); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
 		}).Errorf("StorageNode.destroyStorage: error destroying storage node: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot destroy storage node, see log for details: %s\n", logname)
 
-		return err
+		return discardScratchState(ctx, scratch, err)
 	}
 
-	if err := os.Rename(newTfState, currentTfState); err != nil {
-		log.WithFields(log.Fields{
-			"storage-dir": configFilesDir,
-		}).Errorf("StorageNode.destroyStorage: cannot rename state: %s", err)
-
-		return err
-	}
-
-	return nil
+	return scratch.Commit()
 }
 
 func (action destroyStorage) IsExclusive() bool {
 	return false
 }
 
+func (action destroyStorage) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action destroyStorage) Prerequisites() ([]controller.Target, error) {
 	return []controller.Target{}, nil
 }
@@ -378,7 +411,7 @@ func (action *attachStorage) String() string {
 	return fmt.Sprintf("Attach%s for %s", action.stage.Get(), action.storage)
 }
 
-func (action *attachStorage) Apply() error {
+func (action *attachStorage) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"storage": action.storage,
 	}).Info("StorageNode.attachStorage.Apply")
@@ -390,7 +423,7 @@ func (action *attachStorage) Apply() error {
 
 	action.stage.Set(":getting imported resources")
 
-	networkResources, err := cluster.GetNetworkResources(clusterTarget.Thing)
+	networkResources, err := cluster.GetNetworkResources(ctx, clusterTarget.Thing)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"storage": action.storage,
@@ -408,30 +441,24 @@ func (action *attachStorage) Apply() error {
 		}).Warnf("StorageNode.attachStorage: cannot make logfile name: %s", err)
 	}
 
-	newTfState, currentTfState := filepath.Join(configFilesDir, "imported.tfstate"),
-		filepath.Join(configFilesDir, "terraform.tfstate")
-
-	_, statErr := os.Stat(currentTfState)
-	if action.storage.status != Configured || os.IsExist(statErr) {
-		if err := storage_pkg.CopyFile(currentTfState, newTfState); err != nil {
-			log.WithFields(log.Fields{
-				"storage-dir": configFilesDir,
-			}).Errorf("StorageNode.attachStorage: cannot copy state: %s", err)
-
-			return err
-		}
+	// the state left by a failed attempt would already have the resources imported, so a retry
+	// would fail to import them again; every attempt starts from the current state
+	scratch, err := common.NewTerraformScratchState(ctx, tfLogPrefix, configFilesDir, "imported.tfstate")
+	if err != nil {
+		return err
 	}
 
 	if disabler, err := enableConfig("attached", action.storage.attachedConfigPath); err == nil {
 		defer disabler()
 	} else {
-		return err
+		return discardScratchState(ctx, scratch, err)
 	}
 
 	diskResourceName := action.storage.provider.GetTFStorageResourceName()
 	if action.storage.status == Configured {
-		if _, err = action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
-			"import", "-no-color", "-state="+newTfState, diskResourceName+".storage", action.storage.name+"-disk"); err != nil {
+		importArgs := append([]string{"import", "-no-color"}, scratch.Args()...)
+		if _, err = action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
+			append(importArgs, diskResourceName+".storage", action.storage.name+"-disk")...); err != nil {
 			log.WithFields(log.Fields{
 				"storage-dir": configFilesDir,
 			}).Infof("StorageNode.attachStorage: cannot import disk, err=%s", err)
@@ -443,40 +470,37 @@ func (action *attachStorage) Apply() error {
 	}
 
 	for _, resource := range networkResources {
-		if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
-			"import", "-no-color", "-state="+newTfState, resource.Address, resource.ID); err != nil {
+		importArgs := append([]string{"import", "-no-color"}, scratch.Args()...)
+		if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
+			append(importArgs, resource.Address, resource.ID)...); err != nil {
 			log.WithFields(log.Fields{
 				"storage-dir": configFilesDir,
 			}).Errorf("StorageNode.attachStorage: cannot import resource %s: %s", resource.Address, err)
 			fmt.Fprintf(os.Stderr, "Cannot import resource, see log for details: %s\n", logname)
 
-			return err
+			return discardScratchState(ctx, scratch, &common.ToolError{Err: err, LogFile: logname})
 		}
 	}
 
 	action.stage.Reset()
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
-		"apply", "-no-color", "-auto-approve", "-state="+newTfState); err != nil {
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
+		append([]string{"apply", "-no-color", "-auto-approve"}, scratch.Args()...)...); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
 		}).Errorf("StorageNode.attachStorage: cannot attach storage: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot attach storage to cluser, see log for details: %s\n", logname)
 
-		return err
+		return discardScratchState(ctx, scratch, &common.ToolError{Err: err, LogFile: logname})
 	}
 
-	if err := os.Rename(newTfState, currentTfState); err != nil {
-		log.WithFields(log.Fields{
-			"storage-dir": configFilesDir,
-		}).Errorf("StorageNode.attachStorage: cannot rename state: %s", err)
-
+	if err := scratch.Commit(); err != nil {
 		return err
 	}
 
 	action.stage.Set(":getting connect info")
 
-	if err := refreshConnectDetails(action.storage, Attached); err != nil {
+	if err := refreshConnectDetails(ctx, action.storage, Attached); err != nil {
 		log.WithField("storage", action.storage).Errorf(
 			"StorageNode.attachStorage: cannot refresh connection details: %s", err)
 
@@ -490,10 +514,30 @@ func (action *attachStorage) Apply() error {
 	return nil
 }
 
+func (action *attachStorage) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *attachStorage) IsExclusive() bool {
 	return false
 }
 
+func (action *attachStorage) ResourceClass() string {
+	return common.TerraformResource
+}
+
+func (action *attachStorage) RetryPolicy() controller.RetryPolicy {
+	return common.ToolRetryPolicy
+}
+
+func (action *attachStorage) ShouldRetry(err error) bool {
+	return common.IsTransientToolError(err)
+}
+
+func (action *attachStorage) DefaultTimeout() time.Duration {
+	return time.Hour
+}
+
 func (action *attachStorage) Prerequisites() ([]controller.Target, error) {
 	clusterTarget, err := composeClusterPrereq(action.storage, cluster.Spawned)
 	if err != nil {
@@ -517,7 +561,7 @@ func (action *detachStorage) String() string {
 	return fmt.Sprintf("Detach%s for %s", action.stage.Get(), action.storage)
 }
 
-func (action *detachStorage) Apply() error {
+func (action *detachStorage) Apply(ctx context.Context) error {
 	log.WithFields(log.Fields{
 		"storage": action.storage,
 	}).Info("StorageNode.detachStorage.Apply")
@@ -545,7 +589,7 @@ func (action *detachStorage) Apply() error {
 
 	action.stage.Set(":getting imported resources")
 
-	networkResources, err := cluster.GetNetworkResources(clusterTarget.Thing)
+	networkResources, err := cluster.GetNetworkResources(ctx, clusterTarget.Thing)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"storage": action.storage,
@@ -554,30 +598,25 @@ func (action *detachStorage) Apply() error {
 		return err
 	}
 
-	newTfState, currentTfState := filepath.Join(configFilesDir, "destroying.tfstate"),
-		filepath.Join(configFilesDir, "terraform.tfstate")
-	if err := storage_pkg.CopyFile(currentTfState, newTfState); err != nil {
-		log.WithFields(log.Fields{
-			"storage-dir": configFilesDir,
-		}).Errorf("StorageNode.detachStorage: cannot copy state: %s", err)
-
+	scratch, err := common.NewTerraformScratchState(ctx, tfLogPrefix, configFilesDir, "destroying.tfstate")
+	if err != nil {
 		return err
 	}
 
-	stateRmArgs := []string{"state", "rm", "-state=" + newTfState}
+	stateRmArgs := append([]string{"state", "rm"}, scratch.Args()...)
 
 	for _, resource := range networkResources {
 		stateRmArgs = append(stateRmArgs, resource.Address)
 	}
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
 		stateRmArgs...); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
 		}).Errorf("StorageNode.detachStorage: cannot remove resources not managed by storage node: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot remove imported resources, see log for details: %s\n", logname)
 
-		return err
+		return discardScratchState(ctx, scratch, err)
 	}
 
 	attachedDisabler() // remove "attached" config before enabling other
@@ -585,32 +624,28 @@ func (action *detachStorage) Apply() error {
 	if disabler, err := enableConfig("standalone", action.storage.configPath); err == nil {
 		defer disabler()
 	} else {
-		return err
+		return discardScratchState(ctx, scratch, err)
 	}
 
 	action.stage.Reset()
 
-	if logname, err := action_pkg.RunLoggedCmdDir(tfLogPrefix, configFilesDir, provider.Terraform(),
-		"apply", "-no-color", "-auto-approve", "-state="+newTfState); err != nil {
+	if logname, err := action_pkg.RunLoggedCmdDir(ctx, tfLogPrefix, configFilesDir, provider.Terraform(),
+		append([]string{"apply", "-no-color", "-auto-approve"}, scratch.Args()...)...); err != nil {
 		log.WithFields(log.Fields{
 			"storage-dir": configFilesDir,
 		}).Errorf("StorageNode.detachStorage: cannot detach storage: %s", err)
 		fmt.Fprintf(os.Stderr, "Cannot detach storage node, see log for details: %s\n", logname)
 
-		return err
+		return discardScratchState(ctx, scratch, err)
 	}
 
-	if err := os.Rename(newTfState, currentTfState); err != nil {
-		log.WithFields(log.Fields{
-			"storage-dir": configFilesDir,
-		}).Errorf("StorageNode.detachStorage: cannot rename state: %s", err)
-
+	if err := scratch.Commit(); err != nil {
 		return err
 	}
 
 	action.stage.Set(":getting connect info")
 
-	if err := refreshConnectDetails(action.storage, Detached); err != nil {
+	if err := refreshConnectDetails(ctx, action.storage, Detached); err != nil {
 		log.WithField("storage", action.storage).Errorf(
 			"StorageNode.detachStorage: cannot refresh connection details: %s", err)
 		return err
@@ -621,10 +656,18 @@ func (action *detachStorage) Apply() error {
 	return nil
 }
 
+func (action *detachStorage) OnStageChange(callback func(stage string)) {
+	action.stage.OnChange(callback)
+}
+
 func (action *detachStorage) IsExclusive() bool {
 	return false
 }
 
+func (action *detachStorage) ResourceClass() string {
+	return common.TerraformResource
+}
+
 func (action *detachStorage) Prerequisites() ([]controller.Target, error) {
 	clusterTarget, err := composeClusterPrereq(action.storage, cluster.Spawned)
 	if err != nil {
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/entities/common"
+	"enzyme/pkg/provider"
+)
+
+// Import adopts the disk and the standalone node of the storage existing in the cloud under cloudID,
+// ids given by resource addresses override the ones found by the provider. The storage must be
+// configured. It gets standalone access if the resources match the configuration, otherwise it stays
+// configured, so creating it spawns the node with the imported disk.
+func (storage *storageNodeState) Import(ctx context.Context, cloudID string, ids map[string]string) error {
+	if storage.status != Configured {
+		return fmt.Errorf("storage node must be configured to import resources, it is %s", storage.status)
+	}
+
+	projectName, err := getVariable(storage.userVariables, storage.templatePath, "project_name")
+	if err != nil {
+		return err
+	}
+
+	resources, err := common.ResolveImportedResources(storage.provider, provider.StorageNodeDescriptor, cloudID,
+		map[string]string{"project_name": projectName}, ids)
+	if err != nil {
+		return err
+	}
+
+	if disabler, err := enableConfig("standalone", storage.configPath); err == nil {
+		defer disabler()
+	} else {
+		return err
+	}
+
+	tfLogPrefix, err := storage.makeToolLogPrefix("terraform")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"storage": storage,
+		}).Warnf("StorageNode.Import: cannot make logfile name: %s", err)
+	}
+
+	imported, err := common.ImportTerraformResources(ctx, tfLogPrefix, storage.getConfigFilesDir(), resources)
+	if err != nil {
+		return err
+	}
+
+	if imported.Changed {
+		log.WithFields(log.Fields{
+			"storage":   storage,
+			"resources": imported.Resources,
+		}).Info("StorageNode.Import: imported resources differ from the configuration")
+
+		return nil
+	}
+
+	if err := refreshConnectDetails(ctx, storage, Detached); err != nil {
+		return err
+	}
+
+	return storage.SetStatus(Detached)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -32,7 +33,7 @@ func GetConnectDetails(from controller.Thing) (ConnectDetails, error) {
 	return node.connection, nil
 }
 
-func refreshConnectDetails(node *storageNodeState, nextStatus Status) error {
+func refreshConnectDetails(ctx context.Context, node *storageNodeState, nextStatus Status) error {
 	var configName, configPath string
 
 	switch nextStatus {
@@ -63,7 +64,7 @@ func refreshConnectDetails(node *storageNodeState, nextStatus Status) error {
 		logger.Warnf("refreshConnectDetails: cannot make logfile name: %s", err)
 	}
 
-	json, err := provider.ParseTerraformOutputs(rootDir, tfLogPrefix, logger)
+	json, err := provider.ParseTerraformOutputs(ctx, rootDir, tfLogPrefix, logger)
 	if err != nil {
 		return err
 	}
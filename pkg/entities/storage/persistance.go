@@ -7,6 +7,7 @@ import (
 
 	"enzyme/pkg/entities/cluster"
 	"enzyme/pkg/provider"
+	"enzyme/pkg/secret"
 	"enzyme/pkg/state"
 )
 
@@ -30,6 +31,28 @@ func (storage *storageNodeState) Hierarchy() ([]string, error) {
 	return append([]string{"storage"}, hier...), nil
 }
 
+// Reload re-reads the stored state of the storage node, it's needed when the same storage node
+// was changed through another object
+func (storage *storageNodeState) Reload() error {
+	loaded, err := storage.fetcher.Load(storage)
+	if err != nil {
+		log.WithField("storage", storage).Errorf("StorageNode.Reload: cannot load state: %s", err)
+		return err
+	}
+
+	if loaded != nil {
+		*storage = *loaded.(*storageNodeState)
+	}
+
+	return nil
+}
+
+// Lock acquires the lock of the storage node shared by all enzyme processes, it also guards
+// the directory with its configuration files
+func (storage *storageNodeState) Lock() (func(), error) {
+	return storage.fetcher.Lock(storage)
+}
+
 func handler(hier []string, fetcher state.Fetcher) state.Entry {
 	if len(hier) != 0 && hier[0] == "storage" {
 		return &storageNodeState{
@@ -48,14 +71,20 @@ type providerPersist struct {
 }
 
 type userVarsPersist struct {
-	KeyName        string
-	InstanceType   string
-	UserName       string
-	ProjectName    string
-	SSHKeyPairPath string
+	KeyName        string `var:"storage_key_name"`
+	InstanceType   string `var:"storage_instance_type"`
+	UserName       string `var:"user_name"`
+	ProjectName    string `var:"project_name"`
+	SSHKeyPairPath string `var:"ssh_key_pair_path"`
 }
 
+// schemaVersion is the version of persistent layout, it's increased together with registering
+// a state migration from the previous version whenever persistent changes
+const schemaVersion = 1
+
 type persistent struct {
+	SchemaVersion int
+
 	Status               int
 	Name                 string
 	ImageName            string
@@ -113,11 +142,15 @@ func (storage *storageNodeState) getUserVars() userVarsPersist {
 		result.SSHKeyPairPath = ""
 	}
 
+	// values containing secrets are kept as their fingerprints
+	secret.FingerprintFields(&result)
+
 	return result
 }
 
 func (storage *storageNodeState) ToPublic() (interface{}, error) {
 	return persistent{
+		schemaVersion,
 		int(storage.status),
 		storage.name,
 		storage.imageName,
@@ -149,14 +182,13 @@ func (storage *storageNodeState) FromPublic(v interface{}) (state.Entry, error)
 	}
 
 	if storage.userVariables != nil {
-		userVars := storage.getUserVars()
-		if persist.UserVars != userVars {
-			log.WithFields(log.Fields{
-				"loaded-vars":  persist.UserVars,
-				"current-vars": userVars,
-			}).Info("StorageNode.FromPublic: loaded user variables differ from current, invalidating stored state")
+		status := Status(persist.Status)
+		live := status == Detached || status == Attached
 
-			return nil, nil
+		keep, err := state.CheckVariables(persist.UserVars, storage.getUserVars(), live,
+			storage.serviceParams.ChangedVariables)
+		if !keep {
+			return nil, err
 		}
 	} else {
 		log.WithFields(log.Fields{
@@ -203,4 +235,5 @@ func (storage *storageNodeState) FromPublic(v interface{}) (state.Entry, error)
 
 func init() {
 	state.RegisterHandler(handler)
+	state.RegisterSchema("storage", schemaVersion)
 }
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/controller"
+	"enzyme/pkg/entities/common"
+)
+
+// ownResources returns addresses of resources which are destroyed together with the storage node,
+// i.e. without the disk and resources imported from the cluster
+func (storage *storageNodeState) ownResources(addresses []string) []string {
+	unmanaged := map[string]bool{storage.provider.GetTFStorageResourceName() + ".storage": true}
+	for _, resource := range storage.importedResources {
+		unmanaged[resource.Address] = true
+	}
+
+	result := []string{}
+
+	for _, address := range addresses {
+		if !unmanaged[address] {
+			result = append(result, address)
+		}
+	}
+
+	return result
+}
+
+// Refresh checks that the storage node exists in the cloud as its status says,
+// the disk is kept when the node is destroyed, so it's not looked at
+func (storage *storageNodeState) Refresh(ctx context.Context) (controller.Drift, error) {
+	drift := controller.Drift{Stored: storage.status, Actual: storage.status}
+	if storage.status == Nothing {
+		return drift, nil
+	}
+
+	configName, configPath := "standalone", storage.configPath
+	if storage.status == Attached {
+		configName, configPath = "attached", storage.attachedConfigPath
+	}
+
+	if disabler, err := enableConfig(configName, configPath); err == nil {
+		defer disabler()
+	} else {
+		return drift, err
+	}
+
+	tfLogPrefix, err := storage.makeToolLogPrefix("terraform")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"storage": storage,
+		}).Warnf("StorageNode.Refresh: cannot make logfile name: %s", err)
+	}
+
+	refreshed, err := common.RefreshTerraformState(ctx, tfLogPrefix, storage.getConfigFilesDir())
+	if err != nil {
+		return drift, err
+	}
+
+	own := storage.ownResources(refreshed.Resources)
+
+	switch {
+	case storage.status != Configured && len(own) == 0:
+		drift.Actual = Configured
+		drift.Details = "storage node resources are not found in the cloud"
+	case storage.status != Configured && refreshed.Changed:
+		drift.Details = "storage node resources differ from the configuration, some of them are changed or deleted"
+	case storage.status == Configured && len(own) != 0:
+		drift.Details = fmt.Sprintf("%d resources of the storage node are left in the cloud", len(own))
+	}
+
+	return drift, nil
+}
+
+// Reconcile sets the status found by Refresh, connection details are dropped together with the node
+func (storage *storageNodeState) Reconcile(drift controller.Drift) error {
+	status, ok := drift.Actual.(Status)
+	if !ok {
+		return fmt.Errorf("cannot set status of storage node - wrong type")
+	}
+
+	if status == Configured {
+		storage.connection = ConnectDetails{}
+		storage.importedResources = nil
+	}
+
+	return storage.SetStatus(status)
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -79,6 +80,12 @@ func (s Status) String() string {
 	return result
 }
 
+// StatusGraph returns a blank storage node together with all its statuses for static checks
+// of the status graph, e.g. by controller.ValidateGraph
+func StatusGraph() (controller.Thing, []controller.Status) {
+	return &storageNodeState{}, []controller.Status{Nothing, Configured, Detached, Attached}
+}
+
 type storageNodeState struct {
 	status               Status
 	name                 string
@@ -214,6 +221,39 @@ func (storage *storageNodeState) GetAction(current controller.Status,
 	return nil, fmt.Errorf("unsupported transition of (%v => %v)", currentStatus, targetStatus)
 }
 
+type statusPair struct {
+	from, to Status
+}
+
+// estimatedCosts are rough figures for a single storage node with a disk of typical size,
+// attaching spawns the node as a part of the cluster network, so going through
+// standalone access means spawning it twice
+var estimatedCosts = map[statusPair]controller.Cost{
+	{Nothing, Configured}:  {Duration: time.Second},
+	{Configured, Detached}: {Duration: 10 * time.Minute, InstanceTime: 10 * time.Minute},
+	{Configured, Attached}: {Duration: 12 * time.Minute, InstanceTime: 12 * time.Minute},
+	{Detached, Attached}:   {Duration: 12 * time.Minute, InstanceTime: 12 * time.Minute},
+	{Attached, Detached}:   {Duration: 10 * time.Minute, InstanceTime: 10 * time.Minute},
+	{Detached, Configured}: {Duration: 3 * time.Minute, InstanceTime: 3 * time.Minute},
+	{Attached, Configured}: {Duration: 3 * time.Minute, InstanceTime: 3 * time.Minute},
+}
+
+func (storage *storageNodeState) EstimatedCost(from, to controller.Status) (controller.Cost, bool) {
+	fromStatus, ok := from.(Status)
+	if !ok {
+		return controller.Cost{}, false
+	}
+
+	toStatus, ok := to.(Status)
+	if !ok {
+		return controller.Cost{}, false
+	}
+
+	cost, ok := estimatedCosts[statusPair{fromStatus, toStatus}]
+
+	return cost, ok
+}
+
 func (storage *storageNodeState) makeToolLogPrefix(tool string) (string, error) {
 	hier, err := getHierarchy(storage.provider, storage.name)
 	if err != nil {
@@ -341,3 +381,8 @@ func CreateStorageTarget(prov provider.Provider, userVariables config.Config,
 
 	return &storage, nil
 }
+
+// ActionTimeouts return timeouts of actions given in the parameters of the storage node
+func (storage *storageNodeState) ActionTimeouts() map[string]time.Duration {
+	return storage.serviceParams.ActionTimeouts
+}
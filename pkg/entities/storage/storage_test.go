@@ -1 +1,24 @@
 package storage
+
+import (
+	"testing"
+
+	"enzyme/pkg/controller/controllertest"
+)
+
+func TestStatusGraph(t *testing.T) {
+	thing, statuses := StatusGraph()
+
+	controllertest.CheckStatusGraph(t, thing, statuses, []controllertest.Transition{
+		{From: Nothing, To: Configured, Action: "storage.makeConfig"},
+		{From: Configured, To: Detached, Action: "storage.spawnStorage"},
+		{From: Configured, To: Attached, Action: "storage.attachStorage"},
+		{From: Detached, To: Attached, Action: "storage.attachStorage"},
+		{From: Attached, To: Detached, Action: "storage.detachStorage"},
+		{From: Detached, To: Configured, Action: "storage.destroyStorage"},
+		{From: Attached, To: Configured, Action: "storage.destroyStorage"},
+		{From: Nothing, To: Detached},
+		{From: Nothing, To: Attached},
+		{From: Configured, To: Nothing},
+	})
+}
@@ -10,6 +10,7 @@ import (
 	isatty_pkg "github.com/mattn/go-isatty"
 	log "github.com/sirupsen/logrus"
 
+	"enzyme/pkg/secret"
 	"enzyme/pkg/storage"
 )
 
@@ -142,6 +143,9 @@ func InitLogging(verbose bool) {
 
 	log.SetOutput(ioutil.Discard)
 
+	// secrets are redacted before the entry is written by other hooks
+	log.AddHook(secret.Hook{})
+
 	if verbose {
 		addHook(log.PanicLevel, log.WarnLevel, os.Stderr)
 		addHook(log.InfoLevel, log.InfoLevel, os.Stdout)
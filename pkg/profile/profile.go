@@ -0,0 +1,185 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// PathEnv is the environment variable overriding the path of the profiles file
+	PathEnv = "ENZYME_PROFILES"
+
+	profilesFolder   = "enzyme"
+	profilesFileName = "profiles.yaml"
+)
+
+// Profile bundles settings repeated by every command
+type Profile struct {
+	Provider    string `yaml:"provider,omitempty"`
+	Region      string `yaml:"region,omitempty"`
+	Zone        string `yaml:"zone,omitempty"`
+	Credentials string `yaml:"credentials,omitempty"`
+	// Parameters are parameter files, later files override values of earlier ones
+	Parameters []string          `yaml:"parameters,omitempty"`
+	Vars       map[string]string `yaml:"vars,omitempty"`
+}
+
+// Profiles are named profiles kept in the profiles file
+type Profiles struct {
+	// Current is the name of the profile used when no profile is given, empty if there is none
+	Current  string             `yaml:"current,omitempty"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// DefaultPath returns the path of the profiles file: the one given by PathEnv environment variable
+// or enzyme/profiles.yaml in the user config folder like ~/.config
+func DefaultPath() (string, error) {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		log.Errorf("DefaultPath: cannot find user config folder: %s", err)
+
+		return "", err
+	}
+
+	return filepath.Join(configDir, profilesFolder, profilesFileName), nil
+}
+
+// Load reads profiles from the file, missing file means no profiles
+func Load(path string) (*Profiles, error) {
+	profiles := &Profiles{Profiles: map[string]Profile{}}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+
+	if err != nil {
+		log.WithField("path", path).Errorf("Load: cannot read profiles: %s", err)
+
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(content, profiles); err != nil {
+		log.WithField("path", path).Errorf("Load: cannot parse profiles: %s", err)
+
+		return nil, err
+	}
+
+	if profiles.Profiles == nil {
+		profiles.Profiles = map[string]Profile{}
+	}
+
+	return profiles, nil
+}
+
+// Save writes profiles to the file replacing it at once
+func (profiles *Profiles) Save(path string) error {
+	content, err := yaml.Marshal(profiles)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		log.WithField("path", path).Errorf("Save: cannot create folder: %s", err)
+
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		log.WithField("path", tmpPath).Errorf("Save: cannot write profiles: %s", err)
+
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.WithField("path", path).Errorf("Save: cannot replace profiles: %s", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// Names returns sorted names of the profiles
+func (profiles *Profiles) Names() []string {
+	names := make([]string, 0, len(profiles.Profiles))
+	for name := range profiles.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Get returns the profile by its name, empty name means the current profile;
+// the returned name is empty if no profile is given and there is no current one
+func (profiles *Profiles) Get(name string) (string, Profile, error) {
+	if name == "" {
+		name = profiles.Current
+		if name == "" {
+			return "", Profile{}, nil
+		}
+	}
+
+	profile, ok := profiles.Profiles[name]
+	if !ok {
+		return "", Profile{}, fmt.Errorf("profile %s doesn't exist", name)
+	}
+
+	return name, profile, nil
+}
+
+// Add adds the profile, existing profile is replaced only if replace is true
+func (profiles *Profiles) Add(name string, profile Profile, replace bool) error {
+	if name == "" {
+		return fmt.Errorf("profile name is empty")
+	}
+
+	if _, ok := profiles.Profiles[name]; ok && !replace {
+		return fmt.Errorf("profile %s already exists", name)
+	}
+
+	profiles.Profiles[name] = profile
+
+	return nil
+}
+
+// Remove removes the profile, it stops being the current one
+func (profiles *Profiles) Remove(name string) error {
+	if _, ok := profiles.Profiles[name]; !ok {
+		return fmt.Errorf("profile %s doesn't exist", name)
+	}
+
+	delete(profiles.Profiles, name)
+
+	if profiles.Current == name {
+		profiles.Current = ""
+	}
+
+	return nil
+}
+
+// Use makes the profile the current one, empty name means no current profile
+func (profiles *Profiles) Use(name string) error {
+	if name != "" {
+		if _, ok := profiles.Profiles[name]; !ok {
+			return fmt.Errorf("profile %s doesn't exist", name)
+		}
+	}
+
+	profiles.Current = name
+
+	return nil
+}
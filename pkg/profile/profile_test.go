@@ -0,0 +1,95 @@
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile_unit_tests_temp")
+	if err != nil {
+		t.Fatalf("TempDir function returned error: [%s]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "enzyme", "profiles.yaml")
+
+	profiles, err := Load(path)
+	if err != nil || len(profiles.Profiles) != 0 {
+		t.Fatalf("missing profiles file wasn't read as no profiles: [%v] [%v]", profiles, err)
+	}
+
+	if name, _, err := profiles.Get(""); err != nil || name != "" {
+		t.Errorf("current profile is returned when there is none: [%s] [%v]", name, err)
+	}
+
+	team := Profile{
+		Provider:    "aws",
+		Region:      "us-east-2",
+		Credentials: "/home/user/aws.json",
+		Parameters:  []string{"/home/user/team.yaml"},
+		Vars:        map[string]string{"worker_count": "4"},
+	}
+
+	if err := profiles.Add("team", team, false); err != nil {
+		t.Fatalf("Add function returned error: [%s]", err)
+	}
+
+	if err := profiles.Add("team", Profile{}, false); err == nil {
+		t.Errorf("existing profile is replaced")
+	}
+
+	if err := profiles.Add("dev", Profile{Provider: "gcp"}, false); err != nil {
+		t.Fatalf("Add function returned error: [%s]", err)
+	}
+
+	if err := profiles.Use("missing"); err == nil {
+		t.Errorf("missing profile is used")
+	}
+
+	if err := profiles.Use("team"); err != nil {
+		t.Fatalf("Use function returned error: [%s]", err)
+	}
+
+	if err := profiles.Save(path); err != nil {
+		t.Fatalf("Save function returned error: [%s]", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load function returned error: [%s]", err)
+	}
+
+	if names := loaded.Names(); !reflect.DeepEqual(names, []string{"dev", "team"}) {
+		t.Errorf("wrong names of profiles: [%v]", names)
+	}
+
+	if name, current, err := loaded.Get(""); err != nil || name != "team" || !reflect.DeepEqual(current, team) {
+		t.Errorf("wrong current profile: [%s] [%v] [%v]", name, current, err)
+	}
+
+	if err := loaded.Remove("team"); err != nil || loaded.Current != "" {
+		t.Errorf("removed profile is still current: [%s] [%v]", loaded.Current, err)
+	}
+
+	if _, _, err := loaded.Get("team"); err == nil {
+		t.Errorf("removed profile is returned")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("profiles:\n  dev:\n    provder: gcp\n"), 0600); err != nil {
+		t.Fatalf("WriteFile function returned error: [%s]", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Errorf("profile with unknown field is read")
+	}
+}
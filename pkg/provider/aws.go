@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -127,6 +128,17 @@ func (provider *providerAWS) MakeDestroyImageConfig(imageVariables config.Config
 	return makeDestroyImageConfigGeneral(configsToSet, templates[provider.GetName()]["destroyImageTemplate"])
 }
 
+func (provider *providerAWS) GetImportedResources(descriptor string, cloudID string,
+	variables map[string]string) ([]ImportedResource, error) {
+	if descriptor == ImageDescriptor {
+		return getImportedImageGeneral(cloudID, provider), nil
+	}
+
+	// resources of clusters and storage nodes have IDs generated by AWS, they cannot be found by the name
+	return nil, fmt.Errorf("provider %s cannot find resources of %s by its ID, give IDs of all resources instead",
+		provider.GetName(), descriptor)
+}
+
 func (provider *providerAWS) MakeCreateClusterConfig(clusterTemplatePath string,
 	clusterVariables config.Config) (config.Config, error) {
 	return provider.baseFunctionality.MakeCreateClusterConfig(provider, clusterTemplatePath, clusterVariables)
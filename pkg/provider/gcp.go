@@ -1,7 +1,9 @@
 package provider
 
 import (
+	"fmt"
 	"path/filepath"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
@@ -100,6 +102,60 @@ func (provider *providerGCP) MakeDestroyImageConfig(imageVariables config.Config
 	return makeDestroyImageConfigGeneral(configsToSet, templates[provider.GetName()]["destroyImageTemplate"])
 }
 
+// GetImportedResources finds resources of GCP objects by their names which are made of the name
+// of the object, i.e. cloudID is the name of the image, cluster or storage node
+func (provider *providerGCP) GetImportedResources(descriptor string, cloudID string,
+	variables map[string]string) ([]ImportedResource, error) {
+	region := provider.GetRegion()
+	zone := fmt.Sprintf("%s/%s-%s", variables["project_name"], region, provider.GetZone())
+
+	switch descriptor {
+	case ImageDescriptor:
+		return getImportedImageGeneral(cloudID, provider), nil
+	case ClusterDescriptor:
+		workerCount, err := strconv.Atoi(variables["worker_count"])
+		if err != nil {
+			return nil, fmt.Errorf("wrong worker_count: %w", err)
+		}
+
+		module := "module." + provider.GetName() + "_provider."
+		resources := []ImportedResource{
+			{Address: module + "google_compute_network.cluster", ID: cloudID},
+			{Address: module + "google_compute_subnetwork.cluster_subnet", ID: region + "/" + cloudID},
+			{Address: module + "google_compute_address.login_public", ID: region + "/" + cloudID + "-login-node-public"},
+			{Address: module + "google_compute_firewall.allow_incoming_ingress_rule",
+				ID: cloudID + "-allow-incoming-ingress-rule"},
+			{Address: module + "google_compute_firewall.egress_rule", ID: cloudID + "-egress-rule"},
+			{Address: module + "google_compute_firewall.allow_interconnect_ingress_rule",
+				ID: cloudID + "-allow-interconnect-ingress-rule"},
+			{Address: module + "google_compute_instance.login", ID: zone + "/" + cloudID + "-login"},
+		}
+
+		for idx := 0; idx < workerCount; idx++ {
+			resources = append(resources, ImportedResource{
+				Address: fmt.Sprintf("%sgoogle_compute_instance.worker[%d]", module, idx),
+				ID:      fmt.Sprintf("%s/%s-worker-%d", zone, cloudID, idx),
+			})
+		}
+
+		return resources, nil
+	case StorageNodeDescriptor:
+		// only the disk is required, the node using it is spawned when the storage is created
+		return []ImportedResource{
+			{Address: provider.GetTFStorageResourceName() + ".storage", ID: zone + "/" + cloudID + "-disk"},
+			{Address: "google_compute_network.storage", ID: cloudID, Optional: true},
+			{Address: "google_compute_subnetwork.storage_subnet", ID: region + "/" + cloudID, Optional: true},
+			{Address: "google_compute_address.storage_public", ID: region + "/" + cloudID + "-storage-public",
+				Optional: true},
+			{Address: "google_compute_firewall.allow_incoming_ingress_rule",
+				ID: cloudID + "-allow-incoming-ingress-rule", Optional: true},
+			{Address: "google_compute_instance.storage", ID: zone + "/" + cloudID + "-node", Optional: true},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("provider %s cannot import %s", provider.GetName(), descriptor)
+}
+
 func (provider *providerGCP) MakeCreateClusterConfig(clusterTemplatePath string,
 	clusterVariables config.Config) (config.Config, error) {
 	return provider.baseFunctionality.MakeCreateClusterConfig(provider, clusterTemplatePath, clusterVariables)
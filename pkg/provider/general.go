@@ -134,3 +134,9 @@ func redefinitionVariablesSection(variablesSection map[string]interface{},
 
 	return redefinedVariables
 }
+
+// getImportedImageGeneral returns the resource of the image destruction config, cloudID is the ID
+// of the image as terraform import of the image resource expects it
+func getImportedImageGeneral(cloudID string, provider Provider) []ImportedResource {
+	return []ImportedResource{{Address: provider.GetTFImageResourceName() + ".zyme_image", ID: cloudID}}
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
@@ -43,12 +44,13 @@ func ExtractOutputValues(json config.Config, names ...string) ([]string, error)
 }
 
 // ParseTerraformOutputs calles "terraform output" and returns its output as parsed config
-func ParseTerraformOutputs(workDir, logPrefix string, logger *log.Entry) (config.Config, error) {
+func ParseTerraformOutputs(ctx context.Context, workDir, logPrefix string, logger *log.Entry) (config.Config,
+	error) {
 	logger = logger.WithField("dir", workDir)
 
 	var buffer bytes.Buffer
 
-	if _, err := action_pkg.RunLoggedCmdDirOutput(logPrefix, workDir, &buffer, Terraform(),
+	if _, err := action_pkg.RunLoggedCmdDirOutput(ctx, logPrefix, workDir, &buffer, Terraform(),
 		"output", "-no-color", "-json"); err != nil {
 		logger.Errorf("ParseTerraformOutputs: cannot read terraform output: %s", err)
 		return nil, err
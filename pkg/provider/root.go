@@ -82,6 +82,8 @@ func initProviders() {
 			makeAbsPath(providerName, "storage/standalone_template.tf.json")
 		templates[providerName]["attachedStorageTemplate"] =
 			makeAbsPath(providerName, "storage/attached_template.tf.json")
+
+		templates[providerName]["variablesSchema"] = makeAbsPath(providerName, "variables_schema.json")
 	}
 }
 
@@ -105,11 +107,27 @@ type Provider interface {
 	MakeStorageNodeConfig(storageTemplatePath string, storageVariables config.Config) (config.Config, error)
 
 	GetImageConfigHash(data []byte) (string, error)
+	// GetImportedResources returns terraform resources of the object described by descriptor which
+	// are adopted by "terraform import" from the cloud object cloudID; variables are the values of
+	// template variables the object is configured with
+	GetImportedResources(descriptor string, cloudID string, variables map[string]string) (
+		[]ImportedResource, error)
+
 	setupProviderSpecificVariables(variablesSection map[string]interface{}, configHash string,
 		packInDefaultSection bool) error
 	setupSourcePath(clusterTemplate config.Config) error
 }
 
+// ImportedResource is a terraform resource of an object adopted from the cloud
+type ImportedResource struct {
+	// Address of the resource in the configuration of the object
+	Address string
+	// ID of the resource as "terraform import" expects it
+	ID string
+	// Optional resources may be missing in the cloud, they are created when the object is created
+	Optional bool
+}
+
 // MemorizedID creates provider unique ID, that consists of
 // provider name, region, zone and checksum of credentials data
 func MemorizedID(prov Provider) (string, error) {
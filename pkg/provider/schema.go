@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/config"
+)
+
+const variablesSchemaSectionName = "variables"
+
+// GetVariablesSchema returns descriptions of all variables user can set for the provider:
+// variables of its templates with their defaults, described by types and descriptions
+// from variables_schema.json of the provider
+func GetVariablesSchema(providerName string) (config.Schema, error) {
+	if !IsProviderSupported(providerName) {
+		errorMessage := "provider not implemented"
+
+		log.WithFields(log.Fields{
+			"providerName": providerName,
+		}).Errorf("GetVariablesSchema: %s", errorMessage)
+
+		return nil, fmt.Errorf(errorMessage)
+	}
+
+	schema := config.Schema{}
+
+	for _, descriptor := range []string{ImageDescriptor, ClusterDescriptor, StorageNodeDescriptor,
+		StorageAttachedDescriptor} {
+		templatePath, err := GetDefaultTemplate(providerName, descriptor)
+		if err != nil {
+			return nil, err
+		}
+
+		// not every provider has templates of all objects
+		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
+			continue
+		}
+
+		_, variables, err := getSectionFromTemplate(providerName, templatePath, descriptor)
+		if err != nil {
+			return nil, err
+		}
+
+		if descriptor != ImageDescriptor {
+			if variables, err = removeDefaultLayerFromClusterSection(variables); err != nil {
+				return nil, err
+			}
+		}
+
+		for name, value := range variables {
+			if _, ok := schema[name]; !ok {
+				schema[name] = config.Variable{Type: guessVariableType(value), Default: value}
+			}
+		}
+	}
+
+	schemaPath := templates[providerName]["variablesSchema"]
+
+	described, err := config.CreateJSONConfigFromFile(schemaPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"schemaPath": schemaPath,
+		}).Errorf("GetVariablesSchema: cannot create config from file: %s", err)
+
+		return nil, err
+	}
+
+	section, err := described.GetStringMap(variablesSchemaSectionName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"schemaPath": schemaPath,
+		}).Errorf("GetVariablesSchema: cannot get string map: %s", err)
+
+		return nil, err
+	}
+
+	for name, value := range section {
+		variable, err := decodeVariable(value)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"schemaPath": schemaPath,
+				"variable":   name,
+			}).Errorf("GetVariablesSchema: %s", err)
+
+			return nil, err
+		}
+
+		variable.Default = schema[name].Default
+		schema[name] = variable
+	}
+
+	return schema, nil
+}
+
+// decodeVariable reads description of the variable from the schema file
+func decodeVariable(value interface{}) (config.Variable, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return config.Variable{}, fmt.Errorf("description of the variable is not an object")
+	}
+
+	variable := config.Variable{}
+	variable.Type, _ = fields["type"].(string)
+	variable.Description, _ = fields["description"].(string)
+	variable.Required, _ = fields["required"].(bool)
+
+	known := false
+	for _, variableType := range config.Types {
+		known = known || variableType == variable.Type
+	}
+
+	if !known {
+		return config.Variable{}, fmt.Errorf("unknown type %s, expected one of {%s}", variable.Type,
+			strings.Join(config.Types, ", "))
+	}
+
+	if allowed, ok := fields["allowed"].([]interface{}); ok {
+		for _, item := range allowed {
+			variable.Allowed = append(variable.Allowed, fmt.Sprint(item))
+		}
+	}
+
+	return variable, nil
+}
+
+// guessVariableType returns the type of the variable missing in the schema file by its default
+func guessVariableType(value interface{}) string {
+	switch value.(type) {
+	case float64:
+		return config.TypeNumber
+	case bool:
+		return config.TypeBool
+	case []interface{}:
+		return config.TypeList
+	case map[string]interface{}:
+		return config.TypeMap
+	}
+
+	return config.TypeString
+}
@@ -0,0 +1,205 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Mask replaces secrets in logs
+	Mask = "<redacted>"
+
+	// fingerprintPrefix marks persisted values containing secrets
+	fingerprintPrefix = "redacted:"
+	// minLength is the length of the shortest value which is redacted, masking shorter ones
+	// would mangle every log line without hiding anything
+	minLength = 4
+)
+
+var (
+	mutex sync.RWMutex
+	// secrets are sorted from the longest one, so secrets containing others are masked whole
+	secrets []string
+)
+
+// Register marks the value as a secret, it's redacted from logs and persisted state from now on
+func Register(value string) {
+	if len(value) < minLength {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, known := range secrets {
+		if known == value {
+			return
+		}
+	}
+
+	secrets = append(secrets, value)
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// Forget unmarks all secrets
+func Forget() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	secrets = nil
+}
+
+// Contains checks if the text contains any secret
+func Contains(text string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, value := range secrets {
+		if strings.Contains(text, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact masks all secrets in the text
+func Redact(text string) string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, value := range secrets {
+		text = strings.Replace(text, value, Mask, -1)
+	}
+
+	return text
+}
+
+// Fingerprint returns the value to be persisted: values containing secrets are replaced by their hashes,
+// so changes of secrets are still noticed
+func Fingerprint(value string) string {
+	if !Contains(value) {
+		return value
+	}
+
+	return hash(value)
+}
+
+// Same tells if persisted values are of the same value, any of them may be a fingerprint,
+// e.g. when a plain value is replaced by the reference to the file containing it
+func Same(first, second string) bool {
+	return first == second || first == hash(second) || hash(first) == second
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+
+	return fingerprintPrefix + hex.EncodeToString(sum[:8])
+}
+
+// FingerprintFields replaces string fields of the struct pointed by ptr by their fingerprints
+func FingerprintFields(ptr interface{}) {
+	value := reflect.ValueOf(ptr).Elem()
+
+	for idx := 0; idx < value.NumField(); idx++ {
+		field := value.Field(idx)
+		if field.Kind() == reflect.String && field.CanSet() {
+			field.SetString(Fingerprint(field.String()))
+		}
+	}
+}
+
+// Hook is logrus hook redacting secrets from messages and fields of log entries
+type Hook struct{}
+
+// Levels returns all levels as secrets are redacted from all entries
+func (hook Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire redacts the entry before it's written by other hooks
+func (hook Hook) Fire(entry *log.Entry) error {
+	entry.Message = Redact(entry.Message)
+
+	var redacted log.Fields
+
+	for key, value := range entry.Data {
+		text := fmt.Sprint(value)
+		if !Contains(text) {
+			continue
+		}
+
+		if redacted == nil {
+			// fields may be shared by entries logged concurrently, so they are copied
+			redacted = make(log.Fields, len(entry.Data))
+			for key, value := range entry.Data {
+				redacted[key] = value
+			}
+		}
+
+		redacted[key] = Redact(text)
+	}
+
+	if redacted != nil {
+		entry.Data = redacted
+	}
+
+	return nil
+}
+
+// Writer redacts secrets from lines written to the underlying writer,
+// the last line without newline is written by Flush
+type Writer struct {
+	out    io.Writer
+	mutex  sync.Mutex
+	buffer []byte
+}
+
+// NewWriter creates the writer redacting secrets written to out
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out}
+}
+
+func (writer *Writer) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.buffer = append(writer.buffer, data...)
+
+	if end := bytes.LastIndexByte(writer.buffer, '\n'); end >= 0 {
+		lines := writer.buffer[:end+1]
+		if _, err := io.WriteString(writer.out, Redact(string(lines))); err != nil {
+			return 0, err
+		}
+
+		writer.buffer = append(writer.buffer[:0], writer.buffer[end+1:]...)
+	}
+
+	return len(data), nil
+}
+
+// Flush writes the rest of the data
+func (writer *Writer) Flush() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if len(writer.buffer) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(writer.out, Redact(string(writer.buffer)))
+	writer.buffer = nil
+
+	return err
+}
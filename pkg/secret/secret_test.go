@@ -0,0 +1,88 @@
+package secret
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRedact(t *testing.T) {
+	defer Forget()
+
+	Register("s3cr3t-token")
+	Register("s3cr3t")
+	Register("abc")
+
+	if redacted := Redact("token=s3cr3t-token, short=abc, other=s3cr3t"); redacted !=
+		"token=<redacted>, short=abc, other=<redacted>" {
+		t.Errorf("wrong redacted text: [%s]", redacted)
+	}
+
+	if value := Fingerprint("plain"); value != "plain" {
+		t.Errorf("value without secrets is changed: [%s]", value)
+	}
+
+	fingerprint := Fingerprint("prefix-s3cr3t")
+	if !strings.HasPrefix(fingerprint, fingerprintPrefix) || strings.Contains(fingerprint, "s3cr3t") ||
+		fingerprint == Fingerprint("prefix-s3cr3t-token") {
+		t.Errorf("wrong fingerprint of the secret: [%s]", fingerprint)
+	}
+
+	if !Same("prefix-s3cr3t", fingerprint) || !Same(fingerprint, "prefix-s3cr3t") || Same("plain", fingerprint) {
+		t.Errorf("fingerprint doesn't match its value: [%s]", fingerprint)
+	}
+
+	fields := struct {
+		Name  string
+		Token string
+		Count int
+	}{"name", "s3cr3t", 1}
+
+	FingerprintFields(&fields)
+
+	if fields.Name != "name" || !strings.HasPrefix(fields.Token, fingerprintPrefix) || fields.Count != 1 {
+		t.Errorf("wrong fingerprinted fields: [%v]", fields)
+	}
+}
+
+func TestRedactLogs(t *testing.T) {
+	defer Forget()
+
+	Register("s3cr3t")
+
+	var out bytes.Buffer
+
+	logger := log.New()
+	logger.SetOutput(&out)
+	logger.AddHook(Hook{})
+
+	entry := logger.WithField("vars", map[string]string{"token": "s3cr3t"})
+	entry.Infof("resolved s3cr3t")
+
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("secret is logged: [%s]", out.String())
+	}
+
+	if value := entry.Data["vars"].(map[string]string)["token"]; value != "s3cr3t" {
+		t.Errorf("fields of the entry are changed: [%s]", value)
+	}
+
+	out.Reset()
+
+	writer := NewWriter(&out)
+	for _, chunk := range []string{"first s3c", "r3t line\nlast s3", "cr3t"} {
+		if _, err := writer.Write([]byte(chunk)); err != nil {
+			t.Fatalf("Write function returned error: [%s]", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush function returned error: [%s]", err)
+	}
+
+	if out.String() != "first <redacted> line\nlast <redacted>" {
+		t.Errorf("wrong redacted output: [%s]", out.String())
+	}
+}
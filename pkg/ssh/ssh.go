@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -20,7 +21,7 @@ type ZymeClient interface {
 	Close()
 	PutFile(localPath, remotePath string, newlineConversion, overwrite bool, makeExecutable bool) error
 	GetFile(localPath, remotePath string, overwrite bool) error
-	ExecuteCommand(command string, getOutput bool) error
+	ExecuteCommand(ctx context.Context, command string, getOutput bool) error
 	Equals(other ZymeClient) bool
 	Split(path string) (dir, file string)
 }
@@ -332,7 +333,9 @@ func (client *zymeClient) GetFile(remotePath, localPath string, overwrite bool)
 	return nil
 }
 
-func (client *zymeClient) ExecuteCommand(command string, getOutput bool) error {
+// ExecuteCommand runs the command remotely; if ctx is cancelled the command is sent
+// an interrupt signal and the session is closed without waiting for the command to exit
+func (client *zymeClient) ExecuteCommand(ctx context.Context, command string, getOutput bool) error {
 	session, err := client.internalClient.NewSession()
 	if err != nil {
 		log.Errorf("zymeClient.ExecuteCommand: %s", err)
@@ -358,7 +361,30 @@ func (client *zymeClient) ExecuteCommand(command string, getOutput bool) error {
 		session.Stderr = os.Stderr
 	}
 
-	return session.Run(command)
+	if err := session.Start(command); err != nil {
+		log.Errorf("zymeClient.ExecuteCommand: %s", err)
+		return err
+	}
+
+	finished := make(chan error, 1)
+
+	go func() {
+		finished <- session.Wait()
+	}()
+
+	select {
+	case err := <-finished:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.WithField("command", command).Info("zymeClient.ExecuteCommand: interrupting remote command")
+
+	if err := session.Signal(ssh.SIGINT); err != nil {
+		log.Warnf("zymeClient.ExecuteCommand: cannot send interrupt: %s", err)
+	}
+
+	return fmt.Errorf("remote command interrupted: %w", ctx.Err())
 }
 
 func (client *zymeClient) Split(path string) (dir, file string) {
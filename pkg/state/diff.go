@@ -0,0 +1,116 @@
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/config"
+	"enzyme/pkg/secret"
+)
+
+// Change is a difference of a user variable the stored object was made with and the requested one
+type Change struct {
+	Name      string
+	Stored    string
+	Requested string
+}
+
+func (change Change) String() string {
+	return fmt.Sprintf("%s: %q => %q", change.Name, change.Stored, change.Requested)
+}
+
+// Diff returns differences of string fields of stored and requested variables, both are structs
+// of the same type; fields are named by their var tags, or by their names if there are none.
+// A value isn't changed if it's only replaced by its fingerprint or the other way round.
+func Diff(stored, requested interface{}) []Change {
+	changes := []Change{}
+
+	storedValue, requestedValue := reflect.ValueOf(stored), reflect.ValueOf(requested)
+
+	for idx := 0; idx < storedValue.NumField(); idx++ {
+		field := storedValue.Type().Field(idx)
+		if field.Type.Kind() != reflect.String {
+			continue
+		}
+
+		name := field.Tag.Get("var")
+		if name == "" {
+			name = field.Name
+		}
+
+		if before, after := storedValue.Field(idx).String(), requestedValue.Field(idx).String(); !secret.Same(before, after) {
+			changes = append(changes, Change{name, before, after})
+		}
+	}
+
+	return changes
+}
+
+// CheckVariables compares user variables the entry was stored with and the requested ones, both are
+// structs of the same type, and tells if the stored entry is kept. An entry made with other variables
+// is dropped unless it exists in the cloud (live is true); then it's kept only if the policy adopts it,
+// otherwise ChangedVariablesError is returned. The policy reporting changes returns the error for
+// any stored entry.
+func CheckVariables(stored, requested interface{}, live bool, policy config.ChangedVariablesPolicy) (bool, error) {
+	changes := Diff(stored, requested)
+	if len(changes) == 0 {
+		return true, nil
+	}
+
+	logger := log.WithFields(log.Fields{
+		"loaded-vars":  stored,
+		"current-vars": requested,
+		"changes":      changes,
+	})
+
+	switch {
+	case policy == config.ReportChangedVariables:
+		return false, &ChangedVariablesError{Changes: changes}
+	case !live:
+		logger.Info("CheckVariables: loaded user variables differ from current, invalidating stored state")
+
+		return false, nil
+	case policy == config.AdoptChangedVariables:
+		logger.Warn("CheckVariables: loaded user variables differ from current, adopting the existing object")
+
+		return true, nil
+	}
+
+	logger.Info("CheckVariables: loaded user variables differ from current for the existing object")
+
+	return false, &ChangedVariablesError{Changes: changes}
+}
+
+// ChangedVariablesError is returned when the stored object was made with other user variables,
+// while it still exists in the cloud
+type ChangedVariablesError struct {
+	// ID of the stored entry, it's set when the entry is loaded
+	ID      string
+	Changes []Change
+}
+
+func (changedErr *ChangedVariablesError) Error() string {
+	changes := make([]string, len(changedErr.Changes))
+	for idx, change := range changedErr.Changes {
+		changes[idx] = change.String()
+	}
+
+	return fmt.Sprintf("%s was made with other variables: %s", changedErr.ID, strings.Join(changes, ", "))
+}
+
+// Describe returns the differences of variables line by line
+func (changedErr *ChangedVariablesError) Describe() string {
+	var description strings.Builder
+
+	fmt.Fprintf(&description, "%s was made with other variables:\n", changedErr.ID)
+	fmt.Fprintf(&description, "    %-25s %-25s %s\n", "variable", "stored", "requested")
+
+	for _, change := range changedErr.Changes {
+		fmt.Fprintf(&description, "    %-25s %-25q %q\n", change.Name, change.Stored, change.Requested)
+	}
+
+	return description.String()
+}
@@ -1,12 +1,13 @@
 package state
 
 import (
-	"os"
+	"encoding/json"
 	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"enzyme/pkg/encryption"
 	"enzyme/pkg/storage"
 )
 
@@ -37,58 +38,123 @@ type IsParseEntryFunc func(id string) bool
 // when walking the stored states
 type OnEntryFunc func(id string, entry Entry) error
 
+// Query selects stored entries by their kind (the first element of hierarchy), provider name
+// and status, empty fields match any entry; chests which can, look them up by indexes
+type Query struct {
+	Kind     string
+	Provider string
+	Status   *int
+}
+
+// indexedFields are the stored fields of entries which queries look at
+type indexedFields struct {
+	Provider string
+	Status   *int
+}
+
+// kindOf returns the kind of the entry with given identifier
+func kindOf(id string) string {
+	return strings.SplitN(id, "/", 2)[0]
+}
+
+// pathOf returns the path chests use as the key of the entry with given identifier
+func pathOf(id string) string {
+	return filepath.Join(stateDir, filepath.FromSlash(id)+stateExt)
+}
+
+// indexOf extracts indexed fields from stored contents of an entry, fields of unexpected
+// types are left empty as entries of some kinds don't have them
+func indexOf(content []byte) indexedFields {
+	var (
+		stored struct {
+			Provider json.RawMessage
+			Status   json.RawMessage
+		}
+		provider struct {
+			Name string
+		}
+		result indexedFields
+	)
+
+	content, err := encryption.Open(content)
+	if err != nil {
+		return result
+	}
+
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return result
+	}
+
+	if err := json.Unmarshal(stored.Provider, &provider); err == nil {
+		result.Provider = provider.Name
+	}
+
+	var status int
+	if err := json.Unmarshal(stored.Status, &status); err == nil {
+		result.Status = &status
+	}
+
+	return result
+}
+
+func (query Query) matches(id string, content []byte) bool {
+	if query.Kind != "" && query.Kind != kindOf(id) {
+		return false
+	}
+
+	if query.Provider == "" && query.Status == nil {
+		return true
+	}
+
+	index := indexOf(content)
+
+	if query.Provider != "" && query.Provider != index.Provider {
+		return false
+	}
+
+	return query.Status == nil || (index.Status != nil && *query.Status == *index.Status)
+}
+
 // Enumerate walks over all stored states and calls onEntry on each of them
 func (fetcher Fetcher) Enumerate(isParse IsParseEntryFunc, onEntry OnEntryFunc) error {
-	return filepath.Walk(stateDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			logger := log.WithFields(log.Fields{
-				"path": path,
-			})
-			if os.IsNotExist(err) {
-				logger.Infof("Enumerate: cannot walk the path: %s", err)
-				return filepath.SkipDir
-			}
-			logger.Errorf("Enumerate: cannot walk the path: %s", err)
-			return err
+	return fetcher.EnumerateQuery(Query{}, isParse, onEntry)
+}
+
+// EnumerateQuery calls onEntry on each stored state matching the query
+func (fetcher Fetcher) EnumerateQuery(query Query, isParse IsParseEntryFunc, onEntry OnEntryFunc) error {
+	ids, err := fetcher.Chest.find(query)
+	if err != nil {
+		log.WithField("query", query).Errorf("Enumerate: cannot find stored states: %s", err)
+		return err
+	}
+
+	for _, id := range ids {
+		if !isParse(id) {
+			continue
 		}
-		if info.IsDir() || !strings.HasSuffix(path, stateExt) {
-			log.WithFields(log.Fields{
-				"path": path,
-			}).Info("Enumerate: skipping path as it's a directory or doesn't have correct extension")
-			return nil
+
+		entry, path, err := fetcher.blueprintFor(id)
+		if err != nil {
+			log.WithField("id", id).Infof("Enumerate: skipping entry: %s", err)
+			continue
 		}
-		relPath, err := filepath.Rel(stateDir, path)
+
+		loaded, err := fetcher.loadFromPath(entry, path)
 		if err != nil {
 			log.WithFields(log.Fields{
-				"path": path,
-			}).Errorf("Enumerate: cannot compute relative path: %s", err)
+				"path":    path,
+				"read-as": entry,
+			}).Errorf("Enumerate: cannot load path as expected entry: %s", err)
+
 			return err
 		}
-		id := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(relPath)), stateExt)
-		if !isParse(id) {
-			return nil
-		}
-		hierarchy := strings.Split(id, "/")
-		for _, handler := range handlers {
-			entry := handler(hierarchy, fetcher)
-			if entry != nil {
-				entry2, err := fetcher.loadFromPath(entry, path)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"path":    path,
-						"read-as": entry,
-					}).Errorf("Enumerate: cannot load path as expected entry: %s", err)
-					return err
-				}
-				err = onEntry(id, entry2)
-				if err != nil {
-					return err
-				}
-				break
-			}
+
+		if err := onEntry(id, loaded); err != nil {
+			return err
 		}
-		return nil
-	})
+	}
+
+	return nil
 }
 
 func init() {
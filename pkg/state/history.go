@@ -0,0 +1,287 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/storage"
+)
+
+const (
+	historyCategory = "state-history"
+)
+
+var (
+	// ErrNoHistory is returned for history requests to chests which keep only the current state
+	ErrNoHistory = errors.New("state backend keeps no history")
+
+	historyDir string
+	// HistoryLimit is the number of previous versions kept for every entry
+	HistoryLimit = 10
+)
+
+// Version is one of previous states of an entry
+type Version struct {
+	Number int
+	// Time is when this state was replaced by a newer one
+	Time  time.Time
+	Entry Entry
+}
+
+// storedVersion is a previous version as kept by a chest
+type storedVersion struct {
+	number int
+	time   time.Time
+}
+
+// versionedChest is a Chest which keeps previous versions of objects it stores
+type versionedChest interface {
+	Chest
+	versions(path string) ([]storedVersion, error)
+	getVersion(blank interface{}, path string, version int) (interface{}, error)
+	restore(path string, version int) error
+}
+
+// historyPath returns the directory keeping previous versions of state file at given path
+func historyPath(path string) (string, error) {
+	id, err := entryID(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(historyDir, filepath.FromSlash(id)), nil
+}
+
+func versionPath(dir string, version int) string {
+	return filepath.Join(dir, strconv.Itoa(version)+stateExt)
+}
+
+func (ch *JSONChest) versions(path string) ([]storedVersion, error) {
+	dir, err := historyPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []storedVersion{}, nil
+		}
+
+		return nil, err
+	}
+
+	result := []storedVersion{}
+
+	for _, file := range files {
+		number, err := strconv.Atoi(strings.TrimSuffix(file.Name(), stateExt))
+		if err != nil || file.IsDir() || !strings.HasSuffix(file.Name(), stateExt) {
+			continue
+		}
+
+		result = append(result, storedVersion{number: number, time: file.ModTime()})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].number < result[j].number
+	})
+
+	return result, nil
+}
+
+// archive copies current state at path to the history as the newest version,
+// dropping the oldest versions beyond HistoryLimit
+func (ch *JSONChest) archive(path string) error {
+	if !ch.has(path) || HistoryLimit <= 0 {
+		return nil
+	}
+
+	dir, err := historyPath(path)
+	if err != nil {
+		return err
+	}
+
+	versions, err := ch.versions(path)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) != 0 {
+		next = versions[len(versions)-1].number + 1
+	}
+
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := storage.WriteFileAtomic(versionPath(dir, next), 0640, func(w io.Writer) error {
+		_, err := io.Copy(w, source)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	for len(versions)+1 > HistoryLimit {
+		if err := os.Remove(versionPath(dir, versions[0].number)); err != nil {
+			return err
+		}
+
+		versions = versions[1:]
+	}
+
+	return nil
+}
+
+func (ch *JSONChest) getVersion(blank interface{}, path string, version int) (interface{}, error) {
+	dir, err := historyPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ch.get(blank, versionPath(dir, version))
+}
+
+func (ch *JSONChest) restore(path string, version int) error {
+	dir, err := historyPath(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(versionPath(dir, version))
+	if err != nil {
+		return err
+	}
+
+	if err := ch.archive(path); err != nil {
+		return err
+	}
+
+	return storage.WriteFileAtomic(path, 0640, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// blueprintFor finds a handler which knows how to load the entry with given identifier
+func (fetcher Fetcher) blueprintFor(id string) (Entry, string, error) {
+	hierarchy := strings.Split(id, "/")
+
+	for _, handler := range handlers {
+		if entry := handler(hierarchy, fetcher); entry != nil {
+			return entry, pathOf(id), nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("unknown kind of object %s", id)
+}
+
+func (fetcher Fetcher) versionedChest() (versionedChest, error) {
+	versioned, ok := fetcher.Chest.(versionedChest)
+	if !ok {
+		return nil, ErrNoHistory
+	}
+
+	return versioned, nil
+}
+
+// History returns previous versions of the entry with given identifier, oldest first
+func (fetcher Fetcher) History(id string) ([]Version, error) {
+	versioned, err := fetcher.versionedChest()
+	if err != nil {
+		return nil, err
+	}
+
+	blueprint, path, err := fetcher.blueprintFor(id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := versioned.versions(path)
+	if err != nil {
+		log.WithField("id", id).Errorf("History: cannot list versions: %s", err)
+		return nil, err
+	}
+
+	result := []Version{}
+
+	for _, version := range versions {
+		blank, err := blueprint.ToPublic()
+		if err != nil {
+			return nil, err
+		}
+
+		if blank, err = versioned.getVersion(blank, path, version.number); err != nil {
+			return nil, err
+		}
+
+		entry, err := blueprint.FromPublic(blank)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"id":      id,
+				"version": version.number,
+			}).Errorf("History: failed FromPublic(): %s", err)
+
+			return nil, err
+		}
+
+		result = append(result, Version{Number: version.number, Time: version.time, Entry: entry})
+	}
+
+	return result, nil
+}
+
+// Rollback replaces stored state of the entry with given identifier by one of its previous
+// versions, the replaced state becomes the newest version in the history. The entry is locked,
+// so it isn't rolled back while other processes change it.
+func (fetcher Fetcher) Rollback(id string, version int) error {
+	versioned, err := fetcher.versionedChest()
+	if err != nil {
+		return err
+	}
+
+	_, path, err := fetcher.blueprintFor(id)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := fetcher.lockPath(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	history, err := fetcher.History(id)
+	if err != nil {
+		return err
+	}
+
+	for _, known := range history {
+		if known.Number == version {
+			log.WithFields(log.Fields{
+				"id":      id,
+				"version": version,
+			}).Info("Rollback: restoring previous version")
+
+			return versioned.restore(path, version)
+		}
+	}
+
+	return fmt.Errorf("%s has no version %d", id, version)
+}
+
+func init() {
+	historyDir = storage.GetStoragePath(historyCategory)
+}
@@ -0,0 +1,290 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/storage"
+)
+
+const (
+	locksCategory = "locks"
+	lockExt       = ".lock"
+)
+
+var (
+	locksDir string
+)
+
+// LockInfo describes who holds the lock of an entry
+type LockInfo struct {
+	PID   int
+	Host  string
+	Since time.Time
+}
+
+func (info LockInfo) String() string {
+	return fmt.Sprintf("pid %d on host %s since %s", info.PID, info.Host, info.Since.Format(time.RFC3339))
+}
+
+// LockedError is returned when an entry is locked by another process
+type LockedError struct {
+	ID     string
+	Holder LockInfo
+}
+
+func (lockedErr *LockedError) Error() string {
+	return fmt.Sprintf("%s is locked by %s", lockedErr.ID, lockedErr.Holder)
+}
+
+// lockingChest is a Chest which can lock stored objects for processes sharing the storage
+type lockingChest interface {
+	Chest
+	// lock acquires the lock of object at path, returned function releases it
+	lock(path string) (func(), error)
+	// locks returns all held locks by identifiers of objects
+	locks() (map[string]LockInfo, error)
+	// breakLock removes the lock of object with given identifier regardless of its holder
+	breakLock(id string) error
+}
+
+func currentLockInfo() LockInfo {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return LockInfo{PID: os.Getpid(), Host: host, Since: time.Now()}
+}
+
+// entryID returns identifier of the object stored at path
+func entryID(path string) (string, error) {
+	relPath, err := filepath.Rel(stateDir, path)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("%s is not a state file", path)
+	}
+
+	return strings.TrimSuffix(filepath.ToSlash(relPath), stateExt), nil
+}
+
+func lockPath(id string) string {
+	return filepath.Join(locksDir, filepath.FromSlash(id)+lockExt)
+}
+
+func readLock(path string) (LockInfo, error) {
+	var info LockInfo
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+
+	err = json.Unmarshal(content, &info)
+
+	return info, err
+}
+
+// isStale tells if the lock was left by a process which died on this host
+func (info LockInfo) isStale() bool {
+	current := currentLockInfo()
+	return info.Host == current.Host && info.PID != current.PID && !storage.ProcessExists(info.PID)
+}
+
+// createLock creates the lock file unless it exists, the file is created with
+// O_EXCL so only one of racing processes succeeds
+func createLock(path string, info LockInfo) error {
+	if err := storage.CreateDirForFile(path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+
+	if err = json.NewEncoder(file).Encode(info); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path)
+	}
+
+	return err
+}
+
+// fileLocks implements locking of entries by lock files in locksDir for chests keeping them anywhere
+type fileLocks struct {
+}
+
+func (fl fileLocks) lock(path string) (func(), error) {
+	id, err := entryID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lockFile := lockPath(id)
+	info := currentLockInfo()
+
+	for attempt := 0; ; attempt++ {
+		err = createLock(lockFile, info)
+		if err == nil {
+			break
+		}
+
+		if !os.IsExist(err) {
+			log.WithField("path", lockFile).Errorf("fileLocks.lock: cannot create lock: %s", err)
+			return nil, err
+		}
+
+		holder, readErr := readLock(lockFile)
+		if readErr != nil {
+			// the holder could have just released the lock or not yet written it
+			if attempt < 3 {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			return nil, fmt.Errorf("%s is locked, cannot read lock %s: %w", id, lockFile, readErr)
+		}
+
+		if attempt == 0 && holder.isStale() {
+			log.WithFields(log.Fields{
+				"path":   lockFile,
+				"holder": holder,
+			}).Warn("fileLocks.lock: removing lock of the process which is not running anymore")
+
+			if err := os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			continue
+		}
+
+		return nil, &LockedError{ID: id, Holder: holder}
+	}
+
+	return func() {
+		// the lock could be broken by force and taken by another process
+		if holder, err := readLock(lockFile); err == nil && holder.PID == info.PID && holder.Since.Equal(info.Since) {
+			if err := os.Remove(lockFile); err != nil {
+				log.WithField("path", lockFile).Warnf("fileLocks.unlock: cannot remove lock: %s", err)
+			}
+		}
+	}, nil
+}
+
+func (fl fileLocks) locks() (map[string]LockInfo, error) {
+	result := map[string]LockInfo{}
+
+	err := filepath.Walk(locksDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, lockExt) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(locksDir, path)
+		if err != nil {
+			return err
+		}
+
+		holder, err := readLock(path)
+		if err != nil {
+			log.WithField("path", path).Warnf("fileLocks.locks: cannot read lock: %s", err)
+		}
+
+		result[strings.TrimSuffix(filepath.ToSlash(relPath), lockExt)] = holder
+
+		return nil
+	})
+
+	return result, err
+}
+
+func (fl fileLocks) breakLock(id string) error {
+	return os.Remove(lockPath(id))
+}
+
+func (fetcher Fetcher) lockingChest() (lockingChest, error) {
+	locking, ok := fetcher.Chest.(lockingChest)
+	if !ok {
+		return nil, fmt.Errorf("state stored in %T cannot be locked", fetcher.Chest)
+	}
+
+	return locking, nil
+}
+
+// Lock acquires the lock of the entry shared by all enzyme processes using the same state,
+// returned function releases it. Entries kept in chests which cannot lock are not locked.
+func (fetcher Fetcher) Lock(entry Entry) (func(), error) {
+	path, err := getPath(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetcher.lockPath(path)
+}
+
+// lockPath does the same as Lock for the entry stored by the path
+func (fetcher Fetcher) lockPath(path string) (func(), error) {
+	locking, err := fetcher.lockingChest()
+	if err != nil {
+		return func() {}, nil
+	}
+
+	unlock, err := locking.lock(path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Errorf("Lock: cannot lock entry: %s", err)
+
+		return nil, err
+	}
+
+	return unlock, nil
+}
+
+// Locks returns all locks held by enzyme processes by identifiers of entries
+func (fetcher Fetcher) Locks() (map[string]LockInfo, error) {
+	locking, err := fetcher.lockingChest()
+	if err != nil {
+		return nil, err
+	}
+
+	return locking.locks()
+}
+
+// BreakLock removes the lock of the entry with given identifier regardless of the process holding it,
+// it's only safe when that process is known to be dead
+func (fetcher Fetcher) BreakLock(id string) error {
+	locking, err := fetcher.lockingChest()
+	if err != nil {
+		return err
+	}
+
+	log.WithField("id", id).Warn("BreakLock: removing lock by force")
+
+	return locking.breakLock(id)
+}
+
+func init() {
+	locksDir = storage.GetStoragePath(locksCategory)
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/encryption"
+)
+
+// reencryptingChest is a Chest which can rewrite all stored objects encrypted by the key in use,
+// see encryption.Use
+type reencryptingChest interface {
+	Chest
+	// reencrypt rewrites objects encrypted by another key or unencrypted ones and returns their identifiers
+	reencrypt() ([]string, error)
+}
+
+// Reencrypt rewrites all stored entries encrypted by the key in use, or unencrypted if there is none,
+// and returns identifiers of rewritten entries. Entries are read by the key in use or previous keys.
+func (fetcher Fetcher) Reencrypt() ([]string, error) {
+	reencrypting, ok := fetcher.Chest.(reencryptingChest)
+	if !ok {
+		return nil, fmt.Errorf("state stored in %T cannot be reencrypted", fetcher.Chest)
+	}
+
+	return reencrypting.reencrypt()
+}
+
+func (ch *JSONChest) reencrypt() ([]string, error) {
+	ids, err := ch.find(Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+
+	for _, id := range ids {
+		changed, err := ch.reencryptFile(pathOf(id))
+		if err != nil {
+			log.WithField("id", id).Errorf("JSONChest.reencrypt: cannot reencrypt entry: %s", err)
+			return result, err
+		}
+
+		if changed {
+			result = append(result, id)
+		}
+	}
+
+	// previous versions are rewritten too, so they can be restored by the new key
+	if _, err := encryption.ResealTree(historyDir); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (ch *JSONChest) reencryptFile(path string) (bool, error) {
+	unlock, err := ch.lock(path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	return encryption.Reseal(path)
+}
+
+func (ch *SQLiteChest) reencrypt() ([]string, error) {
+	rows, err := ch.db.Query(`SELECT id, content FROM entries ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	resealed := map[string][]byte{}
+	result := []string{}
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		sealed, changed, err := encryption.ResealContent([]byte(content))
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+
+		if changed {
+			resealed[id] = sealed
+			result = append(result, id)
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// previous versions are rewritten too, so they can be restored by the new key
+	versions, err := ch.resealVersions()
+	if err != nil || len(result) == 0 && len(versions) == 0 {
+		return nil, err
+	}
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range result {
+		if _, err := tx.Exec(`UPDATE entries SET content = ? WHERE id = ?`, string(resealed[id]), id); err != nil {
+			log.WithField("id", id).Errorf("SQLiteChest.reencrypt: cannot store entry: %s", err)
+			tx.Rollback()
+
+			return nil, err
+		}
+	}
+
+	for _, version := range versions {
+		if _, err := tx.Exec(`UPDATE history SET content = ? WHERE id = ? AND version = ?`,
+			string(version.content), version.id, version.number); err != nil {
+			log.WithField("id", version.id).Errorf("SQLiteChest.reencrypt: cannot store version: %s", err)
+			tx.Rollback()
+
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// resealedVersion is a previous version of the entry encrypted by the key in use
+type resealedVersion struct {
+	id      string
+	number  int
+	content []byte
+}
+
+// resealVersions returns previous versions of entries which are to be rewritten by reencrypt
+func (ch *SQLiteChest) resealVersions() ([]resealedVersion, error) {
+	rows, err := ch.db.Query(`SELECT id, version, content FROM history ORDER BY id, version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []resealedVersion{}
+
+	for rows.Next() {
+		var (
+			version resealedVersion
+			content string
+		)
+
+		if err := rows.Scan(&version.id, &version.number, &content); err != nil {
+			return nil, err
+		}
+
+		sealed, changed, err := encryption.ResealContent([]byte(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s version %d: %w", version.id, version.number, err)
+		}
+
+		if changed {
+			version.content = sealed
+			result = append(result, version)
+		}
+	}
+
+	return result, rows.Err()
+}
+
+func (ch *S3Chest) reencrypt() ([]string, error) {
+	objects, err := ch.listed(s3StateFolder, "", stateExt)
+	if err != nil {
+		log.Errorf("S3Chest.reencrypt: cannot list entries: %s", err)
+		return nil, err
+	}
+
+	ids := []string{}
+	for id := range objects {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	result := []string{}
+
+	for _, id := range ids {
+		key := ch.key(s3StateFolder, id, stateExt)
+
+		content, err := ch.read(key, objects[id])
+		if err != nil {
+			return result, err
+		}
+
+		sealed, changed, err := encryption.ResealContent(content)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", id, err)
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := ch.write(key, sealed, false); err != nil {
+			log.WithField("id", id).Errorf("S3Chest.reencrypt: cannot store entry: %s", err)
+			return result, err
+		}
+
+		result = append(result, id)
+	}
+
+	return result, nil
+}
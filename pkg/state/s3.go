@@ -0,0 +1,547 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/encryption"
+	"enzyme/pkg/storage"
+)
+
+const (
+	s3CacheCategory = "state-cache"
+	s3StateFolder   = "state"
+	s3LocksFolder   = "locks"
+	s3ClientTimeout = time.Minute
+)
+
+var (
+	s3CacheDir string
+	// errS3NotFound is returned for objects missing in the bucket
+	errS3NotFound = errors.New("object not found")
+	// errS3Exists is returned when an object isn't created as it already exists
+	errS3Exists = errors.New("object already exists")
+)
+
+// S3Config describes the bucket of an S3-compatible object store keeping enzyme state
+type S3Config struct {
+	// Endpoint is the URL of the store like http://localhost:9000, empty means AWS S3 in Region
+	Endpoint string
+	Bucket   string
+	Region   string
+	// Prefix is prepended to keys of all objects, so several teams can share the bucket
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// WithEnvCredentials returns the config with credentials taken from environment variables
+// used by AWS tools and terraform unless they are set already
+func (config S3Config) WithEnvCredentials() S3Config {
+	for _, credential := range []struct {
+		value *string
+		env   string
+	}{
+		{&config.AccessKey, "AWS_ACCESS_KEY_ID"},
+		{&config.SecretKey, "AWS_SECRET_ACCESS_KEY"},
+		{&config.SessionToken, "AWS_SESSION_TOKEN"},
+	} {
+		if *credential.value == "" {
+			*credential.value = os.Getenv(credential.env)
+		}
+	}
+
+	return config
+}
+
+// endpoint returns the URL of the store without trailing slash
+func (config S3Config) endpoint() string {
+	if config.Endpoint == "" {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+
+	return strings.TrimSuffix(config.Endpoint, "/")
+}
+
+// s3Error is an error response of the store
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s3Err *s3Error) Error() string {
+	return fmt.Sprintf("S3 request failed with status %d: %s %s", s3Err.Status, s3Err.Code, s3Err.Message)
+}
+
+// s3Object is an object listed in the bucket
+type s3Object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+}
+
+type s3ListResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+// cachedObject is an object kept in the local cache together with its ETag
+type cachedObject struct {
+	ETag    string
+	Content []byte
+}
+
+// S3Chest keeps objects in a bucket of an S3-compatible object store, so the state is shared
+// by everyone using the bucket. Objects are locked by lock objects created only if they don't exist,
+// read objects are cached locally and downloaded again only when they are changed.
+type S3Chest struct {
+	config S3Config
+	client *http.Client
+}
+
+// NewS3Chest creates a chest keeping objects in the bucket described by config
+func NewS3Chest(config S3Config) (*S3Chest, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is not set")
+	}
+
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3 credentials are not set")
+	}
+
+	return &S3Chest{
+		config: config,
+		client: &http.Client{Timeout: s3ClientTimeout},
+	}, nil
+}
+
+func (ch *S3Chest) key(folder, id, ext string) string {
+	return path.Join(ch.config.Prefix, folder, id+ext)
+}
+
+// do sends a signed request about the object with given key, empty key means the bucket itself
+func (ch *S3Chest) do(method, key string, query url.Values, body []byte,
+	headers map[string]string) (*http.Response, []byte, error) {
+	target := ch.config.endpoint() + "/" + awsEscape(ch.config.Bucket, false) + "/" + awsEscape(key, true)
+	if len(query) != 0 {
+		target += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	signS3Request(req, body, ch.config, time.Now())
+
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+
+	return resp, content, err
+}
+
+// check turns unexpected responses into errors
+func (ch *S3Chest) check(resp *http.Response, content []byte, expected ...int) error {
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return errS3NotFound
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return errS3Exists
+	}
+
+	s3Err := &s3Error{Status: resp.StatusCode}
+	if err := xml.Unmarshal(content, s3Err); err != nil {
+		s3Err.Message = strings.TrimSpace(string(content))
+	}
+
+	return s3Err
+}
+
+func cachePath(config S3Config, key string) string {
+	return filepath.Join(s3CacheDir, config.Bucket, filepath.FromSlash(key))
+}
+
+func (ch *S3Chest) cached(key string) (cachedObject, bool) {
+	var cached cachedObject
+
+	content, err := encryption.ReadFile(cachePath(ch.config, key))
+	if err != nil || json.Unmarshal(content, &cached) != nil {
+		return cached, false
+	}
+
+	return cached, true
+}
+
+func (ch *S3Chest) cache(key string, object cachedObject) {
+	var buf bytes.Buffer
+
+	err := json.NewEncoder(&buf).Encode(object)
+	if err == nil {
+		err = encryption.WriteFile(cachePath(ch.config, key), buf.Bytes())
+	}
+
+	if err != nil {
+		// the cache only saves downloads
+		log.WithField("key", key).Warnf("S3Chest.cache: cannot cache object: %s", err)
+	}
+}
+
+// read returns contents of the object, cached contents are used if the object has the same ETag,
+// known ETag from listing saves asking the store if the object was changed
+func (ch *S3Chest) read(key, knownETag string) ([]byte, error) {
+	cached, ok := ch.cached(key)
+	if ok && knownETag != "" && cached.ETag == knownETag {
+		return cached.Content, nil
+	}
+
+	headers := map[string]string{}
+	if ok {
+		headers["If-None-Match"] = cached.ETag
+	}
+
+	resp, content, err := ch.do(http.MethodGet, key, nil, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		return cached.Content, nil
+	}
+
+	if err := ch.check(resp, content, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	ch.cache(key, cachedObject{ETag: resp.Header.Get("ETag"), Content: content})
+
+	return content, nil
+}
+
+// write stores the object, only if it doesn't exist when exclusive is set
+func (ch *S3Chest) write(key string, content []byte, exclusive bool) error {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if exclusive {
+		headers["If-None-Match"] = "*"
+	}
+
+	resp, body, err := ch.do(http.MethodPut, key, nil, content, headers)
+	if err != nil {
+		return err
+	}
+
+	if err := ch.check(resp, body, http.StatusOK); err != nil {
+		return err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && !exclusive {
+		ch.cache(key, cachedObject{ETag: etag, Content: content})
+	}
+
+	return nil
+}
+
+func (ch *S3Chest) remove(key string) error {
+	resp, body, err := ch.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return ch.check(resp, body, http.StatusOK, http.StatusNoContent)
+}
+
+// list returns all objects which keys start with prefix
+func (ch *S3Chest) list(prefix string) ([]s3Object, error) {
+	result := []s3Object{}
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, body, err := ch.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ch.check(resp, body, http.StatusOK); err != nil {
+			return nil, err
+		}
+
+		var page s3ListResult
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+
+		result = append(result, page.Contents...)
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return result, nil
+		}
+
+		token = page.NextContinuationToken
+	}
+}
+
+// listed returns identifiers and ETags of objects kept in the folder with given extension
+func (ch *S3Chest) listed(folder, subfolder, ext string) (map[string]string, error) {
+	root := path.Join(ch.config.Prefix, folder) + "/"
+
+	objects, err := ch.list(root + subfolder)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, ext) {
+			result[strings.TrimSuffix(strings.TrimPrefix(object.Key, root), ext)] = object.ETag
+		}
+	}
+
+	return result, nil
+}
+
+func (ch *S3Chest) put(v interface{}, path string) error {
+	id, err := entryID(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+
+	content, err := encryption.Seal(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := ch.write(ch.key(s3StateFolder, id, stateExt), content, false); err != nil {
+		log.WithField("id", id).Errorf("S3Chest.put: cannot store entry: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (ch *S3Chest) get(blank interface{}, path string) (interface{}, error) {
+	id, err := entryID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ch.read(ch.key(s3StateFolder, id, stateExt), "")
+	if err != nil {
+		log.WithField("id", id).Errorf("S3Chest.get: cannot read entry: %s", err)
+		return nil, err
+	}
+
+	result, err := decodeEntry(blank, kindOf(id), content)
+	if err != nil {
+		log.WithField("id", id).Errorf("S3Chest.get: cannot parse entry: %s", err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ch *S3Chest) has(path string) bool {
+	id, err := entryID(path)
+	if err != nil {
+		return false
+	}
+
+	resp, body, err := ch.do(http.MethodHead, ch.key(s3StateFolder, id, stateExt), nil, nil, nil)
+	if err == nil {
+		err = ch.check(resp, body, http.StatusOK)
+	}
+
+	if err != nil && err != errS3NotFound {
+		log.WithField("id", id).Errorf("S3Chest.has: cannot check entry: %s", err)
+	}
+
+	return err == nil
+}
+
+func (ch *S3Chest) find(query Query) ([]string, error) {
+	subfolder := ""
+	if query.Kind != "" {
+		subfolder = query.Kind + "/"
+	}
+
+	objects, err := ch.listed(s3StateFolder, subfolder, stateExt)
+	if err != nil {
+		log.WithField("query", query).Errorf("S3Chest.find: cannot list entries: %s", err)
+		return nil, err
+	}
+
+	result := []string{}
+
+	for id, etag := range objects {
+		var content []byte
+
+		if query.Provider != "" || query.Status != nil {
+			if content, err = ch.read(ch.key(s3StateFolder, id, stateExt), etag); err != nil {
+				return nil, err
+			}
+		}
+
+		if query.matches(id, content) {
+			result = append(result, id)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func (ch *S3Chest) readLock(key string) (LockInfo, error) {
+	var info LockInfo
+
+	resp, content, err := ch.do(http.MethodGet, key, nil, nil, nil)
+	if err == nil {
+		err = ch.check(resp, content, http.StatusOK)
+	}
+
+	if err == nil {
+		err = json.Unmarshal(content, &info)
+	}
+
+	return info, err
+}
+
+func (ch *S3Chest) lock(path string) (func(), error) {
+	id, err := entryID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ch.key(s3LocksFolder, id, lockExt)
+	info := currentLockInfo()
+
+	content, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = ch.write(key, content, true)
+		if err == nil {
+			break
+		}
+
+		if err != errS3Exists {
+			log.WithField("key", key).Errorf("S3Chest.lock: cannot create lock: %s", err)
+			return nil, err
+		}
+
+		holder, readErr := ch.readLock(key)
+		if readErr != nil {
+			// the holder could have just released the lock
+			if readErr == errS3NotFound && attempt < 3 {
+				continue
+			}
+
+			return nil, fmt.Errorf("%s is locked, cannot read lock %s: %w", id, key, readErr)
+		}
+
+		if attempt == 0 && holder.isStale() {
+			log.WithFields(log.Fields{
+				"key":    key,
+				"holder": holder,
+			}).Warn("S3Chest.lock: removing lock of the process which is not running anymore")
+
+			if err := ch.remove(key); err != nil && err != errS3NotFound {
+				return nil, err
+			}
+
+			continue
+		}
+
+		return nil, &LockedError{ID: id, Holder: holder}
+	}
+
+	return func() {
+		// the lock could be broken by force and taken by another process
+		holder, err := ch.readLock(key)
+		if err != nil || holder.PID != info.PID || holder.Host != info.Host || !holder.Since.Equal(info.Since) {
+			return
+		}
+
+		if err := ch.remove(key); err != nil {
+			log.WithField("key", key).Warnf("S3Chest.unlock: cannot remove lock: %s", err)
+		}
+	}, nil
+}
+
+func (ch *S3Chest) locks() (map[string]LockInfo, error) {
+	objects, err := ch.listed(s3LocksFolder, "", lockExt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]LockInfo{}
+
+	for id := range objects {
+		holder, err := ch.readLock(ch.key(s3LocksFolder, id, lockExt))
+		if err == errS3NotFound {
+			continue
+		}
+
+		if err != nil {
+			log.WithField("id", id).Warnf("S3Chest.locks: cannot read lock: %s", err)
+		}
+
+		result[id] = holder
+	}
+
+	return result, nil
+}
+
+func (ch *S3Chest) breakLock(id string) error {
+	return ch.remove(ch.key(s3LocksFolder, id, lockExt))
+}
+
+func init() {
+	s3CacheDir = storage.GetStoragePath(s3CacheCategory)
+}
@@ -0,0 +1,130 @@
+package state
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service       = "s3"
+	s3SignAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// awsEscape encodes a string the way AWS signatures expect: everything except
+// unreserved characters of RFC 3986 is percent-encoded
+func awsEscape(value string, keepSlash bool) string {
+	var builder strings.Builder
+
+	for _, char := range []byte(value) {
+		switch {
+		case 'A' <= char && char <= 'Z', 'a' <= char && char <= 'z', '0' <= char && char <= '9',
+			char == '-', char == '_', char == '.', char == '~', keepSlash && char == '/':
+			builder.WriteByte(char)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", char)
+		}
+	}
+
+	return builder.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	pairs := []string{}
+
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key, false)+"="+awsEscape(value, false))
+		}
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// signS3Request signs the request by AWS Signature Version 4, all headers set in the request
+// by the moment are signed; body is the payload of the request
+func signS3Request(req *http.Request, body []byte, config S3Config, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	payloadHash := hexSHA256(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	names := []string{"host"}
+
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for idx, value := range values {
+			trimmed[idx] = strings.Join(strings.Fields(value), " ")
+		}
+
+		name = strings.ToLower(name)
+		headers[name] = strings.Join(trimmed, ",")
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{amzDate[:8], config.Region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{s3SignAlgorithm, amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, config.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgorithm, config.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
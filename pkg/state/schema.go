@@ -0,0 +1,314 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"enzyme/pkg/encryption"
+	"enzyme/pkg/storage"
+)
+
+const (
+	// SchemaVersionKey is the name of stored field keeping the schema version of an entry,
+	// persistent types of entries should have it as an int field
+	SchemaVersionKey = "SchemaVersion"
+	// entries written before versions were introduced have no version, their layout is version 1
+	unversionedSchema = 1
+	backupsCategory   = "state-backup"
+)
+
+var (
+	backupsDir     string
+	schemaVersions = map[string]int{}
+	migrations     = map[string]map[int]Migration{}
+)
+
+// Migration upgrades a stored entry decoded as JSON object from one schema version to the next one
+type Migration func(entry map[string]interface{}) error
+
+// MigratedEntry describes an entry upgraded to the current schema
+type MigratedEntry struct {
+	ID   string
+	From int
+	To   int
+}
+
+// migratingChest is a Chest which can upgrade all stored objects to current schema versions
+type migratingChest interface {
+	Chest
+	// migrate rewrites outdated objects, keeping the copy of all of them in a new directory
+	// under backupsRoot first, the path of the backup is returned unless nothing was outdated
+	migrate(backupsRoot string) (string, []MigratedEntry, error)
+}
+
+// RegisterSchema sets the current schema version of entries of given kind,
+// the kind is the first element of their hierarchy
+func RegisterSchema(kind string, version int) {
+	schemaVersions[kind] = version
+}
+
+// RegisterMigration adds the migration which upgrades entries of given kind from version to version+1
+func RegisterMigration(kind string, from int, migration Migration) {
+	if migrations[kind] == nil {
+		migrations[kind] = map[int]Migration{}
+	}
+
+	migrations[kind][from] = migration
+}
+
+// SchemaVersion returns the current schema version of entries of given kind,
+// zero means the kind isn't versioned
+func SchemaVersion(kind string) int {
+	return schemaVersions[kind]
+}
+
+// entryKind returns the kind of the object stored at path either as the current state or in the history
+func entryKind(path string) string {
+	for _, dir := range []string{stateDir, historyDir} {
+		relPath, err := filepath.Rel(dir, path)
+		if err == nil && !strings.HasPrefix(relPath, "..") {
+			return strings.Split(filepath.ToSlash(relPath), "/")[0]
+		}
+	}
+
+	return ""
+}
+
+func schemaOf(entry map[string]interface{}) (int, bool, error) {
+	raw, ok := entry[SchemaVersionKey]
+	if !ok {
+		return unversionedSchema, false, nil
+	}
+
+	number, ok := raw.(json.Number)
+	if !ok {
+		return 0, true, fmt.Errorf("wrong %s: %v", SchemaVersionKey, raw)
+	}
+
+	version, err := number.Int64()
+
+	return int(version), true, err
+}
+
+// upgrade migrates stored contents of an entry of given kind to the current schema version,
+// it returns upgraded contents, the stored version and whether the contents were changed;
+// encrypted contents are decrypted first, returned contents are never encrypted
+func upgrade(kind string, content []byte) ([]byte, int, bool, error) {
+	content, err := encryption.Open(content)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	current, ok := schemaVersions[kind]
+	if !ok {
+		return content, 0, false, nil
+	}
+
+	var entry map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	if err := dec.Decode(&entry); err != nil {
+		return nil, 0, false, err
+	}
+
+	version, versioned, err := schemaOf(entry)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if version > current {
+		return nil, version, false, fmt.Errorf("%s state has schema version %d, this enzyme supports up to %d, "+
+			"please use a newer enzyme", kind, version, current)
+	}
+
+	if version == current && versioned {
+		return content, version, false, nil
+	}
+
+	for from := version; from < current; from++ {
+		migration, ok := migrations[kind][from]
+		if !ok {
+			return nil, version, false, fmt.Errorf("no migration of %s state from schema version %d", kind, from)
+		}
+
+		if err := migration(entry); err != nil {
+			return nil, version, false, fmt.Errorf("cannot migrate %s state from schema version %d: %w",
+				kind, from, err)
+		}
+	}
+
+	entry[SchemaVersionKey] = current
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, version, false, err
+	}
+
+	return buf.Bytes(), version, true, nil
+}
+
+// decodeEntry parses stored contents of an entry of given kind as a value of the type of blank,
+// upgrading them to the current schema version first
+func decodeEntry(blank interface{}, kind string, content []byte) (interface{}, error) {
+	upgraded, version, changed, err := upgrade(kind, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		log.WithFields(log.Fields{
+			"kind":    kind,
+			"version": version,
+		}).Info("decodeEntry: upgraded state of outdated schema version")
+	}
+
+	eptr := reflect.New(reflect.TypeOf(blank))
+	if err := json.Unmarshal(upgraded, eptr.Interface()); err != nil {
+		return nil, err
+	}
+
+	return eptr.Interface(), nil
+}
+
+// copyTree copies all files under src to dst keeping relative paths
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0750)
+		}
+
+		return storage.CopyFile(path, target)
+	})
+}
+
+func (ch *JSONChest) migrate(backupsRoot string) (string, []MigratedEntry, error) {
+	outdated := []string{}
+
+	err := filepath.Walk(stateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, stateExt) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if _, _, changed, err := upgrade(entryKind(path), content); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		} else if changed {
+			outdated = append(outdated, path)
+		}
+
+		return nil
+	})
+	if err != nil || len(outdated) == 0 {
+		return "", nil, err
+	}
+
+	if err := os.MkdirAll(backupsRoot, 0750); err != nil {
+		return "", nil, err
+	}
+
+	backupDir, err := ioutil.TempDir(backupsRoot, time.Now().Format("20060102-150405-"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := copyTree(stateDir, backupDir); err != nil {
+		log.WithField("backup", backupDir).Errorf("JSONChest.migrate: cannot back up state: %s", err)
+		return backupDir, nil, err
+	}
+
+	result := []MigratedEntry{}
+
+	for _, path := range outdated {
+		migrated, err := ch.migrateFile(path)
+		if err != nil {
+			log.WithField("path", path).Errorf("JSONChest.migrate: cannot migrate state: %s", err)
+			return backupDir, result, err
+		}
+
+		result = append(result, migrated)
+	}
+
+	return backupDir, result, nil
+}
+
+func (ch *JSONChest) migrateFile(path string) (MigratedEntry, error) {
+	id, err := entryID(path)
+	if err != nil {
+		return MigratedEntry{}, err
+	}
+
+	unlock, err := ch.lock(path)
+	if err != nil {
+		return MigratedEntry{}, err
+	}
+	defer unlock()
+
+	// the file is read again as it could be changed by another process before locking
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return MigratedEntry{}, err
+	}
+
+	kind := entryKind(path)
+
+	upgraded, from, _, err := upgrade(kind, content)
+	if err != nil {
+		return MigratedEntry{}, err
+	}
+
+	err = encryption.WriteFile(path, upgraded)
+
+	return MigratedEntry{ID: id, From: from, To: schemaVersions[kind]}, err
+}
+
+// Migrate upgrades all stored entries to current schema versions in place. Before the first change
+// the whole state is copied to a backup directory, its path is returned unless nothing was outdated.
+func (fetcher Fetcher) Migrate() (string, []MigratedEntry, error) {
+	migrating, ok := fetcher.Chest.(migratingChest)
+	if !ok {
+		return "", nil, fmt.Errorf("state stored in %T cannot be migrated", fetcher.Chest)
+	}
+
+	return migrating.migrate(backupsDir)
+}
+
+func init() {
+	backupsDir = storage.GetStoragePath(backupsCategory)
+}
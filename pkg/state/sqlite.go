@@ -0,0 +1,462 @@
+package state
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	// pure Go SQLite driver registered as "sqlite"
+	_ "modernc.org/sqlite"
+
+	"enzyme/pkg/encryption"
+	"enzyme/pkg/storage"
+)
+
+const (
+	sqliteFile = "state.db"
+	// sqliteTimeout is how long a statement waits for the database locked by another process
+	sqliteTimeout = 10 * time.Second
+)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS entries (
+		id       TEXT PRIMARY KEY,
+		kind     TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		status   INTEGER,
+		updated  TEXT NOT NULL,
+		content  TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS entries_kind ON entries (kind, status)`,
+	`CREATE INDEX IF NOT EXISTS entries_provider ON entries (provider, status)`,
+	`CREATE INDEX IF NOT EXISTS entries_status ON entries (status)`,
+	`CREATE TABLE IF NOT EXISTS history (
+		id       TEXT NOT NULL,
+		version  INTEGER NOT NULL,
+		replaced TEXT NOT NULL,
+		content  TEXT NOT NULL,
+		PRIMARY KEY (id, version)
+	)`,
+}
+
+// SQLiteChest keeps objects in a single SQLite database file indexed by kind, provider and status,
+// so entries are queried without reading all of them. Previous versions of objects are kept
+// in the history table of the same database.
+type SQLiteChest struct {
+	fileLocks
+	db *sql.DB
+}
+
+// DefaultSQLitePath returns the path of the database in enzyme storage
+func DefaultSQLitePath() string {
+	return storage.GetStoragePath(sqliteFile)
+}
+
+// OpenSQLiteChest opens the database at given path creating it if needed
+func OpenSQLiteChest(path string) (*SQLiteChest, error) {
+	if err := storage.CreateDirForFile(path); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		log.WithField("path", path).Errorf("OpenSQLiteChest: cannot open database: %s", err)
+		return nil, err
+	}
+
+	// a single connection keeps the busy timeout set below and is enough for enzyme
+	db.SetMaxOpenConns(1)
+
+	statements := append([]string{
+		fmt.Sprintf("PRAGMA busy_timeout = %d", sqliteTimeout.Milliseconds()),
+	}, sqliteSchema...)
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			log.WithField("path", path).Errorf("OpenSQLiteChest: cannot prepare database: %s", err)
+			db.Close()
+
+			return nil, err
+		}
+	}
+
+	return &SQLiteChest{db: db}, nil
+}
+
+// Close closes the database
+func (ch *SQLiteChest) Close() error {
+	return ch.db.Close()
+}
+
+func (ch *SQLiteChest) put(v interface{}, path string) error {
+	id, err := entryID(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var current string
+
+	err = tx.QueryRow(`SELECT content FROM entries WHERE id = ?`, id).Scan(&current)
+	if err == nil && encryption.Unchanged([]byte(current), buf.Bytes()) {
+		// entries are saved often without changes, these saves shouldn't push out the history
+		return tx.Rollback()
+	}
+
+	if err != nil && err != sql.ErrNoRows {
+		log.WithField("id", id).Errorf("SQLiteChest.put: cannot read stored entry: %s", err)
+		tx.Rollback()
+
+		return err
+	}
+
+	if err := ch.archive(tx, id); err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.put: cannot keep previous version: %s", err)
+		tx.Rollback()
+
+		return err
+	}
+
+	if err := ch.write(tx, id, buf.Bytes()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// archive copies the current content of the entry to the history as the newest version,
+// dropping the oldest versions beyond HistoryLimit
+func (ch *SQLiteChest) archive(db sqlExecer, id string) error {
+	if HistoryLimit <= 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(`INSERT INTO history (id, version, replaced, content)
+		SELECT id, (SELECT coalesce(max(version), 0) + 1 FROM history WHERE id = ?), ?, content
+		FROM entries WHERE id = ?`, id, time.Now().Format(time.RFC3339), id); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`DELETE FROM history
+		WHERE id = ? AND version <= (SELECT max(version) FROM history WHERE id = ?) - ?`, id, id, HistoryLimit)
+
+	return err
+}
+
+func (ch *SQLiteChest) versions(path string) ([]storedVersion, error) {
+	id, err := entryID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := ch.db.Query(`SELECT version, replaced FROM history WHERE id = ? ORDER BY version`, id)
+	if err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.versions: cannot query history: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []storedVersion{}
+
+	for rows.Next() {
+		var (
+			version  storedVersion
+			replaced string
+		)
+
+		if err := rows.Scan(&version.number, &replaced); err != nil {
+			return nil, err
+		}
+
+		if version.time, err = time.Parse(time.RFC3339, replaced); err != nil {
+			return nil, err
+		}
+
+		result = append(result, version)
+	}
+
+	return result, rows.Err()
+}
+
+func (ch *SQLiteChest) getVersion(blank interface{}, path string, version int) (interface{}, error) {
+	id, err := entryID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var content string
+
+	err = ch.db.QueryRow(`SELECT content FROM history WHERE id = ? AND version = ?`, id, version).Scan(&content)
+	if err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.getVersion: cannot read version %d: %s", version, err)
+		return nil, err
+	}
+
+	return decodeEntry(blank, kindOf(id), []byte(content))
+}
+
+func (ch *SQLiteChest) restore(path string, version int) error {
+	id, err := entryID(path)
+	if err != nil {
+		return err
+	}
+
+	var content string
+
+	err = ch.db.QueryRow(`SELECT content FROM history WHERE id = ? AND version = ?`, id, version).Scan(&content)
+	if err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.restore: cannot read version %d: %s", version, err)
+		return err
+	}
+
+	// the entry is written as a new one, so its indexed fields are taken from the restored content
+	plain, err := encryption.Open([]byte(content))
+	if err != nil {
+		return err
+	}
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := ch.archive(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := ch.write(tx, id, plain); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqlExecer is what both sql.DB and sql.Tx can do
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (ch *SQLiteChest) write(db sqlExecer, id string, content []byte) error {
+	index := indexOf(content)
+
+	var status sql.NullInt64
+	if index.Status != nil {
+		status = sql.NullInt64{Int64: int64(*index.Status), Valid: true}
+	}
+
+	// indexed fields are kept unencrypted, so entries can be queried without the key
+	content, err := encryption.Seal(content)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO entries (id, kind, provider, status, updated, content)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET kind = excluded.kind, provider = excluded.provider,
+			status = excluded.status, updated = excluded.updated, content = excluded.content`,
+		id, kindOf(id), index.Provider, status, time.Now().Format(time.RFC3339), string(content))
+	if err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.put: cannot store entry: %s", err)
+	}
+
+	return err
+}
+
+func (ch *SQLiteChest) get(blank interface{}, path string) (interface{}, error) {
+	id, err := entryID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var content string
+	if err := ch.db.QueryRow(`SELECT content FROM entries WHERE id = ?`, id).Scan(&content); err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.get: cannot read entry: %s", err)
+		return nil, err
+	}
+
+	result, err := decodeEntry(blank, kindOf(id), []byte(content))
+	if err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.get: cannot parse entry: %s", err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ch *SQLiteChest) has(path string) bool {
+	id, err := entryID(path)
+	if err != nil {
+		return false
+	}
+
+	var found int
+
+	err = ch.db.QueryRow(`SELECT count(*) FROM entries WHERE id = ?`, id).Scan(&found)
+	if err != nil {
+		log.WithField("id", id).Errorf("SQLiteChest.has: cannot query entry: %s", err)
+	}
+
+	return found != 0
+}
+
+func (ch *SQLiteChest) find(query Query) ([]string, error) {
+	conditions := []string{"1 = 1"}
+	args := []interface{}{}
+
+	if query.Kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, query.Kind)
+	}
+
+	if query.Provider != "" {
+		conditions = append(conditions, "provider = ?")
+		args = append(args, query.Provider)
+	}
+
+	if query.Status != nil {
+		conditions = append(conditions, "status = ?")
+		args = append(args, *query.Status)
+	}
+
+	rows, err := ch.db.Query(`SELECT id FROM entries WHERE `+strings.Join(conditions, " AND ")+` ORDER BY id`,
+		args...)
+	if err != nil {
+		log.WithField("query", query).Errorf("SQLiteChest.find: cannot query entries: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []string{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		result = append(result, id)
+	}
+
+	return result, rows.Err()
+}
+
+func (ch *SQLiteChest) migrate(backupsRoot string) (string, []MigratedEntry, error) {
+	rows, err := ch.db.Query(`SELECT id, content FROM entries ORDER BY id`)
+	if err != nil {
+		return "", nil, err
+	}
+
+	upgraded := map[string][]byte{}
+	result := []MigratedEntry{}
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return "", nil, err
+		}
+
+		kind := kindOf(id)
+
+		migrated, from, changed, err := upgrade(kind, []byte(content))
+		if err != nil {
+			rows.Close()
+			return "", nil, fmt.Errorf("%s: %w", id, err)
+		}
+
+		if changed {
+			upgraded[id] = migrated
+			result = append(result, MigratedEntry{ID: id, From: from, To: schemaVersions[kind]})
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil || len(result) == 0 {
+		return "", nil, err
+	}
+
+	if err := os.MkdirAll(backupsRoot, 0750); err != nil {
+		return "", nil, err
+	}
+
+	backupDir, err := ioutil.TempDir(backupsRoot, time.Now().Format("20060102-150405-"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := ch.db.Exec(`VACUUM INTO ?`, filepath.Join(backupDir, sqliteFile)); err != nil {
+		log.WithField("backup", backupDir).Errorf("SQLiteChest.migrate: cannot back up state: %s", err)
+		return backupDir, nil, err
+	}
+
+	tx, err := ch.db.Begin()
+	if err != nil {
+		return backupDir, nil, err
+	}
+
+	for _, entry := range result {
+		if err := ch.write(tx, entry.ID, upgraded[entry.ID]); err != nil {
+			tx.Rollback()
+			return backupDir, nil, err
+		}
+	}
+
+	return backupDir, result, tx.Commit()
+}
+
+// ImportJSON copies states kept as .json files by JSONChest to the chest of the fetcher,
+// entries which are already in the chest are skipped
+func (fetcher Fetcher) ImportJSON() (imported []string, skipped []string, err error) {
+	if _, ok := fetcher.Chest.(*JSONChest); ok {
+		return nil, nil, fmt.Errorf("state is already kept in .json files")
+	}
+
+	ids, err := jsonChest.find(Query{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range ids {
+		path := pathOf(id)
+
+		if fetcher.Chest.has(path) {
+			skipped = append(skipped, id)
+			continue
+		}
+
+		content, err := encryption.ReadFile(path)
+		if err != nil {
+			return imported, skipped, err
+		}
+
+		if err := fetcher.Chest.put(json.RawMessage(content), path); err != nil {
+			log.WithField("id", id).Errorf("ImportJSON: cannot import entry: %s", err)
+			return imported, skipped, err
+		}
+
+		imported = append(imported, id)
+	}
+
+	return imported, skipped, nil
+}
@@ -1,6 +1,8 @@
 package state
 
 import (
+	"errors"
+
 	log "github.com/sirupsen/logrus"
 
 	"enzyme/pkg/storage"
@@ -44,6 +46,14 @@ func (fetcher Fetcher) loadFromPath(entry Entry, path string) (Entry, error) {
 	}).Infof("Load: loaded entry from disk as %s", blank)
 
 	result, err := entry.FromPublic(blank)
+
+	var changedErr *ChangedVariablesError
+	if errors.As(err, &changedErr) {
+		if changedErr.ID, err = entryID(path); err == nil {
+			err = changedErr
+		}
+	}
+
 	if err != nil {
 		log.WithFields(log.Fields{
 			"entry": entry,
@@ -1,12 +1,18 @@
 package state
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"os"
-	"reflect"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"enzyme/pkg/encryption"
 	"enzyme/pkg/storage"
 )
 
@@ -16,30 +22,47 @@ type Chest interface {
 	put(v interface{}, path string) error
 	get(blank interface{}, path string) (interface{}, error)
 	has(path string) bool
+	// find returns sorted identifiers of stored objects matching the query
+	find(query Query) ([]string, error)
 }
 
 var (
 	jsonChest Chest = &JSONChest{}
 )
 
-// JSONChest keeps objects as .json files
+// JSONChest keeps objects as .json files, files are replaced atomically
+// and a few previous versions of each are kept in the history
 type JSONChest struct {
+	fileLocks
 }
 
 func (ch *JSONChest) put(v interface{}, path string) error {
-	if err := storage.CreateDirForFile(path); err != nil {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
 		return err
 	}
 
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0640)
+	if current, err := ioutil.ReadFile(path); err == nil && encryption.Unchanged(current, buf.Bytes()) {
+		// entries are saved often without changes, these saves shouldn't push out the history
+		return nil
+	}
+
+	content, err := encryption.Seal(buf.Bytes())
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	enc := json.NewEncoder(file)
+	if err := ch.archive(path); err != nil {
+		// losing history is better than losing the new state
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Warnf("JSONChest.put: cannot keep previous version: %s", err)
+	}
 
-	return enc.Encode(v)
+	return storage.WriteFileAtomic(path, 0640, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
 }
 
 func (ch *JSONChest) get(blank interface{}, path string) (interface{}, error) {
@@ -48,7 +71,7 @@ func (ch *JSONChest) get(blank interface{}, path string) (interface{}, error) {
 		"blueprint": blank,
 	}).Info("JSONChest.get: loading entry")
 
-	file, err := os.Open(path)
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"path": path,
@@ -56,12 +79,9 @@ func (ch *JSONChest) get(blank interface{}, path string) (interface{}, error) {
 
 		return nil, err
 	}
-	defer file.Close()
-
-	dec := json.NewDecoder(file)
-	eptr := reflect.New(reflect.TypeOf(blank))
 
-	if err = dec.Decode(eptr.Interface()); err != nil {
+	result, err := decodeEntry(blank, entryKind(path), content)
+	if err != nil {
 		log.WithFields(log.Fields{
 			"path": path,
 		}).Errorf("JSONChest.get: cannot parse json file: %s", err)
@@ -69,7 +89,7 @@ func (ch *JSONChest) get(blank interface{}, path string) (interface{}, error) {
 		return nil, err
 	}
 
-	return eptr.Interface(), nil
+	return result, nil
 }
 
 func (ch *JSONChest) has(path string) bool {
@@ -77,11 +97,69 @@ func (ch *JSONChest) has(path string) bool {
 	return !os.IsNotExist(err)
 }
 
+func (ch *JSONChest) find(query Query) ([]string, error) {
+	result := []string{}
+
+	err := filepath.Walk(stateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.WithField("path", path).Infof("JSONChest.find: cannot walk the path: %s", err)
+				return filepath.SkipDir
+			}
+
+			log.WithField("path", path).Errorf("JSONChest.find: cannot walk the path: %s", err)
+
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, stateExt) {
+			return nil
+		}
+
+		id, err := entryID(path)
+		if err != nil {
+			return err
+		}
+
+		if query.Kind != "" && query.Kind != kindOf(id) {
+			return nil
+		}
+
+		if query.Provider != "" || query.Status != nil {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			if !query.matches(id, content) {
+				return nil
+			}
+		}
+
+		result = append(result, id)
+
+		return nil
+	})
+
+	sort.Strings(result)
+
+	return result, err
+}
+
 // MemChest keeps objects in memory and falls *on reading only* to
-// JSONChest to see if objects were stored on disk; this is needed
-// to make a read-only disk storage
+// Fallback (JSONChest by default) to see if objects were stored on disk;
+// this is needed to make a read-only disk storage
 type MemChest struct {
-	data map[string]interface{}
+	Fallback Chest
+	data     map[string]interface{}
+}
+
+func (ch *MemChest) fallback() Chest {
+	if ch.Fallback == nil {
+		return jsonChest
+	}
+
+	return ch.Fallback
 }
 
 func (ch *MemChest) put(v interface{}, path string) error {
@@ -100,7 +178,7 @@ func (ch *MemChest) get(blank interface{}, path string) (interface{}, error) {
 		return mem, nil
 	}
 
-	return jsonChest.get(blank, path)
+	return ch.fallback().get(blank, path)
 }
 
 func (ch *MemChest) has(path string) bool {
@@ -109,5 +187,40 @@ func (ch *MemChest) has(path string) bool {
 		return true
 	}
 
-	return jsonChest.has(path)
+	return ch.fallback().has(path)
+}
+
+func (ch *MemChest) find(query Query) ([]string, error) {
+	stored, err := ch.fallback().find(query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+
+	for _, id := range stored {
+		if _, ok := ch.data[pathOf(id)]; !ok {
+			result = append(result, id)
+		}
+	}
+
+	for path, v := range ch.data {
+		id, err := entryID(path)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if query.matches(id, content) {
+			result = append(result, id)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result, nil
 }
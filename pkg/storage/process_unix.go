@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package storage
+
+import (
+	"syscall"
+)
+
+// ProcessExists tells if a process with given pid is running on this host
+func ProcessExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
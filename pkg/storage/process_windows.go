@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package storage
+
+// ProcessExists tells if a process with given pid is running on this host,
+// it cannot be checked cheaply so the process is assumed to be running
+func ProcessExists(pid int) bool {
+	return true
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -119,6 +120,72 @@ func CopyFile(src, dst string) error {
 	return err
 }
 
+// WriteFileAtomic writes the file so it has either old or new contents even if the process
+// crashes: data is written to a temporary file in the same directory, flushed to the disk
+// and renamed over the target
+func WriteFileAtomic(fileName string, perm os.FileMode, write func(w io.Writer) error) error {
+	if err := CreateDirForFile(fileName); err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(fileName)
+	if dir == "" {
+		dir = "."
+	}
+
+	// temporary name must not end with the extension of the target, so it isn't mistaken for one
+	tmp, err := ioutil.TempFile(dir, base+".tmp*")
+	if err != nil {
+		log.WithField("filename", fileName).Errorf("WriteFileAtomic: cannot create temporary file: %s", err)
+		return err
+	}
+
+	tmpName := tmp.Name()
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if err = write(tmp); err == nil {
+		err = tmp.Sync()
+	}
+
+	if err == nil {
+		err = tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Chmod(tmpName, perm)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpName, fileName)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"filename":  fileName,
+			"temporary": tmpName,
+		}).Errorf("WriteFileAtomic: cannot write file: %s", err)
+
+		return err
+	}
+
+	renamed = true
+
+	// make the rename itself durable, directories cannot be synced on some platforms which is fine
+	if dirFile, err := os.Open(dir); err == nil {
+		_ = dirFile.Sync()
+		dirFile.Close()
+	}
+
+	return nil
+}
+
 func init() {
 	curdir, err := os.Getwd()
 	if err != nil {
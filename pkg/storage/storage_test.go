@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -36,3 +39,42 @@ func TestCreateDirForFile(t *testing.T) {
 		t.Errorf("RemoveAll function returned error: [%s]", errRemoveAll)
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dirTempFolder, errTempDir := ioutil.TempDir("", "storage_unit_tests_temp")
+	if errTempDir != nil {
+		t.Fatalf("TempDir function returned error: [%s]", errTempDir)
+	}
+	defer os.RemoveAll(dirTempFolder)
+
+	pathToFile := filepath.Join(dirTempFolder, "nestedFolder", "state.json")
+
+	err := WriteFileAtomic(pathToFile, 0640, func(w io.Writer) error {
+		_, err := fmt.Fprint(w, "first")
+		return err
+	})
+	if err != nil {
+		t.Errorf("WriteFileAtomic function returned error: [%s]", err)
+	}
+
+	err = WriteFileAtomic(pathToFile, 0640, func(w io.Writer) error {
+		if _, err := fmt.Fprint(w, "sec"); err != nil {
+			return err
+		}
+
+		return errors.New("crashed in the middle")
+	})
+	if err == nil {
+		t.Errorf("WriteFileAtomic function didn't return error of writer")
+	}
+
+	content, err := ioutil.ReadFile(pathToFile)
+	if err != nil || string(content) != "first" {
+		t.Errorf("wrong contents after failed write: [first]!=[%s] [%v]", content, err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(pathToFile))
+	if err != nil || len(files) != 1 {
+		t.Errorf("temporary files are left after failed write: [%v] [%v]", files, err)
+	}
+}